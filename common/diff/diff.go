@@ -0,0 +1,114 @@
+package diff
+
+import (
+	"strings"
+)
+
+// Operations of diff line.
+const (
+	OpEqual  = "="
+	OpInsert = "+"
+	OpDelete = "-"
+)
+
+// Line is one line in diff result.
+type Line struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// Lines returns line-based diff from `a` to `b` using Myers' algorithm.
+func Lines(a, b string) []Line {
+	return Slices(split(a), split(b))
+}
+
+// Slices returns diff from `a` to `b`.
+func Slices(a, b []string) []Line {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return []Line{}
+	}
+
+	offset := max
+	v := make([]int, 2*max+2)
+	trace := [][]int{}
+
+	for d := 0; d <= max; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			x := 0
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace, offset)
+			}
+		}
+	}
+
+	return []Line{}
+}
+
+func backtrack(a, b []string, trace [][]int, offset int) []Line {
+	x, y := len(a), len(b)
+	ret := []Line{}
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		prevK := 0
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ret = append(ret, Line{Op: OpEqual, Text: a[x]})
+		}
+
+		if d > 0 {
+			if x == prevX {
+				ret = append(ret, Line{Op: OpInsert, Text: b[prevY]})
+			} else {
+				ret = append(ret, Line{Op: OpDelete, Text: a[prevX]})
+			}
+		}
+
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(ret)-1; i < j; i, j = i+1, j-1 {
+		ret[i], ret[j] = ret[j], ret[i]
+	}
+
+	return ret
+}
+
+func split(s string) []string {
+	if len(s) == 0 {
+		return []string{}
+	}
+
+	return strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+}
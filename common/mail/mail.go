@@ -0,0 +1,118 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Mailer sends mails through SMTP server.
+type Mailer struct {
+	Host       string `json:"host"`
+	Port       int    `json:"port"`
+	Account    string `json:"account"`
+	Password   string `json:"-"`
+	From       string `json:"from"`
+	TLS        bool   `json:"tls"`
+	SkipVerify bool   `json:"skipVerify"`
+}
+
+// Enabled returns true if SMTP server has been configured.
+func (m *Mailer) Enabled() bool {
+	return m.Host != "" && m.From != ""
+}
+
+// Send a mail to given receivers.
+func (m *Mailer) Send(to []string, subject, contentType string, body []byte) error {
+	if !m.Enabled() {
+		return errors.New("邮件服务未配置")
+	}
+
+	if len(to) == 0 {
+		return errors.New("未指定收件人")
+	}
+
+	c, err := smtp.Dial(fmt.Sprintf("%s:%d", m.Host, m.Port))
+	if err != nil {
+		return err
+	}
+
+	defer c.Close()
+
+	if err = c.Hello("team"); err != nil {
+		return err
+	}
+
+	if m.TLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP server unsupports TLS")
+		}
+
+		err = c.StartTLS(&tls.Config{
+			InsecureSkipVerify: m.SkipVerify,
+			ServerName:         m.Host,
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.Account != "" {
+		if err = c.Auth(smtp.PlainAuth("", m.Account, m.Password, m.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err = c.Mail(m.From); err != nil {
+		return err
+	}
+
+	for _, one := range to {
+		if err = c.Rcpt(one); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err = w.Write(m.compose(to, subject, contentType, body)); err != nil {
+		return err
+	}
+
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+func (m *Mailer) compose(to []string, subject, contentType string, body []byte) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("From: " + m.From + "\r\n")
+	buf.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	buf.WriteString("Subject: " + mime.BEncoding.Encode("UTF-8", subject) + "\r\n")
+	buf.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: " + contentType + "\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString(body)
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,430 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	entity     = regexp.MustCompile(`^&(?:#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6}|[a-zA-Z][a-zA-Z0-9]{1,31});`)
+	autoLink   = regexp.MustCompile(`^<([a-zA-Z][a-zA-Z0-9+.-]{1,31}:[^\s<>]*|[a-zA-Z0-9.!#$%&'*+/=?^_` + "`" + `{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9.-]*[a-zA-Z0-9])?)>`)
+	inlineHTML = regexp.MustCompile(`^(?:<!--[\s\S]*?-->|</?[a-zA-Z][a-zA-Z0-9-]*(?:\s+[a-zA-Z_:][a-zA-Z0-9_.:-]*(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?)*\s*/?>)`)
+	bareURL    = regexp.MustCompile(`^https?://[^\s<>"]+`)
+)
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isAlnum(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+// runLength counts repeats of s[i] starting at i.
+func runLength(s string, i int) int {
+	n := 1
+	for i+n < len(s) && s[i+n] == s[i] {
+		n++
+	}
+
+	return n
+}
+
+// skipCode returns end of code span starting at i, or -1 if it is not closed.
+func skipCode(s string, i int) int {
+	n := runLength(s, i)
+	for j := i + n; j < len(s); {
+		k := strings.IndexByte(s[j:], '`')
+		if k < 0 {
+			return -1
+		}
+
+		j += k
+		m := runLength(s, j)
+		if m == n {
+			return j + m
+		}
+
+		j += m
+	}
+
+	return -1
+}
+
+// findClosing finds closing delimiter run of exactly given length.
+func findClosing(s string, from int, delim byte, length int) int {
+	for j := from; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '`':
+			if end := skipCode(s, j); end > 0 {
+				j = end - 1
+			} else {
+				j += runLength(s, j) - 1
+			}
+		case delim:
+			n := runLength(s, j)
+			if n == length && j > from && !isSpace(s[j-1]) && (delim != '_' || j+n >= len(s) || !isAlnum(s[j+n])) {
+				return j
+			}
+
+			j += n - 1
+		}
+	}
+
+	return -1
+}
+
+// findBracket finds the bracket closing the one at i.
+func findBracket(s string, i int) int {
+	depth := 0
+	for j := i; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '`':
+			if end := skipCode(s, j); end > 0 {
+				j = end - 1
+			}
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+
+	return -1
+}
+
+// parseDestination parses `(url "title")` at i. Returns url, title and end.
+func parseDestination(s string, i int) (string, string, int) {
+	if i >= len(s) || s[i] != '(' {
+		return "", "", -1
+	}
+
+	j := i + 1
+	for j < len(s) && isSpace(s[j]) {
+		j++
+	}
+
+	dest := ""
+	if j < len(s) && s[j] == '<' {
+		end := strings.IndexAny(s[j+1:], ">\n")
+		if end < 0 || s[j+1+end] != '>' {
+			return "", "", -1
+		}
+
+		dest = s[j+1 : j+1+end]
+		j += end + 2
+	} else {
+		depth := 0
+		start := j
+		for ; j < len(s) && !isSpace(s[j]); j++ {
+			if s[j] == '\\' && j+1 < len(s) && isPunct(s[j+1]) {
+				j++
+			} else if s[j] == '(' {
+				depth++
+			} else if s[j] == ')' {
+				if depth == 0 {
+					break
+				}
+				depth--
+			}
+		}
+
+		dest = s[start:j]
+	}
+
+	for j < len(s) && isSpace(s[j]) {
+		j++
+	}
+
+	title := ""
+	if j < len(s) && (s[j] == '"' || s[j] == '\'' || s[j] == '(') {
+		closer := s[j]
+		if closer == '(' {
+			closer = ')'
+		}
+
+		end := strings.IndexByte(s[j+1:], closer)
+		if end < 0 {
+			return "", "", -1
+		}
+
+		title = s[j+1 : j+1+end]
+		j += end + 2
+
+		for j < len(s) && isSpace(s[j]) {
+			j++
+		}
+	}
+
+	if j >= len(s) || s[j] != ')' {
+		return "", "", -1
+	}
+
+	return unescape(dest), unescape(title), j + 1
+}
+
+// unescape removes backslash escapes and decodes entities.
+func unescape(s string) string {
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isPunct(s[i+1]) {
+			i++
+		}
+
+		buf.WriteByte(s[i])
+	}
+
+	return html.UnescapeString(buf.String())
+}
+
+// plainText strips markdown syntax roughly. Used as alt text of images.
+func plainText(s string) string {
+	return strings.NewReplacer("*", "", "_", "", "`", "", "[", "", "]", "", "~", "").Replace(unescape(s))
+}
+
+// inline renders span level elements.
+func (r *renderer) inline(s string) {
+	text := 0
+	flush := func(end int) {
+		if end > text {
+			r.buf.WriteString(html.EscapeString(s[text:end]))
+		}
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		next := -1
+
+		switch c {
+		case '\\':
+			if i+1 < len(s) && s[i+1] == '\n' {
+				flush(i)
+				r.buf.WriteString("<br>\n")
+				next = i + 2
+			} else if i+1 < len(s) && isPunct(s[i+1]) {
+				flush(i)
+				r.buf.WriteString(html.EscapeString(s[i+1 : i+2]))
+				next = i + 2
+			}
+		case '`':
+			if end := skipCode(s, i); end > 0 {
+				flush(i)
+				n := runLength(s, i)
+				code := strings.Replace(s[i+n:end-n], "\n", " ", -1)
+				if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+					code = code[1 : len(code)-1]
+				}
+
+				r.buf.WriteString("<code>")
+				r.buf.WriteString(html.EscapeString(code))
+				r.buf.WriteString("</code>")
+				next = end
+			} else {
+				next = i + runLength(s, i)
+				flush(next)
+			}
+		case '!', '[':
+			if c == '[' && r.inLink {
+				break
+			}
+
+			if label, dest, title, end := link(s, i); end > 0 {
+				flush(i)
+				if c == '!' {
+					r.image(dest, title, label)
+				} else {
+					r.anchor(dest, title, label, dest)
+				}
+				next = end
+			}
+		case '<':
+			if m := autoLink.FindStringSubmatch(s[i:]); m != nil && !r.inLink {
+				flush(i)
+				href := m[1]
+				if !strings.Contains(href, ":") {
+					href = "mailto:" + href
+				}
+
+				r.anchor(href, "", "", m[1])
+				next = i + len(m[0])
+			} else if m := inlineHTML.FindString(s[i:]); m != "" {
+				flush(i)
+				r.buf.WriteString(m)
+				next = i + len(m)
+			}
+		case '&':
+			if m := entity.FindString(s[i:]); m != "" {
+				flush(i)
+				r.buf.WriteString(m)
+				next = i + len(m)
+			}
+		case 'h':
+			if !r.inLink && (i == 0 || !isAlnum(s[i-1])) {
+				if m := bareURL.FindString(s[i:]); m != "" {
+					m = trimURL(m)
+					flush(i)
+					r.anchor(m, "", "", m)
+					next = i + len(m)
+				}
+			}
+		case '*', '_', '~':
+			flush(i)
+			text = i
+			if end := r.emphasis(s, i); end > 0 {
+				next = end
+			} else {
+				next = i + runLength(s, i)
+				flush(next)
+			}
+		}
+
+		if next < 0 {
+			i++
+			continue
+		}
+
+		i = next
+		text = next
+	}
+
+	flush(len(s))
+}
+
+// trimURL removes trailing punctuation which is more likely part of sentence.
+func trimURL(u string) string {
+	for len(u) > 0 {
+		last := u[len(u)-1]
+		if strings.IndexByte(".,:;!?'*_~", last) >= 0 {
+			u = u[:len(u)-1]
+		} else if last == ')' && strings.Count(u, "(") < strings.Count(u, ")") {
+			u = u[:len(u)-1]
+		} else {
+			break
+		}
+	}
+
+	return u
+}
+
+// link parses link or image starting at i. Returns -1 as end if there is
+// none.
+func link(s string, i int) (label, dest, title string, end int) {
+	open := i
+	if s[i] == '!' {
+		if i+1 >= len(s) || s[i+1] != '[' {
+			return "", "", "", -1
+		}
+		open++
+	}
+
+	close := findBracket(s, open)
+	if close < 0 {
+		return "", "", "", -1
+	}
+
+	dest, title, end = parseDestination(s, close+1)
+	return s[open+1 : close], dest, title, end
+}
+
+// anchor writes a link. Empty label is replaced with text provided by
+// Options.Link, or given display text.
+func (r *renderer) anchor(dest, title, label, display string) {
+	text := ""
+	if r.opts.Link != nil {
+		dest, text = r.opts.Link(dest)
+	}
+
+	r.buf.WriteString(`<a href="`)
+	r.buf.WriteString(html.EscapeString(dest))
+	r.buf.WriteString(`"`)
+	if title != "" {
+		r.buf.WriteString(` title="`)
+		r.buf.WriteString(html.EscapeString(title))
+		r.buf.WriteString(`"`)
+	}
+	r.buf.WriteString(">")
+
+	switch {
+	case strings.TrimSpace(label) != "":
+		// Links can not be nested.
+		r.inLink = true
+		r.inline(label)
+		r.inLink = false
+	case text != "":
+		r.buf.WriteString(html.EscapeString(text))
+	default:
+		r.buf.WriteString(html.EscapeString(display))
+	}
+
+	r.buf.WriteString("</a>")
+}
+
+// image writes an image.
+func (r *renderer) image(src, title, alt string) {
+	if r.opts.Image != nil {
+		src = r.opts.Image(src)
+	}
+
+	r.buf.WriteString(`<img src="`)
+	r.buf.WriteString(html.EscapeString(src))
+	r.buf.WriteString(`" alt="`)
+	r.buf.WriteString(html.EscapeString(plainText(alt)))
+	r.buf.WriteString(`"`)
+	if title != "" {
+		r.buf.WriteString(` title="`)
+		r.buf.WriteString(html.EscapeString(title))
+		r.buf.WriteString(`"`)
+	}
+	r.buf.WriteString(">")
+}
+
+// emphasis writes emphasis, strong emphasis or strikethrough starting at i.
+// Returns -1 if delimiters are not matched.
+func (r *renderer) emphasis(s string, i int) int {
+	c := s[i]
+	n := runLength(s, i)
+
+	// Opening delimiter must be followed by non-space, and underscores inside
+	// a word are not delimiters.
+	if i+n >= len(s) || isSpace(s[i+n]) || (c == '_' && i > 0 && isAlnum(s[i-1])) {
+		return -1
+	}
+
+	var open, close string
+	switch {
+	case c == '~' && n == 2:
+		open, close = "<del>", "</del>"
+	case c == '~':
+		return -1
+	case n == 1:
+		open, close = "<em>", "</em>"
+	case n == 2:
+		open, close = "<strong>", "</strong>"
+	case n == 3:
+		open, close = "<em><strong>", "</strong></em>"
+	default:
+		return -1
+	}
+
+	end := findClosing(s, i+n, c, n)
+	if end < 0 {
+		return -1
+	}
+
+	r.buf.WriteString(open)
+	r.inline(s[i+n : end])
+	r.buf.WriteString(close)
+	return end + n
+}
@@ -0,0 +1,524 @@
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Options customizes rendering of links and images.
+type Options struct {
+	// Link rewrites destination of a link. The second return value is used as
+	// text when the link has none, such as name of a linked task.
+	Link func(href string) (string, string)
+	// Image rewrites source of an image.
+	Image func(src string) string
+}
+
+var (
+	atxHeading     = regexp.MustCompile(`^(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	thematicBreak  = regexp.MustCompile(`^(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	setextUnder    = regexp.MustCompile(`^(?:=+|-+)[ \t]*$`)
+	codeFence      = regexp.MustCompile("^(`{3,}|~{3,})[ \t]*([^`]*)$")
+	tableDelimiter = regexp.MustCompile(`^\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+	htmlBlockStart = regexp.MustCompile(`^<(?:!--|/?[a-zA-Z][a-zA-Z0-9-]*(?:[ \t/>]|$))`)
+	taskMarker     = regexp.MustCompile(`^\[([ xX])\][ \t]+`)
+)
+
+type renderer struct {
+	opts   *Options
+	buf    strings.Builder
+	inLink bool
+}
+
+// Render converts markdown source into sanitized HTML.
+func Render(src string, opts *Options) string {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	r := &renderer{opts: opts}
+	r.blocks(splitLines(src), false)
+	return Sanitize(r.buf.String())
+}
+
+// splitLines normalizes line endings and expands leading tabs.
+func splitLines(src string) []string {
+	src = strings.Replace(src, "\r\n", "\n", -1)
+	src = strings.Replace(src, "\r", "\n", -1)
+
+	lines := strings.Split(src, "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, " ") {
+			continue
+		}
+
+		expanded := []byte{}
+		j := 0
+		for ; j < len(line) && (line[j] == ' ' || line[j] == '\t'); j++ {
+			if line[j] == ' ' {
+				expanded = append(expanded, ' ')
+			} else {
+				expanded = append(expanded, strings.Repeat(" ", 4-len(expanded)%4)...)
+			}
+		}
+
+		lines[i] = string(expanded) + line[j:]
+	}
+
+	return lines
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// dedent removes at most n leading spaces.
+func dedent(line string, n int) string {
+	i := 0
+	for i < n && i < len(line) && line[i] == ' ' {
+		i++
+	}
+
+	return line[i:]
+}
+
+// startsBlock tests if line can interrupt a paragraph.
+func startsBlock(line string) bool {
+	if indentOf(line) >= 4 {
+		return false
+	}
+
+	trimmed := strings.TrimLeft(line, " ")
+	if atxHeading.MatchString(trimmed) || thematicBreak.MatchString(trimmed) || codeFence.MatchString(trimmed) || htmlBlockStart.MatchString(trimmed) {
+		return true
+	}
+
+	if strings.HasPrefix(trimmed, ">") {
+		return true
+	}
+
+	if item := parseListMarker(line); item != nil && strings.TrimSpace(item.first) != "" {
+		return !item.ordered || item.start == 1
+	}
+
+	return false
+}
+
+// blocks renders block level elements. Paragraphs in tight lists are written
+// without <p> tags.
+func (r *renderer) blocks(lines []string, tight bool) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		if isBlank(line) {
+			i++
+			continue
+		}
+
+		trimmed := strings.TrimLeft(line, " ")
+
+		if indentOf(line) >= 4 {
+			i = r.indentedCode(lines, i)
+			continue
+		}
+
+		if m := codeFence.FindStringSubmatch(trimmed); m != nil {
+			i = r.fencedCode(lines, i, indentOf(line), m[1], m[2])
+			continue
+		}
+
+		if m := atxHeading.FindStringSubmatch(trimmed); m != nil {
+			fmt.Fprintf(&r.buf, "<h%d>", len(m[1]))
+			r.inline(strings.TrimSpace(m[2]))
+			fmt.Fprintf(&r.buf, "</h%d>\n", len(m[1]))
+			i++
+			continue
+		}
+
+		if thematicBreak.MatchString(trimmed) {
+			r.buf.WriteString("<hr>\n")
+			i++
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, ">") {
+			i = r.blockquote(lines, i)
+			continue
+		}
+
+		if item := parseListMarker(line); item != nil {
+			i = r.list(lines, i)
+			continue
+		}
+
+		if htmlBlockStart.MatchString(trimmed) {
+			for ; i < len(lines) && !isBlank(lines[i]); i++ {
+				r.buf.WriteString(lines[i])
+				r.buf.WriteByte('\n')
+			}
+			continue
+		}
+
+		if strings.Contains(line, "|") && i+1 < len(lines) && strings.Contains(lines[i+1], "-") && tableDelimiter.MatchString(strings.TrimSpace(lines[i+1])) {
+			i = r.table(lines, i)
+			continue
+		}
+
+		i = r.paragraph(lines, i, tight)
+	}
+}
+
+func (r *renderer) indentedCode(lines []string, i int) int {
+	code := []string{}
+	for ; i < len(lines) && (isBlank(lines[i]) || indentOf(lines[i]) >= 4); i++ {
+		code = append(code, dedent(lines[i], 4))
+	}
+
+	for len(code) > 0 && isBlank(code[len(code)-1]) {
+		code = code[:len(code)-1]
+	}
+
+	r.buf.WriteString("<pre><code>")
+	r.buf.WriteString(html.EscapeString(strings.Join(code, "\n")))
+	r.buf.WriteString("\n</code></pre>\n")
+	return i
+}
+
+func (r *renderer) fencedCode(lines []string, i, indent int, fence, info string) int {
+	code := []string{}
+	for i++; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" && indentOf(lines[i]) < 4 {
+			i++
+			break
+		}
+
+		code = append(code, dedent(lines[i], indent))
+	}
+
+	lang := strings.Fields(info)
+	if len(lang) > 0 {
+		fmt.Fprintf(&r.buf, `<pre><code class="language-%s">`, html.EscapeString(lang[0]))
+	} else {
+		r.buf.WriteString("<pre><code>")
+	}
+
+	if len(code) > 0 {
+		r.buf.WriteString(html.EscapeString(strings.Join(code, "\n")))
+		r.buf.WriteByte('\n')
+	}
+
+	r.buf.WriteString("</code></pre>\n")
+	return i
+}
+
+func (r *renderer) blockquote(lines []string, i int) int {
+	inner := []string{}
+	for ; i < len(lines); i++ {
+		trimmed := strings.TrimLeft(lines[i], " ")
+		if indentOf(lines[i]) < 4 && strings.HasPrefix(trimmed, ">") {
+			trimmed = trimmed[1:]
+			if strings.HasPrefix(trimmed, " ") {
+				trimmed = trimmed[1:]
+			}
+
+			inner = append(inner, trimmed)
+			continue
+		}
+
+		// Lazy continuation of a paragraph inside quote.
+		if isBlank(lines[i]) || len(inner) == 0 || isBlank(inner[len(inner)-1]) || startsBlock(lines[i]) {
+			break
+		}
+
+		inner = append(inner, lines[i])
+	}
+
+	r.buf.WriteString("<blockquote>\n")
+	r.blocks(inner, false)
+	r.buf.WriteString("</blockquote>\n")
+	return i
+}
+
+type listItem struct {
+	ordered bool
+	start   int
+	marker  byte
+	indent  int
+	first   string
+}
+
+// parseListMarker parses bullet or ordered list marker at start of line.
+func parseListMarker(line string) *listItem {
+	indent := indentOf(line)
+	if indent >= 4 {
+		return nil
+	}
+
+	rest := line[indent:]
+	item := &listItem{}
+
+	switch {
+	case len(rest) > 0 && (rest[0] == '-' || rest[0] == '*' || rest[0] == '+'):
+		item.marker = rest[0]
+		rest = rest[1:]
+		indent++
+	default:
+		digits := 0
+		for digits < len(rest) && digits < 9 && rest[digits] >= '0' && rest[digits] <= '9' {
+			digits++
+		}
+
+		if digits == 0 || digits >= len(rest) || (rest[digits] != '.' && rest[digits] != ')') {
+			return nil
+		}
+
+		item.ordered = true
+		item.start, _ = strconv.Atoi(rest[:digits])
+		item.marker = rest[digits]
+		rest = rest[digits+1:]
+		indent += digits + 1
+	}
+
+	if rest == "" || isBlank(rest) {
+		item.indent = indent + 1
+		return item
+	}
+
+	spaces := indentOf(rest)
+	if spaces == 0 {
+		return nil
+	}
+
+	if spaces > 4 {
+		spaces = 1
+	}
+
+	item.indent = indent + spaces
+	item.first = rest[spaces:]
+	return item
+}
+
+func (r *renderer) list(lines []string, i int) int {
+	head := parseListMarker(lines[i])
+	items := [][]string{}
+	loose := false
+
+	for i < len(lines) {
+		item := parseListMarker(lines[i])
+		if item == nil || item.ordered != head.ordered || item.marker != head.marker {
+			break
+		}
+
+		content := []string{item.first}
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			if isBlank(line) {
+				content = append(content, "")
+				continue
+			}
+
+			if indentOf(line) >= item.indent {
+				content = append(content, dedent(line, item.indent))
+				continue
+			}
+
+			// Lazy continuation line of the last paragraph.
+			if !isBlank(content[len(content)-1]) && !startsBlock(line) && parseListMarker(line) == nil {
+				content = append(content, strings.TrimLeft(line, " "))
+				continue
+			}
+
+			break
+		}
+
+		// Trailing blank lines separate items, so the list is loose if
+		// another item follows them.
+		trailing := 0
+		for len(content) > 1 && isBlank(content[len(content)-1]) {
+			content = content[:len(content)-1]
+			trailing++
+		}
+
+		for j := 1; j < len(content); j++ {
+			if isBlank(content[j]) {
+				loose = true
+			}
+		}
+
+		items = append(items, content)
+
+		if trailing > 0 && i < len(lines) {
+			if next := parseListMarker(lines[i]); next != nil && next.ordered == head.ordered && next.marker == head.marker {
+				loose = true
+			}
+		}
+	}
+
+	switch {
+	case !head.ordered:
+		r.buf.WriteString("<ul>\n")
+	case head.start != 1:
+		fmt.Fprintf(&r.buf, "<ol start=\"%d\">\n", head.start)
+	default:
+		r.buf.WriteString("<ol>\n")
+	}
+
+	for _, content := range items {
+		if m := taskMarker.FindStringSubmatch(content[0]); m != nil {
+			r.buf.WriteString(`<li class="task"><input type="checkbox" disabled`)
+			if m[1] != " " {
+				r.buf.WriteString(" checked")
+			}
+
+			r.buf.WriteString("> ")
+			content[0] = content[0][len(m[0]):]
+		} else {
+			r.buf.WriteString("<li>")
+		}
+
+		r.blocks(content, !loose)
+		r.buf.WriteString("</li>\n")
+	}
+
+	if head.ordered {
+		r.buf.WriteString("</ol>\n")
+	} else {
+		r.buf.WriteString("</ul>\n")
+	}
+
+	return i
+}
+
+// splitRow splits a table row into cells. Escaped pipes are kept in cells.
+func splitRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, "\\|") {
+		line = line[:len(line)-1]
+	}
+
+	cells := []string{}
+	start := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '|':
+			cells = append(cells, strings.TrimSpace(line[start:i]))
+			start = i + 1
+		}
+	}
+
+	cells = append(cells, strings.TrimSpace(line[start:]))
+	for i, cell := range cells {
+		cells[i] = strings.Replace(cell, "\\|", "|", -1)
+	}
+
+	return cells
+}
+
+func (r *renderer) table(lines []string, i int) int {
+	header := splitRow(lines[i])
+
+	aligns := []string{}
+	for _, cell := range splitRow(lines[i+1]) {
+		left, right := strings.HasPrefix(cell, ":"), strings.HasSuffix(cell, ":")
+		switch {
+		case left && right:
+			aligns = append(aligns, "center")
+		case right:
+			aligns = append(aligns, "right")
+		case left:
+			aligns = append(aligns, "left")
+		default:
+			aligns = append(aligns, "")
+		}
+	}
+
+	row := func(tag string, cells []string) {
+		r.buf.WriteString("<tr>")
+		for j := range header {
+			if j < len(aligns) && aligns[j] != "" {
+				fmt.Fprintf(&r.buf, `<%s align="%s">`, tag, aligns[j])
+			} else {
+				fmt.Fprintf(&r.buf, "<%s>", tag)
+			}
+
+			if j < len(cells) {
+				r.inline(cells[j])
+			}
+
+			fmt.Fprintf(&r.buf, "</%s>", tag)
+		}
+		r.buf.WriteString("</tr>\n")
+	}
+
+	r.buf.WriteString("<table>\n<thead>\n")
+	row("th", header)
+	r.buf.WriteString("</thead>\n<tbody>\n")
+
+	for i += 2; i < len(lines) && !isBlank(lines[i]) && !startsBlock(lines[i]); i++ {
+		row("td", splitRow(lines[i]))
+	}
+
+	r.buf.WriteString("</tbody>\n</table>\n")
+	return i
+}
+
+func (r *renderer) paragraph(lines []string, i int, tight bool) int {
+	text := []string{}
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if isBlank(line) {
+			break
+		}
+
+		if len(text) > 0 {
+			if setextUnder.MatchString(strings.TrimSpace(line)) && indentOf(line) < 4 {
+				level := 1
+				if strings.TrimSpace(line)[0] == '-' {
+					level = 2
+				}
+
+				fmt.Fprintf(&r.buf, "<h%d>", level)
+				r.inline(strings.Join(text, "\n"))
+				fmt.Fprintf(&r.buf, "</h%d>\n", level)
+				return i + 1
+			}
+
+			if startsBlock(line) {
+				break
+			}
+		}
+
+		text = append(text, strings.TrimLeft(line, " "))
+	}
+
+	// Two trailing spaces make a hard line break.
+	for j := 0; j < len(text)-1; j++ {
+		if strings.HasSuffix(text[j], "  ") {
+			text[j] = strings.TrimRight(text[j], " ") + "\\"
+		} else {
+			text[j] = strings.TrimRight(text[j], " ")
+		}
+	}
+
+	content := strings.TrimRight(strings.Join(text, "\n"), " ")
+	if tight {
+		r.inline(content)
+		r.buf.WriteByte('\n')
+	} else {
+		r.buf.WriteString("<p>")
+		r.inline(content)
+		r.buf.WriteString("</p>\n")
+	}
+
+	return i
+}
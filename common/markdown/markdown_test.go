@@ -0,0 +1,75 @@
+package markdown
+
+import "testing"
+
+func TestRender(t *testing.T) {
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"# Title\n\n**b** _i_ ~~s~~ `c`", "<h1>Title</h1>\n<p><strong>b</strong> <em>i</em> <del>s</del> <code>c</code></p>\n"},
+		{"- [x] done\n- [ ] todo", "<ul>\n<li class=\"task\"><input type=\"checkbox\" checked disabled> done\n</li>\n<li class=\"task\"><input type=\"checkbox\" disabled> todo\n</li>\n</ul>\n"},
+		{"| a | b |\n|---|:-:|\n| 1 | 2 |", "<table>\n<thead>\n<tr><th>a</th><th align=\"center\">b</th></tr>\n</thead>\n<tbody>\n<tr><td>1</td><td align=\"center\">2</td></tr>\n</tbody>\n</table>\n"},
+		{"```go\n<b>\n```", "<pre><code class=\"language-go\">&lt;b&gt;\n</code></pre>\n"},
+		{"see https://example.com/a.", "<p>see <a href=\"https://example.com/a\">https://example.com/a</a>.</p>\n"},
+	}
+
+	for _, c := range cases {
+		if got := Render(c.src, nil); got != c.want {
+			t.Errorf("Render(%q) = %q, want %q", c.src, got, c.want)
+		}
+	}
+}
+
+func TestRenderUnsafe(t *testing.T) {
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"[x](javascript:alert(1))", "<p><a>x</a></p>\n"},
+		{"![x](javascript:alert(1))", "<p><img alt=\"x\"></p>\n"},
+		{"<javascript:alert(1)>", "<p><a>javascript:alert(1)</a></p>\n"},
+		{"![x](data:image/png;base64,AAAA)", "<p><img src=\"data:image/png;base64,AAAA\" alt=\"x\"></p>\n"},
+		{"[x](data:image/png;base64,AAAA)", "<p><a>x</a></p>\n"},
+		{"x <b onclick=\"y\">z</b>", "<p>x <b>z</b></p>\n"},
+		{"<script>alert(1)</script>", "\n"},
+		{"x <svg><script>alert(1)</script></svg>", "<p>x </p>\n"},
+	}
+
+	for _, c := range cases {
+		if got := Render(c.src, nil); got != c.want {
+			t.Errorf("Render(%q) = %q, want %q", c.src, got, c.want)
+		}
+	}
+}
+
+func TestRenderOptions(t *testing.T) {
+	opts := &Options{
+		Link: func(href string) (string, string) {
+			if href == "task:12" {
+				return "/?task=12", "#12 Login"
+			}
+
+			return href, ""
+		},
+		Image: func(src string) string {
+			return "https://cdn.example.com" + src
+		},
+	}
+
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"[](task:12)", "<p><a href=\"/?task=12\">#12 Login</a></p>\n"},
+		{"[see](task:12)", "<p><a href=\"/?task=12\">see</a></p>\n"},
+		{"[x](javascript:alert(1))", "<p><a>x</a></p>\n"},
+		{"![a](/uploads/a.png)", "<p><img src=\"https://cdn.example.com/uploads/a.png\" alt=\"a\"></p>\n"},
+	}
+
+	for _, c := range cases {
+		if got := Render(c.src, opts); got != c.want {
+			t.Errorf("Render(%q) = %q, want %q", c.src, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Allowed tags and their attributes. Attribute "class" is allowed on all tags.
+var allowedTags = map[string][]string{
+	"a":          {"href", "title"},
+	"abbr":       {"title"},
+	"b":          {},
+	"blockquote": {},
+	"br":         {},
+	"caption":    {},
+	"code":       {},
+	"dd":         {},
+	"del":        {},
+	"details":    {"open"},
+	"div":        {},
+	"dl":         {},
+	"dt":         {},
+	"em":         {},
+	"h1":         {},
+	"h2":         {},
+	"h3":         {},
+	"h4":         {},
+	"h5":         {},
+	"h6":         {},
+	"hr":         {},
+	"i":          {},
+	"img":        {"src", "alt", "title", "width", "height"},
+	"input":      {"type", "checked", "disabled"},
+	"ins":        {},
+	"kbd":        {},
+	"li":         {},
+	"mark":       {},
+	"ol":         {"start"},
+	"p":          {},
+	"pre":        {},
+	"s":          {},
+	"small":      {},
+	"span":       {},
+	"strong":     {},
+	"sub":        {},
+	"summary":    {},
+	"sup":        {},
+	"table":      {},
+	"tbody":      {},
+	"td":         {"align", "colspan", "rowspan"},
+	"tfoot":      {},
+	"th":         {"align", "colspan", "rowspan"},
+	"thead":      {},
+	"tr":         {},
+	"u":          {},
+	"ul":         {},
+}
+
+// Attributes whose presence means true.
+var booleanAttrs = map[string]bool{"checked": true, "disabled": true, "open": true}
+
+// Tags without closing tag.
+var voidTags = map[string]bool{"br": true, "hr": true, "img": true, "input": true}
+
+// Tags removed together with their content.
+var droppedTags = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"iframe":   true,
+	"object":   true,
+	"embed":    true,
+	"textarea": true,
+	"title":    true,
+	"noscript": true,
+	"template": true,
+	"svg":      true,
+	"math":     true,
+	"xmp":      true,
+	"noembed":  true,
+	"noframes": true,
+}
+
+var dataImage = regexp.MustCompile(`^data:image/(?:png|jpeg|gif|webp|bmp);base64,[a-z0-9+/=]*$`)
+
+type tag struct {
+	name      string
+	closing   bool
+	attrNames []string
+	attrs     map[string]string
+}
+
+// Sanitize removes tags, attributes and URLs that are not in white list from
+// given HTML. Unclosed tags are closed at the end.
+func Sanitize(src string) string {
+	var buf strings.Builder
+	opened := []string{}
+
+	for i := 0; i < len(src); {
+		lt := strings.IndexByte(src[i:], '<')
+		if lt < 0 {
+			writeText(&buf, src[i:])
+			break
+		}
+
+		writeText(&buf, src[i:i+lt])
+		i += lt
+		rest := src[i:]
+
+		if strings.HasPrefix(rest, "<!--") {
+			end := strings.Index(rest[4:], "-->")
+			if end < 0 {
+				break
+			}
+
+			i += end + 7
+			continue
+		}
+
+		if strings.HasPrefix(rest, "<!") || strings.HasPrefix(rest, "<?") {
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				break
+			}
+
+			i += end + 1
+			continue
+		}
+
+		t, n := parseTag(rest)
+		if t == nil {
+			buf.WriteString("&lt;")
+			i++
+			continue
+		}
+
+		i += n
+
+		if droppedTags[t.name] {
+			if !t.closing {
+				end := strings.Index(strings.ToLower(src[i:]), "</"+t.name)
+				if end < 0 {
+					break
+				}
+
+				i += end
+				if gt := strings.IndexByte(src[i:], '>'); gt >= 0 {
+					i += gt + 1
+				} else {
+					break
+				}
+			}
+
+			continue
+		}
+
+		allowed, ok := allowedTags[t.name]
+		if !ok {
+			continue
+		}
+
+		if t.closing {
+			for j := len(opened) - 1; j >= 0; j-- {
+				if opened[j] == t.name {
+					for k := len(opened) - 1; k >= j; k-- {
+						buf.WriteString("</" + opened[k] + ">")
+					}
+
+					opened = opened[:j]
+					break
+				}
+			}
+
+			continue
+		}
+
+		if t.name == "input" && strings.ToLower(t.attrs["type"]) != "checkbox" {
+			continue
+		}
+
+		buf.WriteString("<" + t.name)
+		for _, name := range t.attrNames {
+			if name != "class" && !contains(allowed, name) {
+				continue
+			}
+
+			value := t.attrs[name]
+			switch {
+			case (name == "href" || name == "src") && !isSafeURL(value, t.name == "img"):
+			case booleanAttrs[name]:
+				if t.name != "input" || name != "disabled" {
+					buf.WriteString(" " + name)
+				}
+			default:
+				buf.WriteString(" " + name + `="` + html.EscapeString(value) + `"`)
+			}
+		}
+
+		if t.name == "input" {
+			buf.WriteString(` disabled`)
+		}
+
+		buf.WriteString(">")
+
+		if !voidTags[t.name] {
+			opened = append(opened, t.name)
+		}
+	}
+
+	for j := len(opened) - 1; j >= 0; j-- {
+		buf.WriteString("</" + opened[j] + ">")
+	}
+
+	return buf.String()
+}
+
+// writeText normalizes entities of text between tags.
+func writeText(buf *strings.Builder, text string) {
+	buf.WriteString(html.EscapeString(html.UnescapeString(text)))
+}
+
+func contains(list []string, s string) bool {
+	for _, one := range list {
+		if one == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseTag parses a start or end tag at beginning of s. Returns nil if s does
+// not start with a valid tag.
+func parseTag(s string) (*tag, int) {
+	t := &tag{attrs: map[string]string{}}
+	i := 1
+
+	if i < len(s) && s[i] == '/' {
+		t.closing = true
+		i++
+	}
+
+	start := i
+	for i < len(s) && (isAlnum(s[i]) || s[i] == '-') && s[i] < 0x80 {
+		i++
+	}
+
+	if i == start || !((s[start] >= 'a' && s[start] <= 'z') || (s[start] >= 'A' && s[start] <= 'Z')) {
+		return nil, 0
+	}
+
+	t.name = strings.ToLower(s[start:i])
+
+	for {
+		for i < len(s) && (isSpace(s[i]) || s[i] == '\r' || s[i] == '\f' || s[i] == '/') {
+			i++
+		}
+
+		if i >= len(s) {
+			return nil, 0
+		}
+
+		if s[i] == '>' {
+			return t, i + 1
+		}
+
+		start = i
+		for i < len(s) && !isSpace(s[i]) && s[i] != '=' && s[i] != '>' && s[i] != '/' {
+			i++
+		}
+
+		name := strings.ToLower(s[start:i])
+		value := ""
+
+		j := i
+		for j < len(s) && isSpace(s[j]) {
+			j++
+		}
+
+		if j < len(s) && s[j] == '=' {
+			i = j + 1
+			for i < len(s) && isSpace(s[i]) {
+				i++
+			}
+
+			if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+				end := strings.IndexByte(s[i+1:], s[i])
+				if end < 0 {
+					return nil, 0
+				}
+
+				value = s[i+1 : i+1+end]
+				i += end + 2
+			} else {
+				start = i
+				for i < len(s) && !isSpace(s[i]) && s[i] != '>' {
+					i++
+				}
+
+				value = s[start:i]
+			}
+		}
+
+		if _, exists := t.attrs[name]; !exists && name != "" {
+			t.attrNames = append(t.attrNames, name)
+			t.attrs[name] = html.UnescapeString(value)
+		}
+	}
+}
+
+// isSafeURL tests if URL is relative or uses a safe scheme.
+func isSafeURL(u string, image bool) bool {
+	// Browsers ignore control characters and spaces in scheme.
+	clean := strings.ToLower(strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+
+		return r
+	}, u))
+
+	colon := strings.IndexByte(clean, ':')
+	if colon < 0 || strings.ContainsAny(clean[:colon], "/?#") {
+		return true
+	}
+
+	switch clean[:colon] {
+	case "http", "https", "mailto", "tel":
+		return true
+	case "data":
+		return image && dataImage.MatchString(clean)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,112 @@
+package markdown
+
+import "testing"
+
+func TestSanitizeURL(t *testing.T) {
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{`<a href="javascript:alert(1)">x</a>`, `<a>x</a>`},
+		{`<a href="JavaScript:alert(1)">x</a>`, `<a>x</a>`},
+		{`<a href="vbscript:alert(1)">x</a>`, `<a>x</a>`},
+		{`<a href="&#106;avascript:alert(1)">x</a>`, `<a>x</a>`},
+		{`<a href="&#x6A;avascript:alert(1)">x</a>`, `<a>x</a>`},
+		{`<a href="java&#10;script:alert(1)">x</a>`, `<a>x</a>`},
+		{"<a href=\"java\tscript:alert(1)\">x</a>", `<a>x</a>`},
+		{"<a href=\" \x01javascript:alert(1)\">x</a>", `<a>x</a>`},
+		{`<a href="data:image/png;base64,AAAA">x</a>`, `<a>x</a>`},
+		{`<a href="https://example.com/?a=1&amp;b=2" title="t">x</a>`, `<a href="https://example.com/?a=1&amp;b=2" title="t">x</a>`},
+		{`<a href="mailto:a@example.com">x</a>`, `<a href="mailto:a@example.com">x</a>`},
+		{`<a href="/?task=1">x</a>`, `<a href="/?task=1">x</a>`},
+		{`<a href="#top">x</a>`, `<a href="#top">x</a>`},
+	}
+
+	for _, c := range cases {
+		if got := Sanitize(c.src); got != c.want {
+			t.Errorf("Sanitize(%q) = %q, want %q", c.src, got, c.want)
+		}
+	}
+}
+
+func TestSanitizeImage(t *testing.T) {
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{`<img src="data:image/png;base64,iVBORw0KGgo=" alt="a">`, `<img src="data:image/png;base64,iVBORw0KGgo=" alt="a">`},
+		{`<img src="data:image/jpeg;base64,/9j/4AAQ">`, `<img src="data:image/jpeg;base64,/9j/4AAQ">`},
+		{`<img src="data:image/svg+xml;base64,PHN2Zz4=">`, `<img>`},
+		{`<img src="data:text/html;base64,PHNjcmlwdD4=">`, `<img>`},
+		{`<img src="data:image/png,raw">`, `<img>`},
+		{`<img src="javascript:alert(1)">`, `<img>`},
+		{`<img src="/uploads/a.png" width="10" height="20">`, `<img src="/uploads/a.png" width="10" height="20">`},
+	}
+
+	for _, c := range cases {
+		if got := Sanitize(c.src); got != c.want {
+			t.Errorf("Sanitize(%q) = %q, want %q", c.src, got, c.want)
+		}
+	}
+}
+
+func TestSanitizeAttributes(t *testing.T) {
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{`<img src="x" onerror="alert(1)">`, `<img src="x">`},
+		{`<a href="#" onclick="alert(1)" ONMOUSEOVER=alert(1)>x</a>`, `<a href="#">x</a>`},
+		{`<p style="color:red" class="note">x</p>`, `<p class="note">x</p>`},
+		{`<td align="left" colspan="2" bgcolor="red">x</td>`, `<td align="left" colspan="2">x</td>`},
+		{`<input type="checkbox" checked>`, `<input type="checkbox" checked disabled>`},
+		{`<input type="text" value="x">`, ``},
+	}
+
+	for _, c := range cases {
+		if got := Sanitize(c.src); got != c.want {
+			t.Errorf("Sanitize(%q) = %q, want %q", c.src, got, c.want)
+		}
+	}
+}
+
+func TestSanitizeTags(t *testing.T) {
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{`<script>alert(1)</script>ok`, `ok`},
+		{`<SCRIPT>alert(1)</SCRIPT>ok`, `ok`},
+		{`<svg onload="alert(1)"><circle/></svg>ok`, `ok`},
+		{`<style>body{display:none}</style>ok`, `ok`},
+		{`<iframe src="https://example.com"></iframe>ok`, `ok`},
+		{`<script>never closed`, ``},
+		{`<blink>x</blink>`, `x`},
+		{`<!-- comment -->ok`, `ok`},
+		{`a < b & c`, `a &lt; b &amp; c`},
+	}
+
+	for _, c := range cases {
+		if got := Sanitize(c.src); got != c.want {
+			t.Errorf("Sanitize(%q) = %q, want %q", c.src, got, c.want)
+		}
+	}
+}
+
+func TestSanitizeUnclosed(t *testing.T) {
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{`<b>bold`, `<b>bold</b>`},
+		{`<ul><li>one`, `<ul><li>one</li></ul>`},
+		{`<b><i>x</b>`, `<b><i>x</i></b>`},
+		{`</div>stray`, `stray`},
+	}
+
+	for _, c := range cases {
+		if got := Sanitize(c.src); got != c.want {
+			t.Errorf("Sanitize(%q) = %q, want %q", c.src, got, c.want)
+		}
+	}
+}
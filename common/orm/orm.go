@@ -27,6 +27,8 @@ var (
 	ErrUnsupportType = errors.New("UNSUPPORT TYPE")
 	// ErrBadParam means parameter is in bad format.
 	ErrBadParam = errors.New("BAD PARAMETER")
+	// ErrStale means record has been modified since it was read.
+	ErrStale = errors.New("STALE RECORD")
 )
 
 var db *sql.DB
@@ -80,6 +82,9 @@ func OpenDB(driver, addr string) error {
 //     Tags 	[]string
 //     UserData *OtherType
 //
+//     // Field with 'index' keyword will be indexed
+//     Group string `orm:"type=VARCHAR(32),index"`
+//
 //     // Field do NOT want to generated columns in table must has tag : `orm:"-"`
 //     SomeRuntimeData int32 `orm:"-"`
 // }
@@ -111,24 +116,16 @@ func CreateTable(v interface{}) error {
 	fields := []string{}
 	hasID := false
 
-	for i := 0; i < dt.NumField(); i++ {
-		fv := de.Field(i)
-		if !fv.IsValid() || !fv.CanSet() {
-			continue
-		}
+	indexes := []string{}
 
-		ft := dt.Field(i)
-		name := strings.ToLower(ft.Name)
-		if name == "id" {
-			fields = append(fields, "`id` BIGINT NOT NULL PRIMARY KEY "+AutoIncrementKeyword)
+	for _, col := range columns(de) {
+		if col.name == "id" {
 			hasID = true
-		} else {
-			tag := ft.Tag.Get("orm")
-			if tag == "-" {
-				continue
-			}
+		}
 
-			fields = append(fields, fmt.Sprintf("`%s` %s", name, makeFiledDesc(fv, tag)))
+		fields = append(fields, fmt.Sprintf("`%s` %s", col.name, col.desc))
+		if col.index {
+			indexes = append(indexes, fmt.Sprintf("INDEX `idx_%s` (`%s`)", col.name, col.name))
 		}
 	}
 
@@ -140,6 +137,8 @@ func CreateTable(v interface{}) error {
 		fields = append(fields, "`id` BIGINT NOT NULL PRIMARY KEY "+AutoIncrementKeyword)
 	}
 
+	fields = append(fields, indexes...)
+
 	builder.WriteString(strings.Join(fields, ",\n"))
 	builder.WriteString(") DEFAULT CHARSET utf8;")
 
@@ -147,6 +146,57 @@ func CreateTable(v interface{}) error {
 	return err
 }
 
+// SyncTable makes sure table of given value type exists and has all columns
+// declared in struct. Missing columns will be appended by `ALTER TABLE`, but
+// existing columns will NEVER be modified or dropped.
+func SyncTable(v interface{}) error {
+	if err := CreateTable(v); err != nil {
+		return err
+	}
+
+	de := reflect.ValueOf(v).Elem()
+	table := strings.ToLower(de.Type().Name())
+
+	rows, err := Query(
+		"SELECT LOWER(`column_name`) FROM `information_schema`.`columns` WHERE `table_schema`=DATABASE() AND `table_name`=?",
+		table)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	exists := map[string]bool{}
+	for rows.Next() {
+		name := ""
+		if err = rows.Scan(&name); err != nil {
+			return err
+		}
+
+		exists[name] = true
+	}
+
+	for _, col := range columns(de) {
+		if exists[col.name] {
+			continue
+		}
+
+		_, err = Exec(fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` %s", table, col.name, col.desc))
+		if err != nil {
+			return err
+		}
+
+		if col.index {
+			_, err = Exec(fmt.Sprintf("ALTER TABLE `%s` ADD INDEX `idx_%s` (`%s`)", table, col.name, col.name))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 // Exec SQL without results like DELETE/UPDATE/INSERT
 func Exec(sql string, args ...interface{}) (sql.Result, error) {
 	if db == nil {
@@ -203,17 +253,70 @@ func Scan(rows *sql.Rows, v interface{}) error {
 	return nil
 }
 
+// Tx is an in-progress database transaction.
+type Tx struct {
+	tx *sql.Tx
+}
+
+// Begin starts a transaction.
+func Begin() (*Tx, error) {
+	if db == nil {
+		return nil, fmt.Errorf("orm.Begin on invalid connection")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tx{tx: tx}, nil
+}
+
+// Exec SQL in this transaction.
+func (t *Tx) Exec(sql string, args ...interface{}) (sql.Result, error) {
+	return t.tx.Exec(sql, args...)
+}
+
+// Insert data into database in this transaction.
+func (t *Tx) Insert(v interface{}) (sql.Result, error) {
+	query, vals, err := insertSQL(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.tx.Exec(query, vals...)
+}
+
+// Commit this transaction.
+func (t *Tx) Commit() error {
+	return t.tx.Commit()
+}
+
+// Rollback this transaction.
+func (t *Tx) Rollback() error {
+	return t.tx.Rollback()
+}
+
 // Insert data into database.
 func Insert(v interface{}) (sql.Result, error) {
+	query, vals, err := insertSQL(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return Exec(query, vals...)
+}
+
+func insertSQL(v interface{}) (string, []interface{}, error) {
 	rv := reflect.ValueOf(v)
 	if rv.Kind() != reflect.Ptr || rv.IsNil() {
-		return nil, ErrUnsupportType
+		return "", nil, ErrUnsupportType
 	}
 
 	de := rv.Elem()
 	dt := de.Type()
 	if de.Kind() != reflect.Struct {
-		return nil, ErrUnsupportType
+		return "", nil, ErrUnsupportType
 	}
 
 	var builder strings.Builder
@@ -241,7 +344,7 @@ func Insert(v interface{}) (sql.Result, error) {
 
 		val, err := serialize(fv)
 		if err != nil {
-			return nil, err
+			return "", nil, err
 		}
 
 		keys = append(keys, "`"+name+"`")
@@ -250,7 +353,7 @@ func Insert(v interface{}) (sql.Result, error) {
 	}
 
 	if len(keys) == 0 {
-		return nil, fmt.Errorf("orm.Insert No valid fields found in record: %+v", v)
+		return "", nil, fmt.Errorf("orm.Insert No valid fields found in record: %+v", v)
 	}
 
 	builder.WriteString(strings.Join(keys, ","))
@@ -258,7 +361,7 @@ func Insert(v interface{}) (sql.Result, error) {
 	builder.WriteString(strings.Join(holders, ","))
 	builder.WriteString(");")
 
-	return Exec(builder.String(), vals...)
+	return builder.String(), vals, nil
 }
 
 // Read one record from database
@@ -324,7 +427,9 @@ func Read(v interface{}, cols ...string) error {
 	return Scan(rows, v)
 }
 
-// Update one record from database
+// Update one record from database. Field tagged with `version` works as an
+// optimistic lock: record is only updated when its version is unchanged,
+// otherwise ErrStale is returned.
 func Update(v interface{}) error {
 	rv := reflect.ValueOf(v)
 	if rv.Kind() != reflect.Ptr || rv.IsNil() {
@@ -346,6 +451,7 @@ func Update(v interface{}) error {
 	id := int64(-1)
 	keys := []string{}
 	vals := []interface{}{}
+	version := -1
 
 	for i := 0; i < dt.NumField(); i++ {
 		ft := dt.Field(i)
@@ -362,6 +468,9 @@ func Update(v interface{}) error {
 
 		if name == "id" {
 			id = fv.Int()
+		} else if hasOption(tag, "version") {
+			version = i
+			keys = append(keys, "`"+name+"`=`"+name+"`+1")
 		} else {
 			val, err := serialize(fv)
 			if err != nil {
@@ -380,20 +489,80 @@ func Update(v interface{}) error {
 	builder.WriteString(strings.Join(keys, ","))
 	builder.WriteString(fmt.Sprintf(" WHERE `id`=%d", id))
 
-	_, err := Exec(builder.String(), vals...)
+	if version < 0 {
+		_, err := Exec(builder.String(), vals...)
+		return err
+	}
+
+	// Optimistic lock: only update when version is unchanged since read.
+	fv := de.Field(version)
+	builder.WriteString(" AND `" + strings.ToLower(dt.Field(version).Name) + "`=?")
+	vals = append(vals, fv.Int())
+
+	rs, err := Exec(builder.String(), vals...)
 	if err != nil {
 		return err
 	}
 
+	if affected, err := rs.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrStale
+	}
+
+	fv.SetInt(fv.Int() + 1)
 	return nil
 }
 
+func hasOption(tag, option string) bool {
+	for _, opt := range strings.Split(tag, ",") {
+		if strings.TrimSpace(opt) == option {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Delete a record from data by ID
 func Delete(table string, id int64) error {
 	_, err := Exec("DELETE FROM `"+table+"` WHERE `id`=?", id)
 	return err
 }
 
+type column struct {
+	name  string
+	desc  string
+	index bool
+}
+
+func columns(de reflect.Value) []column {
+	dt := de.Type()
+	cols := []column{}
+
+	for i := 0; i < dt.NumField(); i++ {
+		fv := de.Field(i)
+		if !fv.IsValid() || !fv.CanSet() {
+			continue
+		}
+
+		ft := dt.Field(i)
+		name := strings.ToLower(ft.Name)
+		if name == "id" {
+			cols = append(cols, column{name: name, desc: "BIGINT NOT NULL PRIMARY KEY " + AutoIncrementKeyword})
+		} else {
+			tag := ft.Tag.Get("orm")
+			if tag == "-" {
+				continue
+			}
+
+			cols = append(cols, column{name: name, desc: makeFiledDesc(fv, tag), index: hasOption(tag, "index")})
+		}
+	}
+
+	return cols
+}
+
 func makeFiledDesc(fv reflect.Value, tag string) string {
 	opts := strings.Split(tag, ",")
 	isUnique := false
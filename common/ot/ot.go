@@ -0,0 +1,317 @@
+// Package ot implements operational transformation for plain text.
+//
+// An operation is a list of components walking through the whole document:
+// a positive integer retains that many characters, a negative integer
+// deletes that many characters and a string inserts itself. Lengths are
+// counted in unicode code points. The JSON form is a plain array, for
+// example [3, "abc", -2, 5].
+package ot
+
+import (
+	"encoding/json"
+	"errors"
+	"unicode/utf8"
+)
+
+var (
+	// ErrBadOperation means operation is in bad format.
+	ErrBadOperation = errors.New("无效的编辑操作")
+	// ErrLengthMismatch means operation can NOT be applied to the document.
+	ErrLengthMismatch = errors.New("编辑操作与文档长度不匹配")
+)
+
+type (
+	// Component is a single step of an operation. Only one field is used.
+	Component struct {
+		Retain int
+		Delete int
+		Insert string
+	}
+
+	// Operation is a sequence of components.
+	Operation []Component
+)
+
+// Retain appends retain component to this operation.
+func (o Operation) Retain(n int) Operation {
+	if n <= 0 {
+		return o
+	}
+
+	if last := len(o) - 1; last >= 0 && o[last].Retain > 0 {
+		o[last].Retain += n
+		return o
+	}
+
+	return append(o, Component{Retain: n})
+}
+
+// Insert appends insert component to this operation. Insert is always put
+// before delete at the same position to keep operations canonical.
+func (o Operation) Insert(s string) Operation {
+	if s == "" {
+		return o
+	}
+
+	last := len(o) - 1
+	if last >= 0 && o[last].Insert != "" {
+		o[last].Insert += s
+		return o
+	}
+
+	if last >= 0 && o[last].Delete > 0 {
+		if last > 0 && o[last-1].Insert != "" {
+			o[last-1].Insert += s
+			return o
+		}
+
+		o = append(o, o[last])
+		o[last] = Component{Insert: s}
+		return o
+	}
+
+	return append(o, Component{Insert: s})
+}
+
+// Delete appends delete component to this operation.
+func (o Operation) Delete(n int) Operation {
+	if n <= 0 {
+		return o
+	}
+
+	if last := len(o) - 1; last >= 0 && o[last].Delete > 0 {
+		o[last].Delete += n
+		return o
+	}
+
+	return append(o, Component{Delete: n})
+}
+
+// BaseLen returns length of document this operation can be applied to.
+func (o Operation) BaseLen() int {
+	n := 0
+	for _, c := range o {
+		n += c.Retain + c.Delete
+	}
+
+	return n
+}
+
+// TargetLen returns length of document after this operation is applied.
+func (o Operation) TargetLen() int {
+	n := 0
+	for _, c := range o {
+		n += c.Retain + utf8.RuneCountInString(c.Insert)
+	}
+
+	return n
+}
+
+// IsNoop tests if this operation changes nothing.
+func (o Operation) IsNoop() bool {
+	for _, c := range o {
+		if c.Retain == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Apply this operation to given document.
+func (o Operation) Apply(doc string) (string, error) {
+	runes := []rune(doc)
+	if o.BaseLen() != len(runes) {
+		return "", ErrLengthMismatch
+	}
+
+	out := make([]rune, 0, o.TargetLen())
+	pos := 0
+
+	for _, c := range o {
+		switch {
+		case c.Retain > 0:
+			out = append(out, runes[pos:pos+c.Retain]...)
+			pos += c.Retain
+		case c.Delete > 0:
+			pos += c.Delete
+		default:
+			out = append(out, []rune(c.Insert)...)
+		}
+	}
+
+	return string(out), nil
+}
+
+// TransformIndex moves a cursor position through this operation. Text
+// inserted right at the cursor is put before it.
+func (o Operation) TransformIndex(index int) int {
+	pos := 0
+	moved := index
+
+	for _, c := range o {
+		if pos > index {
+			break
+		}
+
+		switch {
+		case c.Retain > 0:
+			pos += c.Retain
+		case c.Delete > 0:
+			if d := index - pos; d < c.Delete {
+				moved -= d
+			} else {
+				moved -= c.Delete
+			}
+			pos += c.Delete
+		default:
+			moved += utf8.RuneCountInString(c.Insert)
+		}
+	}
+
+	return moved
+}
+
+// Transform two concurrent operations a and b which are applied to the same
+// document. Returns a' and b' so that apply(apply(doc, a), b') equals to
+// apply(apply(doc, b), a'). Inserts of a go first at the same position.
+func Transform(a, b Operation) (Operation, Operation, error) {
+	if a.BaseLen() != b.BaseLen() {
+		return nil, nil, ErrLengthMismatch
+	}
+
+	ap, bp := Operation{}, Operation{}
+	ia, ib := newIterator(a), newIterator(b)
+
+	for !ia.done() || !ib.done() {
+		if ins := ia.peek().Insert; ins != "" {
+			ap = ap.Insert(ins)
+			bp = bp.Retain(utf8.RuneCountInString(ins))
+			ia.next(0)
+			continue
+		}
+
+		if ins := ib.peek().Insert; ins != "" {
+			ap = ap.Retain(utf8.RuneCountInString(ins))
+			bp = bp.Insert(ins)
+			ib.next(0)
+			continue
+		}
+
+		if ia.done() || ib.done() {
+			return nil, nil, ErrBadOperation
+		}
+
+		ca, cb := ia.peek(), ib.peek()
+		n := ia.remain()
+		if m := ib.remain(); m < n {
+			n = m
+		}
+
+		switch {
+		case ca.Retain > 0 && cb.Retain > 0:
+			ap = ap.Retain(n)
+			bp = bp.Retain(n)
+		case ca.Delete > 0 && cb.Retain > 0:
+			ap = ap.Delete(n)
+		case ca.Retain > 0 && cb.Delete > 0:
+			bp = bp.Delete(n)
+		}
+
+		ia.next(n)
+		ib.next(n)
+	}
+
+	return ap, bp, nil
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (o Operation) MarshalJSON() ([]byte, error) {
+	list := make([]interface{}, 0, len(o))
+	for _, c := range o {
+		switch {
+		case c.Retain > 0:
+			list = append(list, c.Retain)
+		case c.Delete > 0:
+			list = append(list, -c.Delete)
+		default:
+			list = append(list, c.Insert)
+		}
+	}
+
+	return json.Marshal(list)
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (o *Operation) UnmarshalJSON(data []byte) error {
+	raw := []interface{}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	op := Operation{}
+	for _, one := range raw {
+		switch v := one.(type) {
+		case float64:
+			n := int(v)
+			if float64(n) != v || n == 0 {
+				return ErrBadOperation
+			} else if n > 0 {
+				op = op.Retain(n)
+			} else {
+				op = op.Delete(-n)
+			}
+		case string:
+			if v == "" {
+				return ErrBadOperation
+			}
+			op = op.Insert(v)
+		default:
+			return ErrBadOperation
+		}
+	}
+
+	*o = op
+	return nil
+}
+
+// iterator walks through an operation, allows consuming components partly.
+type iterator struct {
+	op     Operation
+	index  int
+	offset int
+}
+
+func newIterator(op Operation) *iterator {
+	return &iterator{op: op}
+}
+
+func (it *iterator) done() bool {
+	return it.index >= len(it.op)
+}
+
+func (it *iterator) peek() Component {
+	if it.done() {
+		return Component{}
+	}
+
+	return it.op[it.index]
+}
+
+func (it *iterator) remain() int {
+	c := it.peek()
+	return c.Retain + c.Delete - it.offset
+}
+
+// next consumes n characters of current retain/delete component, or the
+// whole insert component.
+func (it *iterator) next(n int) {
+	c := it.peek()
+	if c.Insert != "" || it.offset+n >= c.Retain+c.Delete {
+		it.index++
+		it.offset = 0
+		return
+	}
+
+	it.offset += n
+}
@@ -39,6 +39,15 @@ func (c *Context) URL() *url.URL {
 	return c.req.URL
 }
 
+// Host returns host requested by client.
+func (c *Context) Host() string {
+	if host := c.RequestHeader().Get("X-Forwarded-Host"); host != "" {
+		return host
+	}
+
+	return c.req.Host
+}
+
 // RemoteIP returns IP address of remote client
 func (c *Context) RemoteIP() string {
 	if ip := c.RequestHeader().Get("X-Forwarded-For"); ip != "" {
@@ -0,0 +1,302 @@
+package web
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocket message types defined in RFC 6455.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+)
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var (
+	// ErrNotWebSocket means request is not a valid websocket handshake.
+	ErrNotWebSocket = errors.New("NOT A WEBSOCKET HANDSHAKE")
+	// ErrMessageTooLarge means received message exceeds MaxMessageSize.
+	ErrMessageTooLarge = errors.New("WEBSOCKET MESSAGE TOO LARGE")
+	// ErrBadFrame means received frame breaks the protocol.
+	ErrBadFrame = errors.New("BAD WEBSOCKET FRAME")
+	// ErrCrossOrigin means handshake is sent by page of another site.
+	ErrCrossOrigin = errors.New("CROSS ORIGIN WEBSOCKET HANDSHAKE")
+)
+
+type (
+	// WebSocket is a server side websocket connection.
+	WebSocket struct {
+		// MaxMessageSize limits size of a single received message.
+		MaxMessageSize int64
+
+		conn   net.Conn
+		reader *bufio.Reader
+		wlock  sync.Mutex
+		closed bool
+	}
+)
+
+// IsWebSocket tests if this request asks for websocket upgrade.
+func (c *Context) IsWebSocket() bool {
+	return headerContains(c.req.Header, "Connection", "upgrade") &&
+		headerContains(c.req.Header, "Upgrade", "websocket")
+}
+
+// Upgrade switches this request to websocket protocol. Nothing should be
+// written to response before and after upgrade. Handshake from page of
+// another site is rejected with 403, since browsers send cookies along.
+func (c *Context) Upgrade() (*WebSocket, error) {
+	if c.req.Method != "GET" || !c.IsWebSocket() || c.req.Header.Get("Sec-Websocket-Version") != "13" {
+		return nil, ErrNotWebSocket
+	}
+
+	key := c.req.Header.Get("Sec-Websocket-Key")
+	if key == "" {
+		return nil, ErrNotWebSocket
+	}
+
+	if !c.isSameOrigin() {
+		c.rsp.WriteHeader(http.StatusForbidden)
+		return nil, ErrCrossOrigin
+	}
+
+	conn, rw, err := c.rsp.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	accept := base64.StdEncoding.EncodeToString(hash[:])
+
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	rw.WriteString("Upgrade: websocket\r\n")
+	rw.WriteString("Connection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + accept + "\r\n\r\n")
+	if err = rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c.rsp.statusCode = http.StatusSwitchingProtocols
+	c.rsp.statusDone = true
+
+	conn.SetDeadline(time.Time{})
+	return &WebSocket{
+		MaxMessageSize: 4 << 20,
+		conn:           conn,
+		reader:         rw.Reader,
+	}, nil
+}
+
+// SetReadDeadline sets deadline for next read.
+func (ws *WebSocket) SetReadDeadline(t time.Time) error {
+	return ws.conn.SetReadDeadline(t)
+}
+
+// ReadMessage reads next complete data message. Control frames are handled
+// internally. Returns io.EOF when peer closed this connection.
+func (ws *WebSocket) ReadMessage() (int, []byte, error) {
+	kind := 0
+	data := []byte{}
+
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case PingMessage:
+			if err = ws.WriteMessage(PongMessage, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			ws.WriteMessage(CloseMessage, payload)
+			ws.Close()
+			return 0, nil, io.EOF
+		case 0:
+			if kind == 0 {
+				return 0, nil, ErrBadFrame
+			}
+		case TextMessage, BinaryMessage:
+			if kind != 0 {
+				return 0, nil, ErrBadFrame
+			}
+			kind = opcode
+		default:
+			return 0, nil, ErrBadFrame
+		}
+
+		if int64(len(data)+len(payload)) > ws.MaxMessageSize {
+			return 0, nil, ErrMessageTooLarge
+		}
+
+		data = append(data, payload...)
+		if fin {
+			return kind, data, nil
+		}
+	}
+}
+
+// ReadJSON reads next message and decodes it as JSON.
+func (ws *WebSocket) ReadJSON(v interface{}) error {
+	_, data, err := ws.ReadMessage()
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// WriteMessage sends a single frame message. It is safe to be called from
+// multiple goroutines.
+func (ws *WebSocket) WriteMessage(opcode int, data []byte) error {
+	ws.wlock.Lock()
+	defer ws.wlock.Unlock()
+
+	if ws.closed {
+		return io.ErrClosedPipe
+	}
+
+	size := len(data)
+	header := []byte{0x80 | byte(opcode)}
+
+	switch {
+	case size < 126:
+		header = append(header, byte(size))
+	case size <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(size))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(size))
+	}
+
+	if _, err := ws.conn.Write(header); err != nil {
+		return err
+	}
+
+	_, err := ws.conn.Write(data)
+	return err
+}
+
+// WriteJSON encodes v as JSON and sends it as text message.
+func (ws *WebSocket) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return ws.WriteMessage(TextMessage, data)
+}
+
+// Close underlying connection.
+func (ws *WebSocket) Close() error {
+	ws.wlock.Lock()
+	defer ws.wlock.Unlock()
+
+	if ws.closed {
+		return nil
+	}
+
+	ws.closed = true
+	return ws.conn.Close()
+}
+
+func (ws *WebSocket) readFrame() (bool, int, []byte, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(ws.reader, head); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := head[0]&0x80 != 0
+	opcode := int(head[0] & 0x0F)
+	masked := head[1]&0x80 != 0
+	size := int64(head[1] & 0x7F)
+
+	// Clients MUST mask frames and control frames MUST NOT be fragmented.
+	if !masked || head[0]&0x70 != 0 || (opcode >= CloseMessage && (!fin || size > 125)) {
+		return false, 0, nil, ErrBadFrame
+	}
+
+	switch size {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(ws.reader, ext); err != nil {
+			return false, 0, nil, err
+		}
+		size = int64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(ws.reader, ext); err != nil {
+			return false, 0, nil, err
+		}
+		size = int64(binary.BigEndian.Uint64(ext))
+	}
+
+	if size < 0 || size > ws.MaxMessageSize {
+		return false, 0, nil, ErrMessageTooLarge
+	}
+
+	mask := make([]byte, 4)
+	if _, err := io.ReadFull(ws.reader, mask); err != nil {
+		return false, 0, nil, err
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// isSameOrigin tests if Origin of this request matches requested host.
+// Requests without Origin are not sent by browsers and are allowed.
+func (c *Context) isSameOrigin() bool {
+	origin := c.req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, c.Host())
+}
+
+func headerContains(header http.Header, key, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(key)] {
+		for _, one := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(one), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -7,6 +7,7 @@ import (
 
 	"team/common/auth"
 	"team/common/ini"
+	"team/common/mail"
 	"team/common/orm"
 )
 
@@ -70,6 +71,20 @@ func (m *MySQLInfo) URL() string {
 		m.User, m.Password, m.Host, m.Database)
 }
 
+// DocumentInfo holds settings of documents.
+type DocumentInfo struct {
+	Retention int `json:"retention"`
+}
+
+// Document settings. Retention is the max number of revisions kept for each
+// document, 0 means unlimited.
+var Document = &DocumentInfo{
+	Retention: 0,
+}
+
+// Mailer used to send notification mails. Disabled if host is empty.
+var Mailer = &mail.Mailer{}
+
 // Load configuration from file.
 func Load() {
 	if _, err := os.Stat("./team.ini"); err != nil {
@@ -109,6 +124,18 @@ func Read(setting *ini.Ini) {
 	MySQL.Password = setting.GetString("mysql", "password")
 	MySQL.Database = setting.GetString("mysql", "database")
 
+	Document.Retention = setting.GetValue("document", "retention").SafeInt(0)
+
+	UseMailer(
+		setting.GetValue("mailer", "host").SafeString(""),
+		setting.GetValue("mailer", "port").SafeInt(25),
+		setting.GetValue("mailer", "account").SafeString(""),
+		setting.GetValue("mailer", "password").SafeString(""),
+		setting.GetValue("mailer", "from").SafeString(""),
+		setting.GetValue("mailer", "tls").SafeBool(false),
+		setting.GetValue("mailer", "skip_verify").SafeBool(false),
+	)
+
 	switch App.Auth {
 	case AuthKindSMTP:
 		UseSMTPAuth(
@@ -144,6 +171,18 @@ func Save() error {
 	setting.SetString("mysql", "password", MySQL.Password)
 	setting.SetString("mysql", "database", MySQL.Database)
 
+	setting.SetInt("document", "retention", Document.Retention)
+
+	if Mailer.Host != "" {
+		setting.SetString("mailer", "host", Mailer.Host)
+		setting.SetInt("mailer", "port", Mailer.Port)
+		setting.SetString("mailer", "account", Mailer.Account)
+		setting.SetString("mailer", "password", Mailer.Password)
+		setting.SetString("mailer", "from", Mailer.From)
+		setting.SetBool("mailer", "tls", Mailer.TLS)
+		setting.SetBool("mailer", "skip_verify", Mailer.SkipVerify)
+	}
+
 	switch App.Auth {
 	case AuthKindSMTP:
 		smtp := ExtraAuth.(*auth.SMTPProvider)
@@ -177,6 +216,17 @@ func UseSMTPAuth(host string, port int, plain, tls, skipVerify bool) {
 	}
 }
 
+// UseMailer configures SMTP server to send mails.
+func UseMailer(host string, port int, account, pswd, from string, tls, skipVerify bool) {
+	Mailer.Host = host
+	Mailer.Port = port
+	Mailer.Account = account
+	Mailer.Password = pswd
+	Mailer.From = from
+	Mailer.TLS = tls
+	Mailer.SkipVerify = skipVerify
+}
+
 // UseLDAPAuth uses LDAP as extra auth method.
 func UseLDAPAuth(host string, port, protocol int, bindDN, bindPswd, searchDN string, skipVerify bool) {
 	ExtraAuth = &auth.LDAPProvider{
@@ -2,6 +2,8 @@ package controller
 
 import (
 	"team/common/web"
+	"team/config"
+	"team/model/search"
 	"team/model/user"
 )
 
@@ -13,8 +15,14 @@ func (a *Admin) Register(group *web.Router) {
 	group.POST("/user", a.addUser)
 	group.PUT("/user/:id", a.editUser)
 	group.PUT("/user/:id/lock", a.lockUser)
+	group.PUT("/user/:id/capacity", a.setCapacity)
 	group.DELETE("/user/:id", a.deleteUser)
 	group.GET("/user/list", a.users)
+	group.GET("/mailer", a.getMailer)
+	group.PUT("/mailer", a.setMailer)
+	group.GET("/document", a.getDocumentSetting)
+	group.PUT("/document", a.setDocumentSetting)
+	group.POST("/search/rebuild", a.rebuildSearch)
 }
 
 func (a *Admin) addUser(c *web.Context) {
@@ -58,12 +66,64 @@ func (a *Admin) lockUser(c *web.Context) {
 	c.JSON(200, web.Map{})
 }
 
+func (a *Admin) setCapacity(c *web.Context) {
+	uid := c.RouteValue("id").MustInt("")
+	capacity := c.PostFormValue("capacity").MustInt("请填写每周容量")
+
+	web.AssertError(user.SetCapacity(uid, int32(capacity)))
+	c.JSON(200, web.Map{})
+}
+
 func (a *Admin) deleteUser(c *web.Context) {
 	uid := c.RouteValue("id").MustInt("")
 	user.Delete(uid)
 	c.JSON(200, web.Map{})
 }
 
+func (a *Admin) getMailer(c *web.Context) {
+	c.JSON(200, web.Map{"data": config.Mailer})
+}
+
+func (a *Admin) setMailer(c *web.Context) {
+	host := c.PostFormValue("host").String()
+	port, _ := c.PostFormValue("port").Int()
+	account := c.PostFormValue("account").String()
+	pswd := c.PostFormValue("pswd").String()
+	from := c.PostFormValue("from").String()
+	tls, _ := c.PostFormValue("tls").Bool()
+	skipVerify, _ := c.PostFormValue("skipVerify").Bool()
+
+	if port == 0 {
+		port = 25
+	}
+
+	if pswd == "" && account == config.Mailer.Account {
+		pswd = config.Mailer.Password
+	}
+
+	config.UseMailer(host, int(port), account, pswd, from, tls, skipVerify)
+	web.AssertError(config.Save())
+	c.JSON(200, web.Map{})
+}
+
+func (a *Admin) getDocumentSetting(c *web.Context) {
+	c.JSON(200, web.Map{"data": config.Document})
+}
+
+func (a *Admin) setDocumentSetting(c *web.Context) {
+	retention, err := c.PostFormValue("retention").Int()
+	web.Assert(err == nil && retention >= 0, "无效的版本保留数量")
+
+	config.Document.Retention = int(retention)
+	web.AssertError(config.Save())
+	c.JSON(200, web.Map{})
+}
+
+func (a *Admin) rebuildSearch(c *web.Context) {
+	web.AssertError(search.Rebuild())
+	c.JSON(200, web.Map{})
+}
+
 func (a *Admin) users(c *web.Context) {
 	users, err := user.GetAll()
 	web.AssertError(err)
@@ -1,23 +1,57 @@
 package controller
 
 import (
+	"net/url"
 	"time"
 
+	"team/common/ot"
 	"team/common/web"
 	"team/model/document"
+	"team/model/markup"
+	"team/model/project"
 	"team/model/user"
 )
 
 // Document controller
 type Document int
 
+// collabMessage is sent by clients in collaborative editing session.
+type collabMessage struct {
+	Type   string           `json:"type"`
+	Rev    int              `json:"rev"`
+	Op     ot.Operation     `json:"op"`
+	Cursor *document.Cursor `json:"cursor"`
+}
+
 // Register implements web.Controller interface.
 func (d *Document) Register(group *web.Router) {
 	group.POST("", d.create)
 	group.GET("/list", d.getAll)
+	group.GET("/template/list", d.templates)
+	group.GET("/template/placeholder", d.placeholders)
+	group.POST("/template", d.addTemplate)
+	group.PUT(`/template/{tid:[\d]+}`, d.editTemplate)
+	group.DELETE(`/template/{tid:[\d]+}`, d.delTemplate)
 	group.GET("/:id", d.detail)
+	group.GET("/:id/path", d.path)
+	group.GET("/:id/export", d.export)
+	group.GET("/:id/backlinks", d.backlinks)
+	group.PUT("/:id/move", d.move)
 	group.PUT("/:id/title", d.rename)
 	group.PUT("/:id/content", d.edit)
+	group.GET("/:id/collab", d.collab)
+	group.GET("/:id/revision/list", d.revisions)
+	group.GET("/:id/revision/diff", d.diffRevisions)
+	group.GET(`/:id/revision/{rid:[\d]+}`, d.revision)
+	group.POST(`/:id/revision/{rid:[\d]+}/restore`, d.restoreRevision)
+	group.PUT("/:id/project", d.setProject)
+	group.GET("/:id/permission/list", d.permissions)
+	group.POST("/:id/permission", d.setPermission)
+	group.DELETE(`/:id/permission/{aid:[\d]+}`, d.delPermission)
+	group.POST("/:id/comment", d.addComment)
+	group.PUT(`/:id/comment/{cid:[\d]+}`, d.editComment)
+	group.PUT(`/:id/comment/{cid:[\d]+}/resolve`, d.resolveComment)
+	group.DELETE(`/:id/comment/{cid:[\d]+}`, d.deleteComment)
 	group.DELETE("/:id", d.delete)
 }
 
@@ -25,48 +59,205 @@ func (d *Document) create(c *web.Context) {
 	uid := c.Session.Get("uid").(int64)
 	title := c.PostFormValue("title").MustString("无效文档名")
 	parent := c.PostFormValue("parent").MustInt("无效父节点")
+	pid, err := c.PostFormValue("pid").Int()
+
+	if parent != -1 {
+		pdoc, e := document.Find(parent)
+		web.AssertError(e)
+
+		_, write := pdoc.Access(uid)
+		web.Assert(write, "无权在该文档下新建子文档")
+
+		// Sub-documents belong to the same project with parent by default.
+		if err != nil {
+			pid = pdoc.PID
+		}
+	}
+
+	if pid > 0 {
+		proj := project.Find(pid)
+		web.Assert(proj != nil, "指定项目不存在")
+		web.Assert(proj.HasMember(uid) || isProjectAdmin(proj, uid), "只有项目成员可以在项目中新建文档")
+	} else {
+		pid = 0
+	}
+
+	content := ""
+	if tid, err := c.PostFormValue("template").Int(); err == nil && tid > 0 {
+		tpl := document.FindTemplate(tid)
+		web.Assert(tpl != nil, "指定模板不存在或已删除")
+		web.Assert(tpl.IsAvailable(pid), "该模板不可用于此项目的文档")
+		content = tpl.Expand(uid, pid, title)
+	}
+
+	web.AssertError(document.Add(uid, parent, pid, title, content))
+	c.JSON(200, web.Map{})
+}
+
+func (d *Document) templates(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	pid, _ := c.QueryValue("pid").Int()
+
+	if pid > 0 {
+		proj := project.Find(pid)
+		web.Assert(proj != nil, "指定项目不存在")
+		web.Assert(proj.HasMember(uid) || isProjectAdmin(proj, uid), "只有项目成员可以查看项目模板")
+	}
+
+	list := []map[string]interface{}{}
+	for _, one := range document.GetTemplates(pid) {
+		author, _ := user.FindInfo(one.Author)
+		list = append(list, map[string]interface{}{
+			"id":      one.ID,
+			"pid":     one.PID,
+			"name":    one.Name,
+			"author":  author,
+			"time":    one.Time.Format("2006-01-02 15:04"),
+			"content": one.Content,
+			"manage":  one.CanManage(uid),
+		})
+	}
+
+	c.JSON(200, web.Map{"data": list})
+}
+
+func (d *Document) placeholders(c *web.Context) {
+	c.JSON(200, web.Map{"data": document.Placeholders})
+}
 
-	web.AssertError(document.Add(uid, parent, title))
+func (d *Document) addTemplate(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	pid, _ := c.PostFormValue("pid").Int()
+	name := c.PostFormValue("name").MustString("模板名称不可为空")
+	content := c.PostFormValue("content").String()
+
+	probe := &document.Template{PID: pid}
+	web.Assert(probe.CanManage(uid), "只有超级管理员可以管理全局模板，项目模板由项目管理员管理")
+
+	tpl, err := document.AddTemplate(uid, pid, name, content)
+	web.AssertError(err)
+	c.JSON(200, web.Map{"data": tpl})
+}
+
+func (d *Document) editTemplate(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	name := c.PostFormValue("name").MustString("模板名称不可为空")
+	content := c.PostFormValue("content").String()
+
+	tpl := findTemplate(c, uid)
+	web.AssertError(tpl.Edit(name, content))
+	c.JSON(200, web.Map{"data": tpl})
+}
+
+func (d *Document) delTemplate(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	findTemplate(c, uid).Delete()
 	c.JSON(200, web.Map{})
 }
 
 func (d *Document) getAll(c *web.Context) {
-	list, err := document.GetAll()
+	uid := c.Session.Get("uid").(int64)
+
+	list, err := document.GetAll(uid)
 	web.AssertError(err)
 	c.JSON(200, web.Map{"data": list})
 }
 
 func (d *Document) detail(c *web.Context) {
-	id := c.RouteValue("id").MustInt("")
-	doc, err := document.Find(id)
-	web.AssertError(err)
+	uid := c.Session.Get("uid").(int64)
+	doc := findDocument(c, uid, false)
+	_, write := doc.Access(uid)
 
 	creator, _ := user.FindInfo(doc.Author)
 	modifier, _ := user.FindInfo(doc.Modifier)
 
 	c.JSON(200, web.Map{"data": map[string]interface{}{
-		"id":       doc.ID,
-		"parent":   doc.Parent,
-		"title":    doc.Title,
-		"creator":  creator,
-		"modifier": modifier,
-		"tile":     doc.Time.Format("2006-01-02"),
-		"content":  doc.Content,
+		"id":        doc.ID,
+		"parent":    doc.Parent,
+		"pid":       doc.PID,
+		"title":     doc.Title,
+		"creator":   creator,
+		"modifier":  modifier,
+		"tile":      doc.Time.Format("2006-01-02"),
+		"content":   doc.Content,
+		"version":   doc.Version,
+		"writable":  write,
+		"manage":    doc.CanManage(uid),
+		"backlinks": doc.GetBacklinks(uid),
+		"comments":  doc.GetComments(),
 	}})
 }
 
+func (d *Document) backlinks(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	doc := findDocument(c, uid, false)
+	c.JSON(200, web.Map{"data": doc.GetBacklinks(uid)})
+}
+
+func (d *Document) path(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	doc := findDocument(c, uid, false)
+
+	list := []map[string]interface{}{}
+	for _, one := range doc.Path() {
+		if read, _ := one.Access(uid); read {
+			list = append(list, map[string]interface{}{
+				"id":    one.ID,
+				"title": one.Title,
+			})
+		}
+	}
+
+	c.JSON(200, web.Map{"data": list})
+}
+
+func (d *Document) export(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	subtree, _ := c.QueryValue("subtree").Bool()
+	doc := findDocument(c, uid, false)
+
+	data, ext, contentType, err := markup.Export(doc, uid, subtree, baseURL(c))
+	web.AssertError(err)
+
+	name := url.PathEscape(doc.Title + "." + ext)
+	c.ResponseHeader().Set("Content-Disposition", "attachment; filename*=UTF-8''"+name)
+	c.Blob(200, contentType, data)
+}
+
+func (d *Document) move(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	parent := c.PostFormValue("parent").MustInt("无效的目标节点")
+	index, err := c.PostFormValue("index").Int()
+	if err != nil {
+		index = -1
+	}
+
+	doc := findDocument(c, uid, true)
+	if parent != -1 {
+		target, err := document.Find(parent)
+		web.Assert(err == nil, "目标文档不存在")
+
+		_, write := target.Access(uid)
+		web.Assert(write, "无权在目标文档下添加子文档")
+	}
+
+	web.AssertError(doc.Move(parent, int(index)))
+	c.JSON(200, web.Map{})
+}
+
 func (d *Document) rename(c *web.Context) {
 	uid := c.Session.Get("uid").(int64)
-	did := c.RouteValue("id").MustInt("")
 	title := c.PostFormValue("title").MustString("无效文档名")
+	doc := findDocument(c, uid, true)
+	web.Assert(!document.IsCollaborating(doc.ID), "文档正在协同编辑中，请稍后再试")
 
-	doc, err := document.Find(did)
+	siblings, err := document.GetChildren(doc.Parent)
 	web.AssertError(err)
+	for _, one := range siblings {
+		web.Assert(one.ID == doc.ID || one.Title != title, "同级目录下已存在同名文档")
+	}
 
-	doc.Title = title
-	doc.Modifier = uid
-	doc.Time = time.Now()
-	web.AssertError(doc.Save())
+	web.AssertError(doc.Rename(uid, title))
 
 	c.JSON(200, web.Map{})
 }
@@ -75,20 +266,275 @@ func (d *Document) edit(c *web.Context) {
 	uid := c.Session.Get("uid").(int64)
 	did := c.RouteValue("id").MustInt("")
 	content := c.PostFormValue("content").MustString("内容不可为空")
+	version := c.PostFormValue("version").MustInt("缺少内容版本号")
+	web.Assert(!document.IsCollaborating(did), "文档正在协同编辑中，请加入协同编辑")
 
-	doc, err := document.Find(did)
+	doc := findDocument(c, uid, true)
+	_, err := doc.SetContent(uid, version, content)
+	if err == document.ErrConflict {
+		latest, e := document.Find(did)
+		web.AssertError(e)
+		conflict(c, err, latest.Version, latest.Content)
+		return
+	}
+
+	web.AssertError(err)
+
+	c.JSON(200, web.Map{})
+}
+
+func (d *Document) collab(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	doc := findDocument(c, uid, true)
+
+	ws, err := c.Upgrade()
 	web.AssertError(err)
+	defer ws.Close()
+
+	session, me := doc.Join(uid)
+	defer session.Leave(me)
+
+	go func() {
+		for msg := range me.Outbox {
+			if ws.WriteJSON(msg) != nil {
+				break
+			}
+		}
 
-	doc.Content = content
-	doc.Modifier = uid
-	doc.Time = time.Now()
-	web.AssertError(doc.Save())
+		ws.Close()
+	}()
 
+	for {
+		// Clients send ping message periodically to keep alive.
+		ws.SetReadDeadline(time.Now().Add(90 * time.Second))
+
+		msg := &collabMessage{}
+		if err := ws.ReadJSON(msg); err != nil {
+			return
+		}
+
+		switch msg.Type {
+		case "op":
+			if err := session.Apply(me, msg.Rev, msg.Op); err != nil {
+				ws.WriteJSON(web.Map{"type": "error", "err": err.Error()})
+				return
+			}
+		case "cursor":
+			if msg.Cursor != nil {
+				session.MoveCursor(me, msg.Rev, msg.Cursor)
+			}
+		}
+	}
+}
+
+func (d *Document) revisions(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	doc := findDocument(c, uid, false)
+
+	c.JSON(200, web.Map{"data": doc.GetHistories()})
+}
+
+func (d *Document) revision(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	rid := c.RouteValue("rid").MustInt("")
+	doc := findDocument(c, uid, false)
+
+	rev := doc.FindHistory(rid)
+	web.Assert(rev != nil, "指定版本不存在")
+
+	info := rev.Brief()
+	info["content"] = rev.Content
+	c.JSON(200, web.Map{"data": info})
+}
+
+func (d *Document) diffRevisions(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	from := c.QueryValue("from").MustInt("无效的起始版本")
+	to := c.QueryValue("to").MustInt("无效的目标版本")
+	doc := findDocument(c, uid, false)
+
+	lines, err := doc.DiffHistories(from, to)
+	web.AssertError(err)
+
+	c.JSON(200, web.Map{"data": lines})
+}
+
+func (d *Document) restoreRevision(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	did := c.RouteValue("id").MustInt("")
+	rid := c.RouteValue("rid").MustInt("")
+	web.Assert(!document.IsCollaborating(did), "文档正在协同编辑中，请加入协同编辑")
+
+	doc := findDocument(c, uid, true)
+	_, err := doc.RestoreHistory(uid, rid)
+	web.AssertError(err)
+
+	c.JSON(200, web.Map{})
+}
+
+func (d *Document) setProject(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	pid := c.PostFormValue("pid").MustInt("无效的项目")
+
+	doc := findDocument(c, uid, false)
+	web.Assert(doc.CanManage(uid), "只有文档作者及项目管理员可以修改所属项目")
+	web.Assert(!document.IsCollaborating(doc.ID), "文档正在协同编辑中，请稍后再试")
+
+	if pid != 0 {
+		proj := project.Find(pid)
+		web.Assert(proj != nil, "指定项目不存在")
+		web.Assert(proj.HasMember(uid) || isProjectAdmin(proj, uid), "只能将文档移入已加入的项目")
+	}
+
+	web.AssertError(doc.SetProject(pid))
+	c.JSON(200, web.Map{})
+}
+
+func (d *Document) permissions(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	doc := findDocument(c, uid, false)
+
+	list := []map[string]interface{}{}
+	for _, one := range doc.GetPermissions() {
+		info := map[string]interface{}{
+			"id":     one.ID,
+			"kind":   one.Kind,
+			"target": one.Target,
+			"write":  one.Write,
+		}
+
+		if one.Kind == document.PermitUser {
+			info["name"], _ = user.FindInfo(one.Target)
+		}
+
+		list = append(list, info)
+	}
+
+	c.JSON(200, web.Map{"data": list})
+}
+
+func (d *Document) setPermission(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	kind := c.PostFormValue("kind").MustInt("无效的授权类型")
+	target := c.PostFormValue("target").MustInt("无效的授权对象")
+	write, _ := c.PostFormValue("write").Bool()
+
+	doc := findDocument(c, uid, false)
+	web.Assert(doc.CanManage(uid), "只有文档作者及项目管理员可以修改权限")
+	web.AssertError(doc.SetPermission(int8(kind), target, write))
+	c.JSON(200, web.Map{})
+}
+
+func (d *Document) delPermission(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	aid := c.RouteValue("aid").MustInt("")
+
+	doc := findDocument(c, uid, false)
+	web.Assert(doc.CanManage(uid), "只有文档作者及项目管理员可以修改权限")
+	doc.DelPermission(aid)
+	c.JSON(200, web.Map{})
+}
+
+func (d *Document) addComment(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	content := c.PostFormValue("content").MustString("评论内容不可为空")
+	parent, _ := c.PostFormValue("parent").Int()
+	start, _ := c.PostFormValue("start").Int()
+	end, _ := c.PostFormValue("end").Int()
+
+	doc := findDocument(c, uid, false)
+	anchor := &document.Anchor{
+		Heading: c.PostFormValue("heading").String(),
+		Start:   int32(start),
+		End:     int32(end),
+	}
+
+	comment, err := doc.AddComment(uid, parent, anchor, content)
+	web.AssertError(err)
+	c.JSON(200, web.Map{"data": comment.ID})
+}
+
+func (d *Document) editComment(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	content := c.PostFormValue("content").MustString("评论内容不可为空")
+
+	_, comment := findDocComment(c, uid)
+	web.Assert(comment.UID == uid, "只有评论者可以编辑评论")
+	web.AssertError(comment.Edit(content))
+	c.JSON(200, web.Map{})
+}
+
+func (d *Document) resolveComment(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	resolved, _ := c.PostFormValue("resolved").Bool()
+
+	doc, comment := findDocComment(c, uid)
+	if comment.UID != uid {
+		_, write := doc.Access(uid)
+		web.Assert(write, "只有评论者及可编辑文档的成员可以解决评论")
+	}
+
+	web.AssertError(comment.SetResolved(uid, resolved))
+	c.JSON(200, web.Map{})
+}
+
+func (d *Document) deleteComment(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+
+	doc, comment := findDocComment(c, uid)
+	if comment.UID != uid {
+		web.Assert(doc.CanManage(uid), "只有评论者、文档作者及项目管理员可以删除评论")
+	}
+
+	comment.Delete()
 	c.JSON(200, web.Map{})
 }
 
 func (d *Document) delete(c *web.Context) {
-	id := c.RouteValue("id").MustInt("")
-	document.Delete(id)
+	uid := c.Session.Get("uid").(int64)
+	subtree, _ := c.QueryValue("subtree").Bool()
+
+	doc := findDocument(c, uid, false)
+	web.Assert(doc.CanManage(uid), "只有文档作者及项目管理员可以删除文档")
+
+	if subtree {
+		list, err := doc.Subtree()
+		web.AssertError(err)
+
+		for _, one := range list {
+			web.Assert(one.CanManage(uid), "无权删除子文档【"+one.Title+"】")
+		}
+	}
+
+	web.AssertError(document.Delete(doc.ID, subtree))
 	c.JSON(200, web.Map{})
 }
+
+// findTemplate returns template in route which given user can manage.
+func findTemplate(c *web.Context, uid int64) *document.Template {
+	tpl := document.FindTemplate(c.RouteValue("tid").MustInt(""))
+	web.Assert(tpl != nil, "模板不存在或已被删除")
+	web.Assert(tpl.CanManage(uid), "只有超级管理员可以管理全局模板，项目模板由项目管理员管理")
+	return tpl
+}
+
+// findDocComment returns document and its comment in route. Given user must
+// be able to read the document.
+func findDocComment(c *web.Context, uid int64) (*document.Document, *document.DocComment) {
+	doc := findDocument(c, uid, false)
+	comment := doc.FindComment(c.RouteValue("cid").MustInt(""))
+	web.Assert(comment != nil, "评论不存在或已删除")
+	return doc, comment
+}
+
+// findDocument returns document in route which given user has required
+// access to.
+func findDocument(c *web.Context, uid int64, write bool) *document.Document {
+	doc, err := document.Find(c.RouteValue("id").MustInt(""))
+	web.Assert(err == nil, "文档不存在或已被删除")
+
+	canRead, canWrite := doc.Access(uid)
+	web.Assert(canRead, "无权查看该文档")
+	web.Assert(!write || canWrite, "无权编辑该文档")
+	return doc
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"strings"
+
+	"team/common/web"
+	"team/model/feed"
+	"team/model/project"
+	"team/model/user"
+)
+
+// Feed controller. Serves subscription feeds authenticated by secret token
+// instead of session.
+type Feed int
+
+// Register implements web.Controller interface.
+func (f *Feed) Register(group *web.Router) {
+	group.GET(`/calendar/{token:[\w\.]+}`, f.calendar)
+	group.GET(`/activity/{token:[\w\.]+}`, f.activity)
+}
+
+func (*Feed) calendar(c *web.Context) {
+	secret := strings.TrimSuffix(c.RouteValue("token").String(), ".ics")
+
+	token := feed.FindToken(secret)
+	if token == nil {
+		c.String(404, "Not Found")
+		return
+	}
+
+	owner := user.Find(token.UID)
+	if owner == nil || owner.IsLocked {
+		c.String(403, "Forbidden")
+		return
+	}
+
+	var data []byte
+	var err error
+
+	switch token.Kind {
+	case feed.KindUserCalendar:
+		data, err = feed.UserCalendar(owner.ID, owner.Name, baseURL(c))
+	case feed.KindProjectCalendar:
+		proj := project.Find(token.Target)
+		if proj == nil || (!owner.IsSu && !proj.HasMember(owner.ID)) {
+			c.String(403, "Forbidden")
+			return
+		}
+
+		data, err = feed.ProjectCalendar(proj, baseURL(c))
+	default:
+		c.String(404, "Not Found")
+		return
+	}
+
+	if err != nil {
+		c.String(500, err.Error())
+		return
+	}
+
+	c.Blob(200, "text/calendar; charset=utf-8", data)
+}
+
+func (*Feed) activity(c *web.Context) {
+	secret := strings.TrimSuffix(c.RouteValue("token").String(), ".atom")
+
+	token := feed.FindToken(secret)
+	if token == nil || token.Kind != feed.KindProjectActivity {
+		c.String(404, "Not Found")
+		return
+	}
+
+	owner := user.Find(token.UID)
+	if owner == nil || owner.IsLocked {
+		c.String(403, "Forbidden")
+		return
+	}
+
+	proj := project.Find(token.Target)
+	if proj == nil || (!owner.IsSu && !proj.HasMember(owner.ID)) {
+		c.String(403, "Forbidden")
+		return
+	}
+
+	data, err := feed.ActivityAtom(proj, owner.ID, baseURL(c))
+	if err != nil {
+		c.String(500, err.Error())
+		return
+	}
+
+	c.Blob(200, "application/atom+xml; charset=utf-8", data)
+}
+
+// baseURL returns scheme and host used by client to visit this server.
+func baseURL(c *web.Context) string {
+	scheme := c.RequestHeader().Get("X-Forwarded-Proto")
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	return scheme + "://" + c.Host()
+}
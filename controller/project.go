@@ -1,10 +1,20 @@
 package controller
 
 import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"strings"
 	"time"
 
 	"team/common/web"
+	"team/model/archive"
+	"team/model/feed"
+	"team/model/migrate"
 	"team/model/project"
+	"team/model/report"
+	"team/model/stats"
 	"team/model/task"
 	"team/model/user"
 )
@@ -12,14 +22,22 @@ import (
 // Project controller
 type Project int
 
+var labelColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
 // Register implements web.Controller interface.
 func (p *Project) Register(group *web.Router) {
 	group.POST("", p.create)
+	group.POST("/import", p.importArchive)
+	group.GET("/migrate/:id", p.getMigration)
 	group.GET("/mine", p.mine)
+	group.GET("/workload", p.getWorkload)
 	group.DELETE("/:id", p.delete)
+	group.GET("/:id/export", p.exportArchive)
+	group.POST("/:id/migrate", p.migrate)
 
 	group.GET("/:id", p.info)
 	group.GET("/:id/summary", p.summary)
+	group.GET("/:id/activity", p.getActivities)
 	group.PUT("/:id/desc", p.setDesc)
 	group.PUT("/:id/name", p.rename)
 
@@ -32,8 +50,36 @@ func (p *Project) Register(group *web.Router) {
 	group.POST("/:id/milestone", p.addMilestone)
 	group.PUT(`/:id/milestone/{mid:[\d]+}`, p.editMilestone)
 	group.DELETE(`/:id/milestone/{mid:[\d]+}`, p.delMilestone)
+	group.GET(`/:id/milestone/{mid:[\d]+}/burndown`, p.getBurndown)
+	group.GET(`/:id/milestone/{mid:[\d]+}/analytics`, p.getAnalytics)
+	group.GET("/:id/analytics", p.getAnalytics)
+
+	group.GET("/:id/label/list", p.getLabels)
+	group.POST("/:id/label", p.addLabel)
+	group.PUT(`/:id/label/{lid:[\d]+}`, p.editLabel)
+	group.DELETE(`/:id/label/{lid:[\d]+}`, p.delLabel)
+
+	group.GET("/:id/field/list", p.getFields)
+	group.POST("/:id/field", p.addField)
+	group.PUT(`/:id/field/{fid:[\d]+}`, p.editField)
+	group.DELETE(`/:id/field/{fid:[\d]+}`, p.delField)
+
+	group.GET("/:id/sprint/list", p.getSprints)
+	group.POST("/:id/sprint", p.addSprint)
+	group.PUT(`/:id/sprint/{sid:[\d]+}`, p.editSprint)
+	group.DELETE(`/:id/sprint/{sid:[\d]+}`, p.delSprint)
+	group.POST(`/:id/sprint/{sid:[\d]+}/start`, p.startSprint)
+	group.POST(`/:id/sprint/{sid:[\d]+}/close`, p.closeSprint)
+	group.GET(`/:id/sprint/{sid:[\d]+}/report`, p.getSprintReport)
+
+	group.GET("/:id/gantt", p.getGantt)
+	group.PUT("/:id/gantt", p.reschedule)
 
 	group.GET(`/:id/week/{start:[\d]+}`, p.getWeekReport)
+	group.GET(`/:id/week/{start:[\d]+}/export`, p.exportWeekReport)
+	group.GET("/:id/week/schedule", p.getWeekSchedule)
+	group.PUT("/:id/week/schedule", p.setWeekSchedule)
+	group.DELETE("/:id/week/schedule", p.delWeekSchedule)
 }
 
 func (*Project) create(c *web.Context) {
@@ -45,6 +91,76 @@ func (*Project) create(c *web.Context) {
 	c.JSON(200, web.Map{})
 }
 
+func (*Project) importArchive(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+
+	fhs := c.MultipartForm().File["file"]
+	web.Assert(len(fhs) > 0, "请上传项目归档文件")
+	web.Assert(fhs[0].Size <= archive.MaxSize, "项目归档文件过大")
+
+	file, err := fhs[0].Open()
+	web.AssertError(err)
+	defer file.Close()
+
+	report, err := archive.Import(file, fhs[0].Size, uid)
+	web.AssertError(err)
+
+	c.JSON(200, web.Map{"data": report})
+}
+
+func (*Project) exportArchive(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	pid := c.RouteValue("id").MustInt("")
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已被删除")
+	web.Assert(isProjectAdmin(proj, uid), "只有项目管理员可以导出项目")
+
+	var buf bytes.Buffer
+	web.AssertError(archive.Export(proj, &buf))
+
+	name := url.PathEscape(proj.Name + ".zip")
+	c.ResponseHeader().Set("Content-Disposition", "attachment; filename*=UTF-8''"+name)
+	c.Blob(200, "application/zip", buf.Bytes())
+}
+
+func (*Project) migrate(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	pid := c.RouteValue("id").MustInt("")
+	kind := c.FormValue("kind").MustString("请选择导入来源")
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已被删除")
+	web.Assert(isProjectAdmin(proj, uid), "只有项目管理员可以导入外部数据")
+
+	fhs := c.MultipartForm().File["file"]
+	web.Assert(len(fhs) > 0, "请上传导出文件")
+
+	file, err := fhs[0].Open()
+	web.AssertError(err)
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(file)
+	web.AssertError(err)
+
+	src, err := migrate.Parse(kind, data)
+	web.AssertError(err)
+
+	job := migrate.Start(proj, uid, kind, src)
+	c.JSON(200, web.Map{"data": job.Info()})
+}
+
+func (*Project) getMigration(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	jid := c.RouteValue("id").MustInt("")
+
+	job := migrate.FindJob(jid)
+	web.Assert(job != nil, "导入任务不存在")
+	web.Assert(job.UID == uid || user.Find(uid).IsSu, "无权查看该导入任务")
+
+	c.JSON(200, web.Map{"data": job.Info()})
+}
+
 func (*Project) mine(c *web.Context) {
 	uid := c.Session.Get("uid").(int64)
 	projs, err := project.GetAllByUser(uid)
@@ -58,6 +174,43 @@ func (*Project) delete(c *web.Context) {
 	c.JSON(200, web.Map{})
 }
 
+func (*Project) getWorkload(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	pids, _ := c.QueryValue("pid").Ints()
+	start, err := time.Parse("2006-01-02", c.QueryValue("start").MustString("请指定开始日期"))
+	web.Assert(err == nil, "无效的开始日期")
+	end, err := time.Parse("2006-01-02", c.QueryValue("end").MustString("请指定结束日期"))
+	web.Assert(err == nil, "无效的结束日期")
+	web.Assert(!end.Before(start), "结束日期不可早于开始日期")
+	web.Assert(end.Sub(start) <= 366*24*time.Hour, "统计范围不可超过一年")
+
+	filter := &stats.WorkloadFilter{
+		Start:      start,
+		End:        end,
+		ByWeek:     c.QueryValue("unit").String() != "day",
+		ByEstimate: c.QueryValue("measure").String() == "estimate",
+	}
+
+	if len(pids) == 0 {
+		projs, err := project.GetAllByUser(uid)
+		web.AssertError(err)
+		filter.Projects = projs
+	} else {
+		me := user.Find(uid)
+		for _, pid := range pids {
+			proj := project.Find(int64(pid))
+			web.Assert(proj != nil, "指定项目不存在或已被删除")
+			web.Assert(me.IsSu || proj.HasMember(uid), "无权查看项目【"+proj.Name+"】的工作量")
+			filter.Projects = append(filter.Projects, proj)
+		}
+	}
+
+	data, err := stats.Workload(filter)
+	web.AssertError(err)
+
+	c.JSON(200, web.Map{"data": data})
+}
+
 func (*Project) info(c *web.Context) {
 	pid := c.RouteValue("id").MustInt("")
 	proj := project.Find(pid)
@@ -74,6 +227,23 @@ func (*Project) summary(c *web.Context) {
 	c.JSON(200, web.Map{"data": proj.Summary()})
 }
 
+func (*Project) getActivities(c *web.Context) {
+	pid := c.RouteValue("id").MustInt("")
+	page, _ := c.QueryValue("page").Int()
+	size, _ := c.QueryValue("size").Int()
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "指定项目不存在或已被删除")
+
+	list, total, err := feed.Activities(proj, int(page), int(size))
+	web.AssertError(err)
+
+	c.JSON(200, web.Map{"data": map[string]interface{}{
+		"list":  list,
+		"total": total,
+	}})
+}
+
 func (*Project) setDesc(c *web.Context) {
 	pid := c.RouteValue("id").MustInt("")
 	desc := c.PostFormValue("desc").String()
@@ -119,6 +289,7 @@ func (*Project) getInviteList(c *web.Context) {
 }
 
 func (*Project) addMember(c *web.Context) {
+	operator := c.Session.Get("uid").(int64)
 	pid := c.RouteValue("id").MustInt("")
 	uid := c.PostFormValue("uid").MustInt("无效的用户ID")
 	isAdmin, _ := c.PostFormValue("isAdmin").Bool()
@@ -138,10 +309,12 @@ func (*Project) addMember(c *web.Context) {
 	web.Assert(u != nil && !u.IsLocked, "无效的成员ID")
 	web.AssertError(proj.AddMember(uid, int8(role), isAdmin))
 
+	proj.LogActivity(operator, project.ActivityAddMember, u.Name)
 	c.JSON(200, web.Map{})
 }
 
 func (*Project) editMember(c *web.Context) {
+	operator := c.Session.Get("uid").(int64)
 	pid := c.RouteValue("id").MustInt("")
 	uid := c.RouteValue("uid").MustInt("")
 	role := c.PostFormValue("role").MustInt("无效的职能")
@@ -155,6 +328,9 @@ func (*Project) editMember(c *web.Context) {
 			one.Role = int8(role)
 			one.IsAdmin = isAdmin
 			web.AssertError(one.Save())
+
+			name, _ := user.FindInfo(uid)
+			proj.LogActivity(operator, project.ActivityEditMember, name)
 			c.JSON(200, web.Map{})
 			return
 		}
@@ -164,13 +340,20 @@ func (*Project) editMember(c *web.Context) {
 }
 
 func (*Project) deleteMember(c *web.Context) {
+	operator := c.Session.Get("uid").(int64)
 	pid := c.RouteValue("id").MustInt("")
 	uid := c.RouteValue("uid").MustInt("")
 
 	proj := project.Find(pid)
 	web.Assert(proj != nil, "项目不存在或已被删除")
 
-	proj.DelMember(uid)
+	if proj.HasMember(uid) {
+		proj.DelMember(uid)
+
+		name, _ := user.FindInfo(uid)
+		proj.LogActivity(operator, project.ActivityDelMember, name)
+	}
+
 	c.JSON(200, web.Map{})
 }
 
@@ -184,6 +367,7 @@ func (*Project) getMilestones(c *web.Context) {
 }
 
 func (*Project) addMilestone(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
 	pid := c.RouteValue("id").MustInt("")
 	name := c.PostFormValue("name").MustString("里程碑名不可为空")
 	startTime, _ := time.Parse("2006-01-02", c.PostFormValue("startTime").MustString("开始时间不可为空"))
@@ -194,10 +378,12 @@ func (*Project) addMilestone(c *web.Context) {
 	web.Assert(proj != nil, "项目不存在或已被删除")
 	web.AssertError(proj.AddMilestone(name, desc, startTime, endTime))
 
+	proj.LogActivity(uid, project.ActivityAddMilestone, name)
 	c.JSON(200, web.Map{})
 }
 
 func (*Project) editMilestone(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
 	pid := c.RouteValue("id").MustInt("")
 	mid := c.RouteValue("mid").MustInt("")
 
@@ -210,17 +396,345 @@ func (*Project) editMilestone(c *web.Context) {
 	web.Assert(proj != nil, "项目不存在或已被删除")
 	web.AssertError(proj.EditMilestone(mid, name, desc, startTime, endTime))
 
+	proj.LogActivity(uid, project.ActivityEditMilestone, name)
 	c.JSON(200, web.Map{})
 }
 
 func (*Project) delMilestone(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
 	pid := c.RouteValue("id").MustInt("")
 	mid := c.RouteValue("mid").MustInt("")
 
 	proj := project.Find(pid)
 	web.Assert(proj != nil, "项目不存在或已被删除")
 
+	milestone := proj.FindMilestone(mid)
+	web.Assert(milestone != nil, "里程碑不存在或已删除")
+
 	proj.DelMilestone(mid)
+	proj.LogActivity(uid, project.ActivityDelMilestone, milestone.Name)
+	c.JSON(200, web.Map{})
+}
+
+func (*Project) getBurndown(c *web.Context) {
+	pid := c.RouteValue("id").MustInt("")
+	mid := c.RouteValue("mid").MustInt("")
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已被删除")
+
+	milestone := proj.FindMilestone(mid)
+	web.Assert(milestone != nil, "里程碑不存在或已删除")
+
+	data, err := stats.Burndown(milestone)
+	web.AssertError(err)
+
+	c.JSON(200, web.Map{"data": data})
+}
+
+func (*Project) getAnalytics(c *web.Context) {
+	pid := c.RouteValue("id").MustInt("")
+	mid, err := c.RouteValue("mid").Int()
+	if err != nil {
+		mid = -1
+	}
+
+	developer, _ := c.QueryValue("developer").Int()
+	weight, err := c.QueryValue("weight").Int()
+	if err != nil {
+		weight = -1
+	}
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已被删除")
+
+	if mid > 0 {
+		web.Assert(proj.FindMilestone(mid) != nil, "里程碑不存在或已删除")
+	}
+
+	data, err := stats.Analytics(&stats.AnalyticsFilter{
+		PID:       pid,
+		MID:       mid,
+		Developer: developer,
+		Weight:    int8(weight),
+	})
+	web.AssertError(err)
+
+	c.JSON(200, web.Map{"data": data})
+}
+
+func (*Project) getLabels(c *web.Context) {
+	pid := c.RouteValue("id").MustInt("")
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已被删除")
+
+	c.JSON(200, web.Map{"data": proj.Labels})
+}
+
+func (*Project) addLabel(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	pid := c.RouteValue("id").MustInt("")
+	name := c.PostFormValue("name").MustString("标签名不可为空")
+	color := c.PostFormValue("color").MustString("标签颜色不可为空")
+
+	web.Assert(labelColor.MatchString(color), "无效的标签颜色")
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已被删除")
+	web.Assert(isProjectAdmin(proj, uid), "只有项目管理员可以管理标签")
+	web.AssertError(proj.AddLabel(name, color))
+
+	c.JSON(200, web.Map{})
+}
+
+func (*Project) editLabel(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	pid := c.RouteValue("id").MustInt("")
+	lid := c.RouteValue("lid").MustInt("")
+	name := c.PostFormValue("name").MustString("标签名不可为空")
+	color := c.PostFormValue("color").MustString("标签颜色不可为空")
+
+	web.Assert(labelColor.MatchString(color), "无效的标签颜色")
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已被删除")
+	web.Assert(isProjectAdmin(proj, uid), "只有项目管理员可以管理标签")
+	web.AssertError(proj.EditLabel(lid, name, color))
+
+	c.JSON(200, web.Map{})
+}
+
+func (*Project) delLabel(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	pid := c.RouteValue("id").MustInt("")
+	lid := c.RouteValue("lid").MustInt("")
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已被删除")
+	web.Assert(isProjectAdmin(proj, uid), "只有项目管理员可以管理标签")
+
+	proj.DelLabel(lid)
+	c.JSON(200, web.Map{})
+}
+
+func (*Project) getFields(c *web.Context) {
+	pid := c.RouteValue("id").MustInt("")
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已被删除")
+
+	c.JSON(200, web.Map{"data": proj.Fields})
+}
+
+func (*Project) addField(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	pid := c.RouteValue("id").MustInt("")
+	name := c.PostFormValue("name").MustString("字段名不可为空")
+	kind := c.PostFormValue("kind").MustInt("无效的字段类型")
+	options := c.PostFormValue("options").Strings()
+	required, _ := c.PostFormValue("required").Bool()
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已被删除")
+	web.Assert(isProjectAdmin(proj, uid), "只有项目管理员可以管理自定义字段")
+	web.AssertError(proj.AddField(name, int8(kind), options, required))
+
+	c.JSON(200, web.Map{})
+}
+
+func (*Project) editField(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	pid := c.RouteValue("id").MustInt("")
+	fid := c.RouteValue("fid").MustInt("")
+	name := c.PostFormValue("name").MustString("字段名不可为空")
+	options := c.PostFormValue("options").Strings()
+	required, _ := c.PostFormValue("required").Bool()
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已被删除")
+	web.Assert(isProjectAdmin(proj, uid), "只有项目管理员可以管理自定义字段")
+	web.AssertError(proj.EditField(fid, name, options, required))
+
+	c.JSON(200, web.Map{})
+}
+
+func (*Project) delField(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	pid := c.RouteValue("id").MustInt("")
+	fid := c.RouteValue("fid").MustInt("")
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已被删除")
+	web.Assert(isProjectAdmin(proj, uid), "只有项目管理员可以管理自定义字段")
+
+	proj.DelField(fid)
+	c.JSON(200, web.Map{})
+}
+
+func (*Project) getSprints(c *web.Context) {
+	pid := c.RouteValue("id").MustInt("")
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已被删除")
+
+	c.JSON(200, web.Map{"data": proj.GetSprints()})
+}
+
+func (*Project) addSprint(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	pid := c.RouteValue("id").MustInt("")
+	name := c.PostFormValue("name").MustString("迭代名不可为空")
+	goal := c.PostFormValue("goal").String()
+	startTime, _ := time.Parse("2006-01-02", c.PostFormValue("startTime").MustString("开始时间不可为空"))
+	endTime, _ := time.Parse("2006-01-02", c.PostFormValue("endTime").MustString("终止时间不可为空"))
+	capacity, _ := c.PostFormValue("capacity").Int()
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已被删除")
+	web.Assert(isProjectAdmin(proj, uid), "只有项目管理员可以管理迭代")
+	web.AssertError(proj.AddSprint(name, goal, startTime, endTime, int32(capacity)))
+
+	c.JSON(200, web.Map{})
+}
+
+func (*Project) editSprint(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	pid := c.RouteValue("id").MustInt("")
+	sid := c.RouteValue("sid").MustInt("")
+	name := c.PostFormValue("name").MustString("迭代名不可为空")
+	goal := c.PostFormValue("goal").String()
+	startTime, _ := time.Parse("2006-01-02", c.PostFormValue("startTime").MustString("开始时间不可为空"))
+	endTime, _ := time.Parse("2006-01-02", c.PostFormValue("endTime").MustString("终止时间不可为空"))
+	capacity, _ := c.PostFormValue("capacity").Int()
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已被删除")
+	web.Assert(isProjectAdmin(proj, uid), "只有项目管理员可以管理迭代")
+	web.AssertError(proj.EditSprint(sid, name, goal, startTime, endTime, int32(capacity)))
+
+	c.JSON(200, web.Map{})
+}
+
+func (*Project) delSprint(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	pid := c.RouteValue("id").MustInt("")
+	sid := c.RouteValue("sid").MustInt("")
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已被删除")
+	web.Assert(isProjectAdmin(proj, uid), "只有项目管理员可以管理迭代")
+	web.AssertError(proj.DelSprint(sid))
+
+	c.JSON(200, web.Map{})
+}
+
+func (*Project) startSprint(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	pid := c.RouteValue("id").MustInt("")
+	sid := c.RouteValue("sid").MustInt("")
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已被删除")
+	web.Assert(isProjectAdmin(proj, uid), "只有项目管理员可以管理迭代")
+
+	sprint := proj.FindSprint(sid)
+	web.Assert(sprint != nil, "迭代不存在或已删除")
+	web.AssertError(task.StartSprint(proj, sprint))
+
+	c.JSON(200, web.Map{})
+}
+
+func (*Project) closeSprint(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	pid := c.RouteValue("id").MustInt("")
+	sid := c.RouteValue("sid").MustInt("")
+	next, _ := c.PostFormValue("next").Int()
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已被删除")
+	web.Assert(isProjectAdmin(proj, uid), "只有项目管理员可以管理迭代")
+
+	sprint := proj.FindSprint(sid)
+	web.Assert(sprint != nil, "迭代不存在或已删除")
+	web.AssertError(task.CloseSprint(uid, proj, sprint, next))
+
+	report, err := task.SprintReport(sprint)
+	web.AssertError(err)
+
+	c.JSON(200, web.Map{"data": report})
+}
+
+func (*Project) getSprintReport(c *web.Context) {
+	pid := c.RouteValue("id").MustInt("")
+	sid := c.RouteValue("sid").MustInt("")
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已被删除")
+
+	sprint := proj.FindSprint(sid)
+	web.Assert(sprint != nil, "迭代不存在或已删除")
+
+	report, err := task.SprintReport(sprint)
+	web.AssertError(err)
+
+	c.JSON(200, web.Map{"data": report})
+}
+
+func (*Project) getGantt(c *web.Context) {
+	pid := c.RouteValue("id").MustInt("")
+	withArchived, _ := c.QueryValue("archived").Bool()
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已被删除")
+
+	data, err := task.Gantt(proj, withArchived)
+	web.AssertError(err)
+
+	c.JSON(200, web.Map{"data": data})
+}
+
+func (*Project) reschedule(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	pid := c.RouteValue("id").MustInt("")
+	ids := c.PostFormValue("id").MustInts("无效的任务")
+	starts := c.PostFormValue("startTime").MustStrings("未指定开始时间")
+	ends := c.PostFormValue("endTime").MustStrings("未指定结束时间")
+
+	web.Assert(len(ids) == len(starts) && len(ids) == len(ends), "任务时间参数不匹配")
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已被删除")
+
+	type change struct {
+		edit       *task.Task
+		start, end time.Time
+	}
+
+	changes := []*change{}
+	for i, tid := range ids {
+		edit := task.Find(int64(tid))
+		web.Assert(edit != nil && edit.PID == pid, "任务不存在或已被删除")
+
+		if edit.Creator != uid {
+			web.Assert(isProjectAdmin(proj, uid), "只有发布者及项目管理员可以更改任务时间")
+		}
+
+		start, err := time.Parse("2006-01-02", starts[i])
+		web.Assert(err == nil, "无效的开始时间")
+		end, err := time.Parse("2006-01-02", ends[i])
+		web.Assert(err == nil, "无效的结束时间")
+
+		web.AssertError(edit.CheckTime(start, end))
+		changes = append(changes, &change{edit: edit, start: start, end: end})
+	}
+
+	for _, one := range changes {
+		oldTime := one.edit.StartTime.Format("2006-01-02") + "/" + one.edit.EndTime.Format("2006-01-02")
+		web.AssertError(one.edit.SetTime(one.start, one.end))
+		one.edit.LogEvent(uid, task.EventModTime, oldTime)
+	}
+
 	c.JSON(200, web.Map{})
 }
 
@@ -231,5 +745,67 @@ func (*Project) getWeekReport(c *web.Context) {
 	proj := project.Find(pid)
 	web.Assert(proj != nil, "项目不存在或已被删除")
 
-	c.JSON(200, web.Map{"data": task.GetWeekReport(pid, start)})
+	c.JSON(200, web.Map{"data": task.GetWeekReport(pid, start, taskFilter(c))})
+}
+
+func (*Project) exportWeekReport(c *web.Context) {
+	pid := c.RouteValue("id").MustInt("")
+	start := c.RouteValue("start").MustInt("")
+	format := c.QueryValue("format").String()
+	if format == "" {
+		format = "md"
+	}
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已被删除")
+
+	week := report.Build(proj, start, taskFilter(c))
+	data, contentType, err := week.Render(format)
+	web.AssertError(err)
+
+	name := url.PathEscape(week.Title() + "." + format)
+	c.ResponseHeader().Set("Content-Disposition", "attachment; filename*=UTF-8''"+name)
+	c.Blob(200, contentType, data)
+}
+
+func (*Project) getWeekSchedule(c *web.Context) {
+	pid := c.RouteValue("id").MustInt("")
+	c.JSON(200, web.Map{"data": report.FindSchedule(pid)})
+}
+
+func (*Project) setWeekSchedule(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	pid := c.RouteValue("id").MustInt("")
+	weekday := c.PostFormValue("weekday").MustInt("请选择发送日期")
+	hour := c.PostFormValue("hour").MustInt("请选择发送时间")
+	recipients := strings.Split(c.PostFormValue("recipients").MustString("请填写收件人"), ",")
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已被删除")
+	web.Assert(isProjectAdmin(proj, uid), "只有项目管理员可以设置周报邮件")
+
+	schedule, err := report.SetSchedule(pid, int8(weekday), int8(hour), recipients)
+	web.AssertError(err)
+
+	c.JSON(200, web.Map{"data": schedule})
+}
+
+func (*Project) delWeekSchedule(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	pid := c.RouteValue("id").MustInt("")
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已被删除")
+	web.Assert(isProjectAdmin(proj, uid), "只有项目管理员可以设置周报邮件")
+
+	report.DelSchedule(pid)
+	c.JSON(200, web.Map{})
+}
+
+func isProjectAdmin(proj *project.Project, uid int64) bool {
+	if me := user.Find(uid); me != nil && me.IsSu {
+		return true
+	}
+
+	return proj != nil && proj.IsAdmin(uid)
 }
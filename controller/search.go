@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"team/common/web"
+	"team/model/search"
+)
+
+// Search controller
+type Search int
+
+// Register implements web.Controller interface.
+func (s *Search) Register(group *web.Router) {
+	group.GET("", s.query)
+}
+
+func (s *Search) query(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	text := c.QueryValue("q").MustString("请输入搜索关键词")
+	page, _ := c.QueryValue("page").Int()
+	size, _ := c.QueryValue("size").Int()
+
+	kind := int64(-1)
+	if c.QueryValue("kind").String() != "" {
+		var err error
+		kind, err = c.QueryValue("kind").Int()
+		web.Assert(err == nil && kind >= 0 && kind <= search.KindComment, "无效的搜索类型")
+	}
+
+	list, total, err := search.Query(uid, text, int8(kind), int(page), int(size))
+	web.AssertError(err)
+
+	c.JSON(200, web.Map{"data": map[string]interface{}{
+		"list":  list,
+		"total": total,
+		"terms": search.Terms(text),
+	}})
+}
@@ -1,7 +1,9 @@
 package controller
 
 import (
+	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"team/common/web"
@@ -18,8 +20,12 @@ func (t *Task) Register(group *web.Router) {
 	group.GET("/mine", t.mine)
 	group.GET("/project/:id", t.project)
 	group.GET("/milestone/:id", t.milestone)
+	group.GET("/sprint/:id", t.sprint)
+	group.GET("/export", t.export)
+	group.POST("/import", t.importCSV)
 
 	group.GET("/:id", t.info)
+	group.GET("/:id/backlinks", t.backlinks)
 	group.DELETE("/:id", t.delete)
 	group.POST("", t.create)
 	group.POST("/:id/back", t.moveBack)
@@ -30,16 +36,31 @@ func (t *Task) Register(group *web.Router) {
 	group.PUT("/:id/developer", t.setDeveloper)
 	group.PUT("/:id/tester", t.setTester)
 	group.PUT("/:id/weight", t.setWeight)
+	group.PUT("/:id/estimate", t.setEstimate)
+	group.PUT("/:id/sprint", t.setSprint)
 	group.PUT("/:id/time", t.setTime)
 	group.PUT("/:id/content", t.setContent)
+	group.GET("/:id/revision/list", t.revisions)
+	group.GET("/:id/revision/diff", t.diffRevisions)
+	group.GET(`/:id/revision/{rid:[\d]+}`, t.revision)
+	group.POST(`/:id/revision/{rid:[\d]+}/restore`, t.restoreRevision)
 	group.PUT("/:id/status", t.setStatus)
+	group.POST("/:id/label", t.addLabel)
+	group.DELETE(`/:id/label/{lid:[\d]+}`, t.delLabel)
+	group.PUT(`/:id/field/{fid:[\d]+}`, t.setField)
+	group.POST("/:id/depend", t.addDepend)
+	group.DELETE(`/:id/depend/{did:[\d]+}`, t.delDepend)
 	group.POST("/:id/comment", t.addComment)
+	group.PUT(`/:id/comment/{cid:[\d]+}`, t.editComment)
+	group.DELETE(`/:id/comment/{cid:[\d]+}`, t.deleteComment)
+	group.GET(`/:id/comment/{cid:[\d]+}/history`, t.commentHistory)
+	group.POST(`/:id/comment/{cid:[\d]+}/reaction`, t.toggleReaction)
 }
 
 func (*Task) mine(c *web.Context) {
 	uid := c.Session.Get("uid").(int64)
 
-	list, err := task.GetAllByUID(uid)
+	list, err := task.GetAllByUID(uid, taskFilter(c))
 	web.AssertError(err)
 
 	c.JSON(200, web.Map{"data": list})
@@ -51,7 +72,7 @@ func (*Task) project(c *web.Context) {
 	proj := project.Find(pid)
 	web.Assert(proj != nil, "项目不存在或已删除")
 
-	list, err := task.GetAllByPID(pid)
+	list, err := task.GetAllByPID(pid, taskFilter(c))
 	web.AssertError(err)
 
 	c.JSON(200, web.Map{"data": list})
@@ -59,16 +80,110 @@ func (*Task) project(c *web.Context) {
 
 func (*Task) milestone(c *web.Context) {
 	mid := c.RouteValue("id").MustInt("")
-	list, err := task.GetAllByMID(mid)
+	list, err := task.GetAllByMID(mid, taskFilter(c))
 	web.AssertError(err)
 	c.JSON(200, web.Map{"data": list})
 }
 
+func (*Task) sprint(c *web.Context) {
+	sid := c.RouteValue("id").MustInt("")
+	list, err := task.GetAllBySID(sid)
+	web.AssertError(err)
+	c.JSON(200, web.Map{"data": list})
+}
+
+func (*Task) export(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	pid, _ := c.QueryValue("pid").Int()
+	mid, _ := c.QueryValue("mid").Int()
+	sid, _ := c.QueryValue("sid").Int()
+	mine, _ := c.QueryValue("mine").Bool()
+	withArchived, _ := c.QueryValue("archived").Bool()
+
+	query := &task.Query{
+		PID:          pid,
+		MID:          mid,
+		SID:          sid,
+		WithArchived: withArchived,
+		Filter:       taskFilter(c),
+	}
+
+	if mine {
+		query.UID = uid
+	}
+
+	list, err := task.Search(query)
+	web.AssertError(err)
+
+	data, err := task.ExportCSV(list)
+	web.AssertError(err)
+
+	c.ResponseHeader().Set("Content-Disposition", "attachment; filename=tasks.csv")
+	c.Blob(200, "text/csv; charset=utf-8", data)
+}
+
+func (*Task) importCSV(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	pid := c.FormValue("pid").MustInt("无效的项目ID")
+	dryRun, _ := c.FormValue("dryRun").Bool()
+
+	proj := project.Find(pid)
+	web.Assert(proj != nil, "项目不存在或已删除")
+	web.Assert(user.Find(uid).IsSu || proj.HasMember(uid), "只有项目成员可以导入任务")
+
+	fhs := c.MultipartForm().File["file"]
+	web.Assert(len(fhs) > 0, "请上传CSV文件")
+
+	mapping := map[string]string{}
+	for field := range task.ImportColumns {
+		mapping[field] = c.FormValue("map_" + field).String()
+	}
+
+	for _, f := range proj.Fields {
+		field := fmt.Sprintf("field_%d", f.ID)
+		mapping[field] = c.FormValue("map_" + field).String()
+	}
+
+	file, err := fhs[0].Open()
+	web.AssertError(err)
+	defer file.Close()
+
+	rows, err := task.ParseImport(proj, uid, file, mapping)
+	web.AssertError(err)
+
+	preview := []map[string]interface{}{}
+	invalid := 0
+	for _, row := range rows {
+		preview = append(preview, row.Info())
+		if len(row.Errors) > 0 {
+			invalid++
+		}
+	}
+
+	imported := 0
+	if !dryRun {
+		web.Assert(invalid == 0, "部分数据有误，请修正后再导入")
+
+		added, err := task.Import(proj, uid, rows)
+		web.AssertError(err)
+		imported = len(added)
+	}
+
+	c.JSON(200, web.Map{"data": map[string]interface{}{
+		"rows":     preview,
+		"total":    len(rows),
+		"invalid":  invalid,
+		"imported": imported,
+	}})
+}
+
 func (*Task) create(c *web.Context) {
 	name := c.PostFormValue("name").MustString("任务名不可空")
 	pid := c.PostFormValue("pid").MustInt("无效的项目ID")
 	mid := c.PostFormValue("mid").MustInt("无效的分支")
 	weight := c.PostFormValue("weight").MustInt("无效的优先级")
+	estimate, _ := c.PostFormValue("estimate").Int()
+	sid, _ := c.PostFormValue("sprint").Int()
 	cid, _ := c.PostFormValue("creator").Int()
 	did := c.PostFormValue("developer").MustInt("开发人员未指定")
 	tid := c.PostFormValue("tester").MustInt("测试人员未指定")
@@ -96,7 +211,29 @@ func (*Task) create(c *web.Context) {
 			"任务时间计划与所属里程碑不匹配")
 	}
 
-	t := task.Add(name, pid, mid, int8(weight), me.IsSu, creator.ID, did, tid, startTime, endTime, content)
+	fields := map[int64]string{}
+	for _, f := range proj.Fields {
+		value, err := f.Normalize(c.PostFormValue(fmt.Sprintf("field_%d", f.ID)).Strings())
+		web.AssertError(err)
+		fields[f.ID] = value
+	}
+
+	web.Assert(estimate >= 0, "无效的工作量估算")
+
+	if sid > 0 {
+		sprint := proj.FindSprint(sid)
+		web.Assert(sprint != nil && sprint.State != project.SprintClosed, "迭代不存在或已结束")
+	}
+
+	t := task.Add(name, pid, mid, int8(weight), int32(estimate), me.IsSu, creator.ID, did, tid, startTime, endTime, content)
+	for fid, value := range fields {
+		t.SetField(fid, value)
+	}
+
+	if sid > 0 {
+		t.SetSprint(sid)
+	}
+
 	fhs, ok := c.MultipartForm().File["files[]"]
 	if ok {
 		helper := new(File)
@@ -116,7 +253,18 @@ func (*Task) info(c *web.Context) {
 	t := task.Find(tid)
 	web.Assert(t != nil, "任务不存在或已被删除")
 
-	c.JSON(200, web.Map{"data": t.Detail()})
+	uid := c.Session.Get("uid").(int64)
+	c.JSON(200, web.Map{"data": t.Detail(uid)})
+}
+
+func (*Task) backlinks(c *web.Context) {
+	tid := c.RouteValue("id").MustInt("")
+	uid := c.Session.Get("uid").(int64)
+
+	t := task.Find(tid)
+	web.Assert(t != nil && t.IsVisibleTo(uid), "任务不存在或已被删除")
+
+	c.JSON(200, web.Map{"data": t.GetBacklinks(uid)})
 }
 
 func (*Task) delete(c *web.Context) {
@@ -151,7 +299,7 @@ func (*Task) setName(c *web.Context) {
 	}
 
 	old := edit.Name
-	web.AssertError(edit.SetName(name))
+	web.AssertError(edit.SetName(uid, name))
 
 	edit.LogEvent(uid, task.EventModName, old)
 	c.JSON(200, web.Map{})
@@ -270,6 +418,60 @@ func (*Task) setWeight(c *web.Context) {
 	c.JSON(200, web.Map{})
 }
 
+func (*Task) setEstimate(c *web.Context) {
+	operator := c.Session.Get("uid").(int64)
+	tid := c.RouteValue("id").MustInt("")
+	estimate := int32(c.PostFormValue("estimate").MustInt("无效的工作量估算"))
+
+	edit := task.Find(tid)
+	web.Assert(edit != nil, "任务不存在或已被删除")
+
+	proj := project.Find(edit.PID)
+	web.Assert(proj != nil, "任务所属项目不存在或已删除")
+	web.Assert(proj.HasMember(operator), "只有项目成员可以更改工作量估算")
+	web.Assert(edit.Creator == operator || proj.IsAdmin(operator), "只有发布者及项目管理员可以更改工作量估算")
+
+	if edit.Estimate == estimate {
+		c.JSON(200, web.Map{})
+		return
+	}
+
+	old := edit.Estimate
+	web.AssertError(edit.SetEstimate(estimate))
+
+	edit.LogEvent(operator, task.EventModEstimate, strconv.Itoa(int(old)))
+	c.JSON(200, web.Map{})
+}
+
+func (*Task) setSprint(c *web.Context) {
+	operator := c.Session.Get("uid").(int64)
+	tid := c.RouteValue("id").MustInt("")
+	sid, _ := c.PostFormValue("sprint").Int()
+
+	edit := task.Find(tid)
+	web.Assert(edit != nil, "任务不存在或已被删除")
+
+	old := edit.GetSprint()
+	if (old == nil && sid <= 0) || (old != nil && old.ID == sid) {
+		c.JSON(200, web.Map{})
+		return
+	}
+
+	if edit.Creator != operator {
+		web.Assert(isTaskAdmin(edit, operator), "只有发布者及项目管理员可以调整迭代")
+	}
+
+	web.AssertError(edit.SetSprint(sid))
+
+	oldName := ""
+	if old != nil {
+		oldName = old.Name
+	}
+
+	edit.LogEvent(operator, task.EventModSprint, oldName)
+	c.JSON(200, web.Map{})
+}
+
 func (*Task) setTime(c *web.Context) {
 	uid := c.Session.Get("uid").(int64)
 	tid := c.RouteValue("id").MustInt("")
@@ -296,12 +498,103 @@ func (*Task) setContent(c *web.Context) {
 	tid := c.RouteValue("id").MustInt("")
 	uid := c.Session.Get("uid").(int64)
 	content := c.PostFormValue("content").MustString("任务内容不可为空")
+	version := c.PostFormValue("version").MustInt("缺少内容版本号")
 
 	edit := task.Find(tid)
 	web.Assert(edit != nil, "任务不存在或已被删除")
-	web.AssertError(edit.SetContent(content))
 
-	edit.LogEvent(uid, task.EventModContent, "")
+	rev, err := edit.SetContent(uid, version, content)
+	if err == task.ErrConflict {
+		latest := task.Find(tid)
+		web.Assert(latest != nil, "任务不存在或已被删除")
+		conflict(c, err, latest.Version, latest.Content)
+		return
+	}
+
+	web.AssertError(err)
+
+	edit.LogEvent(uid, task.EventModContent, strconv.FormatInt(rev.ID, 10))
+	c.JSON(200, web.Map{})
+}
+
+// conflict responses stale write with latest content, so client can merge.
+func conflict(c *web.Context, err error, version int64, content string) {
+	c.JSON(409, web.Map{
+		"err": err.Error(),
+		"data": web.Map{
+			"version": version,
+			"content": content,
+		},
+	})
+}
+
+func (*Task) revisions(c *web.Context) {
+	tid := c.RouteValue("id").MustInt("")
+	field, _ := c.QueryValue("field").Int()
+
+	t := task.Find(tid)
+	web.Assert(t != nil, "任务不存在或已被删除")
+
+	c.JSON(200, web.Map{"data": t.GetRevisions(int8(field))})
+}
+
+func (*Task) revision(c *web.Context) {
+	tid := c.RouteValue("id").MustInt("")
+	rid := c.RouteValue("rid").MustInt("")
+
+	t := task.Find(tid)
+	web.Assert(t != nil, "任务不存在或已被删除")
+
+	rev := t.FindRevision(rid)
+	web.Assert(rev != nil, "指定版本不存在")
+
+	info := rev.Brief()
+	info["content"] = rev.Content
+	c.JSON(200, web.Map{"data": info})
+}
+
+func (*Task) diffRevisions(c *web.Context) {
+	tid := c.RouteValue("id").MustInt("")
+	from := c.QueryValue("from").MustInt("无效的起始版本")
+	to := c.QueryValue("to").MustInt("无效的目标版本")
+
+	t := task.Find(tid)
+	web.Assert(t != nil, "任务不存在或已被删除")
+
+	lines, err := t.DiffRevisions(from, to)
+	web.AssertError(err)
+
+	c.JSON(200, web.Map{"data": lines})
+}
+
+func (*Task) restoreRevision(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	tid := c.RouteValue("id").MustInt("")
+	rid := c.RouteValue("rid").MustInt("")
+
+	edit := task.Find(tid)
+	web.Assert(edit != nil, "任务不存在或已被删除")
+
+	rev := edit.FindRevision(rid)
+	web.Assert(rev != nil, "指定版本不存在")
+
+	if rev.Field == task.RevisionName {
+		if edit.Creator != uid {
+			web.Assert(isTaskAdmin(edit, uid), "只有发布者及项目管理员可以更改名称")
+		}
+
+		old := edit.Name
+		_, err := edit.RestoreRevision(uid, rid)
+		web.AssertError(err)
+
+		edit.LogEvent(uid, task.EventModName, old)
+	} else {
+		restored, err := edit.RestoreRevision(uid, rid)
+		web.AssertError(err)
+
+		edit.LogEvent(uid, task.EventModContent, strconv.FormatInt(restored.ID, 10))
+	}
+
 	c.JSON(200, web.Map{})
 }
 
@@ -356,15 +649,220 @@ func (*Task) moveNext(c *web.Context) {
 	c.JSON(200, web.Map{})
 }
 
+func (*Task) addLabel(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	tid := c.RouteValue("id").MustInt("")
+	lid := c.PostFormValue("lid").MustInt("无效的标签ID")
+
+	edit := task.Find(tid)
+	web.Assert(edit != nil, "任务不存在或已被删除")
+
+	if edit.HasLabel(lid) {
+		c.JSON(200, web.Map{})
+		return
+	}
+
+	label, err := edit.AddLabel(lid)
+	web.AssertError(err)
+
+	edit.LogEvent(uid, task.EventAddLabel, label.Name)
+	c.JSON(200, web.Map{})
+}
+
+func (*Task) delLabel(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	tid := c.RouteValue("id").MustInt("")
+	lid := c.RouteValue("lid").MustInt("")
+
+	edit := task.Find(tid)
+	web.Assert(edit != nil, "任务不存在或已被删除")
+
+	if !edit.HasLabel(lid) {
+		c.JSON(200, web.Map{})
+		return
+	}
+
+	proj := project.Find(edit.PID)
+	web.Assert(proj != nil, "任务所属项目不存在或已删除")
+
+	label := proj.FindLabel(lid)
+	web.AssertError(edit.DelLabel(lid))
+
+	edit.LogEvent(uid, task.EventDelLabel, label.Name)
+	c.JSON(200, web.Map{})
+}
+
+func (*Task) setField(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	tid := c.RouteValue("id").MustInt("")
+	fid := c.RouteValue("fid").MustInt("")
+
+	edit := task.Find(tid)
+	web.Assert(edit != nil, "任务不存在或已被删除")
+
+	proj := project.Find(edit.PID)
+	web.Assert(proj != nil, "任务所属项目不存在或已删除")
+
+	field := proj.FindField(fid)
+	web.Assert(field != nil, "字段不存在或已删除")
+
+	value, err := field.Normalize(c.PostFormValue("value").Strings())
+	web.AssertError(err)
+
+	old, err := edit.SetField(fid, value)
+	web.AssertError(err)
+
+	if old != value {
+		edit.LogEvent(uid, task.EventModField, field.Name+"："+field.Text(old))
+	}
+
+	c.JSON(200, web.Map{})
+}
+
+func (*Task) addDepend(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	tid := c.RouteValue("id").MustInt("")
+	did := c.PostFormValue("depend").MustInt("无效的依赖任务")
+
+	edit := task.Find(tid)
+	web.Assert(edit != nil, "任务不存在或已被删除")
+
+	depend := task.Find(did)
+	web.Assert(depend != nil, "依赖的任务不存在或已被删除")
+
+	if edit.Creator != uid {
+		web.Assert(isTaskAdmin(edit, uid), "只有发布者及项目管理员可以更改依赖")
+	}
+
+	web.AssertError(edit.AddDepend(depend))
+
+	edit.LogEvent(uid, task.EventAddDepend, depend.Name)
+	c.JSON(200, web.Map{})
+}
+
+func (*Task) delDepend(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	tid := c.RouteValue("id").MustInt("")
+	did := c.RouteValue("did").MustInt("")
+
+	edit := task.Find(tid)
+	web.Assert(edit != nil, "任务不存在或已被删除")
+
+	if edit.Creator != uid {
+		web.Assert(isTaskAdmin(edit, uid), "只有发布者及项目管理员可以更改依赖")
+	}
+
+	web.AssertError(edit.DelDepend(did))
+
+	name := ""
+	if depend := task.Find(did); depend != nil {
+		name = depend.Name
+	}
+
+	edit.LogEvent(uid, task.EventDelDepend, name)
+	c.JSON(200, web.Map{})
+}
+
 func (*Task) addComment(c *web.Context) {
 	uid := c.Session.Get("uid").(int64)
 	tid := c.RouteValue("id").MustInt("")
 	content := c.PostFormValue("content").MustString("任务内容不可为空")
+	parent, _ := c.PostFormValue("parent").Int()
 
 	t := task.Find(tid)
 	web.Assert(t != nil, "任务不存在或已被删除")
-	web.AssertError(t.AddComment(uid, content))
 
-	t.LogEvent(uid, task.EventComment, "")
+	comment, err := t.AddComment(uid, parent, content)
+	web.AssertError(err)
+
+	t.LogEvent(uid, task.EventComment, strconv.FormatInt(comment.ID, 10))
+	c.JSON(200, web.Map{})
+}
+
+func (*Task) editComment(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	tid := c.RouteValue("id").MustInt("")
+	cid := c.RouteValue("cid").MustInt("")
+	content := c.PostFormValue("content").MustString("评论内容不可为空")
+
+	t, comment := findComment(uid, tid, cid)
+	if comment.UID != uid {
+		web.Assert(isTaskAdmin(t, uid), "只有评论者及项目管理员可以编辑评论")
+	}
+
+	web.AssertError(comment.Edit(uid, content))
+
+	t.LogEvent(uid, task.EventEditComment, strconv.FormatInt(comment.ID, 10))
 	c.JSON(200, web.Map{})
 }
+
+func (*Task) deleteComment(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	tid := c.RouteValue("id").MustInt("")
+	cid := c.RouteValue("cid").MustInt("")
+
+	t, comment := findComment(uid, tid, cid)
+	if comment.UID != uid {
+		web.Assert(isTaskAdmin(t, uid), "只有评论者及项目管理员可以删除评论")
+	}
+
+	web.AssertError(comment.Delete(uid))
+
+	t.LogEvent(uid, task.EventDelComment, strconv.FormatInt(comment.ID, 10))
+	c.JSON(200, web.Map{})
+}
+
+func (*Task) commentHistory(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	tid := c.RouteValue("id").MustInt("")
+	cid := c.RouteValue("cid").MustInt("")
+
+	_, comment := findComment(uid, tid, cid)
+	c.JSON(200, web.Map{"data": comment.GetHistory()})
+}
+
+func (*Task) toggleReaction(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	tid := c.RouteValue("id").MustInt("")
+	cid := c.RouteValue("cid").MustInt("")
+	emoji := c.PostFormValue("emoji").MustString("无效的表情")
+
+	_, comment := findComment(uid, tid, cid)
+	web.AssertError(comment.ToggleReaction(uid, emoji))
+	c.JSON(200, web.Map{})
+}
+
+// findComment returns comment of task visible to given user.
+func findComment(uid, tid, cid int64) (*task.Task, *task.Comment) {
+	t := task.Find(tid)
+	web.Assert(t != nil && t.IsVisibleTo(uid), "任务不存在或已被删除")
+
+	comment := task.FindComment(cid)
+	web.Assert(comment != nil && comment.TID == t.ID, "评论不存在或已删除")
+	return t, comment
+}
+
+func isTaskAdmin(t *task.Task, uid int64) bool {
+	return isProjectAdmin(project.Find(t.PID), uid)
+}
+
+func taskFilter(c *web.Context) *task.Filter {
+	filter := &task.Filter{Labels: []int64{}, Fields: []task.FieldCond{}}
+
+	labels, _ := c.QueryValue("label").Ints()
+	for _, lid := range labels {
+		filter.Labels = append(filter.Labels, int64(lid))
+	}
+
+	for _, cond := range c.QueryValue("field").Strings() {
+		parts := strings.SplitN(cond, ":", 2)
+		web.Assert(len(parts) == 2, "无效的字段筛选条件")
+
+		fid, err := strconv.ParseInt(parts[0], 10, 64)
+		web.Assert(err == nil, "无效的字段筛选条件")
+
+		filter.Fields = append(filter.Fields, task.FieldCond{FID: fid, Value: parts[1]})
+	}
+
+	return filter
+}
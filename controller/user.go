@@ -2,6 +2,8 @@ package controller
 
 import (
 	"team/common/web"
+	"team/model/feed"
+	"team/model/project"
 	"team/model/user"
 )
 
@@ -11,9 +13,13 @@ type User int
 // Register implements web.Controller interface.
 func (u *User) Register(group *web.Router) {
 	group.GET("", u.info)
+	group.GET("/list", u.list)
 	group.PUT("/name", u.rename)
 	group.PUT("/pswd", u.setPswd)
 	group.PUT("/avatar", u.setAvatar)
+	group.GET("/feed/list", u.getFeeds)
+	group.POST("/feed", u.addFeed)
+	group.DELETE("/feed/:id", u.revokeFeed)
 }
 
 func (*User) info(c *web.Context) {
@@ -21,6 +27,24 @@ func (*User) info(c *web.Context) {
 	c.JSON(200, web.Map{"data": user.Find(uid)})
 }
 
+func (*User) list(c *web.Context) {
+	users, err := user.GetAll()
+	web.AssertError(err)
+
+	list := []map[string]interface{}{}
+	for _, one := range users {
+		if !one.IsLocked {
+			list = append(list, map[string]interface{}{
+				"id":     one.ID,
+				"name":   one.Name,
+				"avatar": one.Avatar,
+			})
+		}
+	}
+
+	c.JSON(200, web.Map{"data": list})
+}
+
 func (*User) rename(c *web.Context) {
 	uid := c.Session.Get("uid").(int64)
 	name := c.FormValue("name").MustString("请填写新昵称")
@@ -53,3 +77,78 @@ func (*User) setAvatar(c *web.Context) {
 
 	c.JSON(200, web.Map{"data": me.Avatar})
 }
+
+func (*User) getFeeds(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	tokens, err := feed.GetTokens(uid)
+	web.AssertError(err)
+
+	list := []map[string]interface{}{}
+	for _, one := range tokens {
+		list = append(list, feedInfo(c, one))
+	}
+
+	c.JSON(200, web.Map{"data": list})
+}
+
+func (*User) addFeed(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	kind := c.PostFormValue("kind").MustInt("无效的订阅类型")
+	target, _ := c.PostFormValue("target").Int()
+
+	switch kind {
+	case feed.KindUserCalendar:
+		target = uid
+	case feed.KindProjectCalendar, feed.KindProjectActivity:
+		proj := project.Find(target)
+		web.Assert(proj != nil, "项目不存在或已被删除")
+		web.Assert(user.Find(uid).IsSu || proj.HasMember(uid), "只能订阅已加入的项目")
+	default:
+		web.Assert(false, "无效的订阅类型")
+	}
+
+	token, err := feed.AddToken(uid, int8(kind), target)
+	web.AssertError(err)
+
+	c.JSON(200, web.Map{"data": feedInfo(c, token)})
+}
+
+func (*User) revokeFeed(c *web.Context) {
+	uid := c.Session.Get("uid").(int64)
+	id := c.RouteValue("id").MustInt("")
+
+	web.AssertError(feed.RevokeToken(uid, id))
+	c.JSON(200, web.Map{})
+}
+
+func feedInfo(c *web.Context, token *feed.Token) map[string]interface{} {
+	name := ""
+	url := ""
+
+	switch token.Kind {
+	case feed.KindUserCalendar:
+		name = "我的日历"
+		url = baseURL(c) + "/feed/calendar/" + token.Token + ".ics"
+	case feed.KindProjectCalendar:
+		if proj := project.Find(token.Target); proj != nil {
+			name = proj.Name + " 项目日历"
+		}
+
+		url = baseURL(c) + "/feed/calendar/" + token.Token + ".ics"
+	case feed.KindProjectActivity:
+		if proj := project.Find(token.Target); proj != nil {
+			name = proj.Name + " 项目动态"
+		}
+
+		url = baseURL(c) + "/feed/activity/" + token.Token + ".atom"
+	}
+
+	return map[string]interface{}{
+		"id":     token.ID,
+		"kind":   token.Kind,
+		"target": token.Target,
+		"name":   name,
+		"url":    url,
+		"time":   token.Time.Format("2006-01-02 15:04:05"),
+	}
+}
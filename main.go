@@ -1,12 +1,18 @@
 package main
 
 import (
+	"log"
 	"strings"
 
 	"team/common/web"
 	"team/config"
 	"team/controller"
 	"team/middleware"
+	"team/model/install"
+	"team/model/link"
+	"team/model/report"
+	"team/model/search"
+	"team/model/stats"
 
 	rice "github.com/GeertJohan/go.rice"
 	_ "github.com/go-sql-driver/mysql"
@@ -16,6 +22,19 @@ func main() {
 	// Load configuration.
 	config.Load()
 
+	// Upgrade database schema of existing installation.
+	if config.Installed {
+		if err := install.Upgrade(); err != nil {
+			log.Fatalf("Failed to upgrade database. Reason: %v\n", err)
+		}
+	}
+
+	// Background jobs.
+	stats.StartSnapshotJob()
+	report.StartScheduleJob()
+	go search.RebuildIfEmpty()
+	go link.RebuildIfEmpty()
+
 	// Load resources.
 	resBox := rice.MustFindBox("view/dist")
 	mainPage := strings.ReplaceAll(resBox.MustString("app.html"), "__APP_NAME__", config.App.Name)
@@ -38,6 +57,9 @@ func main() {
 	router.GET("/logout", controller.Logout, middleware.MustInstalled)
 	router.POST("/login", controller.Login, middleware.MustInstalled)
 
+	// Subscription feeds authenticated by token.
+	router.UseController("/feed", new(controller.Feed), middleware.MustInstalled)
+
 	// Normal API.
 	api := router.Group("/api")
 	api.Use(middleware.MustInstalled)
@@ -49,6 +71,7 @@ func main() {
 	api.UseController("/document", new(controller.Document))
 	api.UseController("/file", new(controller.File))
 	api.UseController("/notice", new(controller.Notice))
+	api.UseController("/search", new(controller.Search))
 
 	// Admin API.
 	router.UseController(
@@ -0,0 +1,623 @@
+package archive
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"team/common/orm"
+	"team/model/project"
+	"team/model/task"
+	"team/model/user"
+)
+
+const (
+	// Version of archive format.
+	Version = 1
+	// MaxSize limits size of an uploaded archive.
+	MaxSize = 512 << 20
+	// maxExtracted limits total decompressed size read from an archive.
+	maxExtracted = 2 << 30
+)
+
+var errTooLarge = errors.New("归档文件解压后超出大小限制")
+
+type (
+	manifest struct {
+		Version  int       `json:"version"`
+		Exported time.Time `json:"exported"`
+	}
+
+	archivedProject struct {
+		Name string `json:"name"`
+		Desc string `json:"desc"`
+	}
+
+	archivedUser struct {
+		ID      int64  `json:"id"`
+		Account string `json:"account"`
+		Name    string `json:"name"`
+	}
+
+	archivedMilestone struct {
+		ID        int64     `json:"id"`
+		Name      string    `json:"name"`
+		Desc      string    `json:"desc"`
+		StartTime time.Time `json:"startTime"`
+		EndTime   time.Time `json:"endTime"`
+	}
+
+	archivedMember struct {
+		UID     int64 `json:"uid"`
+		Role    int8  `json:"role"`
+		IsAdmin bool  `json:"isAdmin"`
+	}
+
+	// Report of importing an archive.
+	Report struct {
+		PID       int64    `json:"pid"`
+		Name      string   `json:"name"`
+		Tasks     int      `json:"tasks"`
+		Files     int      `json:"files"`
+		Conflicts []string `json:"conflicts"`
+	}
+)
+
+var uploadRef = regexp.MustCompile(`/uploads/[^\s"'()<>\[\]]+`)
+
+// Export writes given project into a zip archive.
+func Export(proj *project.Project, w io.Writer) error {
+	tasks, err := task.Search(&task.Query{PID: proj.ID, WithArchived: true})
+	if err != nil {
+		return err
+	}
+
+	tids := []interface{}{}
+	for _, t := range tasks {
+		tids = append(tids, t.ID)
+	}
+
+	comments := []*task.Comment{}
+	events := []*task.Event{}
+	attachments := []*task.Attachment{}
+
+	if len(tids) > 0 {
+		in := "(" + strings.TrimSuffix(strings.Repeat("?,", len(tids)), ",") + ")"
+
+		if err = queryAll("SELECT * FROM `comment` WHERE `tid` IN "+in+" ORDER BY `id`", tids, func() interface{} {
+			one := &task.Comment{}
+			comments = append(comments, one)
+			return one
+		}); err != nil {
+			return err
+		}
+
+		if err = queryAll("SELECT * FROM `event` WHERE `tid` IN "+in+" ORDER BY `id`", tids, func() interface{} {
+			one := &task.Event{}
+			events = append(events, one)
+			return one
+		}); err != nil {
+			return err
+		}
+
+		if err = queryAll("SELECT * FROM `attachment` WHERE `tid` IN "+in+" ORDER BY `id`", tids, func() interface{} {
+			one := &task.Attachment{}
+			attachments = append(attachments, one)
+			return one
+		}); err != nil {
+			return err
+		}
+	}
+
+	milestones := []*archivedMilestone{}
+	for _, one := range proj.Milestones {
+		milestones = append(milestones, &archivedMilestone{
+			ID:        one.ID,
+			Name:      one.Name,
+			Desc:      one.Desc,
+			StartTime: one.StartTime,
+			EndTime:   one.EndTime,
+		})
+	}
+
+	members := []*archivedMember{}
+	uids := map[int64]bool{}
+	for _, one := range proj.Members {
+		members = append(members, &archivedMember{UID: one.UID, Role: one.Role, IsAdmin: one.IsAdmin})
+		uids[one.UID] = true
+	}
+
+	files := map[string]bool{}
+	for _, t := range tasks {
+		uids[t.Creator] = true
+		uids[t.Developer] = true
+		uids[t.Tester] = true
+		for _, ref := range uploadRef.FindAllString(t.Content, -1) {
+			files[ref] = true
+		}
+	}
+
+	for _, one := range comments {
+		uids[one.UID] = true
+		for _, ref := range uploadRef.FindAllString(one.Comment, -1) {
+			files[ref] = true
+		}
+	}
+
+	for _, one := range events {
+		uids[one.UID] = true
+	}
+
+	for _, one := range attachments {
+		files[one.Path] = true
+	}
+
+	users := []*archivedUser{}
+	for uid := range uids {
+		if u := user.Find(uid); u != nil {
+			users = append(users, &archivedUser{ID: u.ID, Account: u.Account, Name: u.Name})
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	writer := zip.NewWriter(w)
+	entries := []struct {
+		name string
+		data interface{}
+	}{
+		{"manifest.json", &manifest{Version: Version, Exported: time.Now()}},
+		{"project.json", &archivedProject{Name: proj.Name, Desc: proj.Desc}},
+		{"users.json", users},
+		{"milestones.json", milestones},
+		{"members.json", members},
+		{"tasks.json", tasks},
+		{"comments.json", comments},
+		{"events.json", events},
+		{"attachments.json", attachments},
+	}
+
+	for _, entry := range entries {
+		f, err := writer.Create(entry.name)
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err = encoder.Encode(entry.data); err != nil {
+			return err
+		}
+	}
+
+	refs := []string{}
+	for ref := range files {
+		refs = append(refs, ref)
+	}
+
+	sort.Strings(refs)
+	for _, ref := range refs {
+		if err = addFile(writer, ref); err != nil {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+// Import recreates project from given archive. Users are matched by account;
+// missing users and other conflicts are listed in report. Referenced files
+// are extracted under uploads of operator.
+func Import(r io.ReaderAt, size int64, operator int64) (*Report, error) {
+	reader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, errors.New("无效的项目归档文件")
+	}
+
+	entries := map[string]*zip.File{}
+	for _, f := range reader.File {
+		entries[f.Name] = f
+	}
+
+	info := &manifest{}
+	if err = readJSON(entries, "manifest.json", info); err != nil {
+		return nil, err
+	}
+
+	if info.Version != Version {
+		return nil, fmt.Errorf("不支持的归档版本：%d", info.Version)
+	}
+
+	proj := &archivedProject{}
+	users := []*archivedUser{}
+	milestones := []*archivedMilestone{}
+	members := []*archivedMember{}
+	tasks := []*task.Task{}
+	comments := []*task.Comment{}
+	events := []*task.Event{}
+	attachments := []*task.Attachment{}
+
+	for name, v := range map[string]interface{}{
+		"project.json":     proj,
+		"users.json":       &users,
+		"milestones.json":  &milestones,
+		"members.json":     &members,
+		"tasks.json":       &tasks,
+		"comments.json":    &comments,
+		"events.json":      &events,
+		"attachments.json": &attachments,
+	} {
+		if err = readJSON(entries, name, v); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &Report{Conflicts: []string{}}
+
+	uidMap := map[int64]int64{0: 0}
+	for _, one := range users {
+		if found := user.FindByAccount(one.Account); found != nil {
+			uidMap[one.ID] = found.ID
+		} else {
+			uidMap[one.ID] = operator
+			report.Conflicts = append(report.Conflicts, "用户【"+one.Account+"】不存在，已由导入者代替")
+		}
+	}
+
+	mapUser := func(uid int64) int64 {
+		if mapped, ok := uidMap[uid]; ok {
+			return mapped
+		}
+
+		return operator
+	}
+
+	report.Name = proj.Name
+	if exists(proj.Name) {
+		report.Name = proj.Name + " " + time.Now().Format("20060102150405")
+		report.Conflicts = append(report.Conflicts, "项目【"+proj.Name+"】已存在，导入为【"+report.Name+"】")
+	}
+
+	tx, err := orm.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	written := []string{}
+	fail := func(err error) (*Report, error) {
+		tx.Rollback()
+		for _, one := range written {
+			os.Remove(one)
+		}
+
+		return nil, err
+	}
+
+	result, err := tx.Insert(&project.Project{Name: report.Name, Desc: proj.Desc})
+	if err != nil {
+		return fail(err)
+	}
+
+	report.PID, _ = result.LastInsertId()
+
+	// Referenced files are extracted under operator's own upload directory,
+	// and references in content are rewritten to the new path.
+	extracted := int64(0)
+	relocated := map[string]string{}
+	relocate := func(ref string) (string, error) {
+		ref = "/" + strings.TrimPrefix(ref, "/")
+		if target, ok := relocated[ref]; ok {
+			return target, nil
+		}
+
+		target := fmt.Sprintf("uploads/%d/%d_%d_%d_%s", operator, time.Now().Unix(), report.PID, len(relocated), path.Base(ref))
+		size, err := extractFile(entries, ref, target, maxExtracted-extracted)
+		if err != nil {
+			return "", err
+		}
+
+		extracted += size
+		written = append(written, target)
+		report.Files++
+
+		relocated[ref] = "/" + target
+		return "/" + target, nil
+	}
+
+	rewrite := func(content string) (string, error) {
+		var err error
+		content = uploadRef.ReplaceAllStringFunc(content, func(ref string) string {
+			if _, ok := entries["files"+ref]; !ok || err != nil {
+				return ref
+			}
+
+			target, e := relocate(ref)
+			if e != nil {
+				err = e
+				return ref
+			}
+
+			return target
+		})
+
+		return content, err
+	}
+
+	midMap := map[int64]int64{0: 0}
+	for _, one := range milestones {
+		result, err := tx.Insert(&project.Milestone{
+			PID:       report.PID,
+			Name:      one.Name,
+			Desc:      one.Desc,
+			StartTime: one.StartTime,
+			EndTime:   one.EndTime,
+		})
+		if err != nil {
+			return fail(err)
+		}
+
+		midMap[one.ID], _ = result.LastInsertId()
+	}
+
+	joined := map[int64]bool{}
+	for _, one := range members {
+		uid, ok := uidMap[one.UID]
+		if !ok || joined[uid] {
+			continue
+		}
+
+		if _, err = tx.Insert(&project.Member{PID: report.PID, UID: uid, Role: one.Role, IsAdmin: one.IsAdmin || uid == operator}); err != nil {
+			return fail(err)
+		}
+
+		joined[uid] = true
+	}
+
+	if !joined[operator] {
+		if _, err = tx.Insert(&project.Member{PID: report.PID, UID: operator, IsAdmin: true}); err != nil {
+			return fail(err)
+		}
+	}
+
+	tidMap := map[int64]int64{}
+	for _, one := range tasks {
+		oldID := one.ID
+		mid, ok := midMap[one.MID]
+		if !ok {
+			report.Conflicts = append(report.Conflicts, fmt.Sprintf("任务【%s】所属里程碑缺失，已移出里程碑", one.Name))
+		}
+
+		one.ID = 0
+		one.PID = report.PID
+		one.MID = mid
+		one.Creator = mapUser(one.Creator)
+		one.Developer = mapUser(one.Developer)
+		one.Tester = mapUser(one.Tester)
+
+		if one.Content, err = rewrite(one.Content); err != nil {
+			return fail(err)
+		}
+
+		result, err := tx.Insert(one)
+		if err != nil {
+			return fail(err)
+		}
+
+		one.ID, _ = result.LastInsertId()
+		tidMap[oldID] = one.ID
+	}
+
+	report.Tasks = len(tidMap)
+
+	cidMap := map[int64]int64{0: 0}
+	imported := []*task.Comment{}
+	for _, one := range comments {
+		tid, ok := tidMap[one.TID]
+		if !ok {
+			continue
+		}
+
+		oldID := one.ID
+		one.ID = 0
+		one.TID = tid
+		one.UID = mapUser(one.UID)
+		one.Parent = cidMap[one.Parent]
+
+		if one.Comment, err = rewrite(one.Comment); err != nil {
+			return fail(err)
+		}
+
+		result, err := tx.Insert(one)
+		if err != nil {
+			return fail(err)
+		}
+
+		one.ID, _ = result.LastInsertId()
+		cidMap[oldID] = one.ID
+		imported = append(imported, one)
+	}
+
+	for _, one := range events {
+		tid, ok := tidMap[one.TID]
+		if !ok {
+			continue
+		}
+
+		one.ID = 0
+		one.TID = tid
+		one.UID = mapUser(one.UID)
+
+		if one.Event == task.EventComment || one.Event == task.EventEditComment || one.Event == task.EventDelComment {
+			var cid int64
+			fmt.Sscan(one.Extra, &cid)
+			one.Extra = fmt.Sprint(cidMap[cid])
+		}
+
+		if _, err = tx.Insert(one); err != nil {
+			return fail(err)
+		}
+	}
+
+	for _, one := range attachments {
+		tid, ok := tidMap[one.TID]
+		if !ok {
+			continue
+		}
+
+		target, err := relocate(one.Path)
+		if err == errTooLarge {
+			return fail(err)
+		} else if err != nil {
+			report.Conflicts = append(report.Conflicts, "附件【"+one.Name+"】缺失")
+			continue
+		}
+
+		if _, err = tx.Insert(&task.Attachment{TID: tid, Name: one.Name, Path: target}); err != nil {
+			return fail(err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fail(err)
+	}
+
+	for _, one := range tasks {
+		one.Reindex()
+	}
+
+	for _, one := range imported {
+		one.Reindex()
+	}
+
+	return report, nil
+}
+
+func queryAll(query string, args []interface{}, alloc func() interface{}) error {
+	rows, err := orm.Query(query, args...)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = orm.Scan(rows, alloc()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func exists(name string) bool {
+	rows, err := orm.Query("SELECT COUNT(*) FROM `project` WHERE `name`=?", name)
+	if err != nil {
+		return false
+	}
+
+	defer rows.Close()
+
+	count := 0
+	rows.Next()
+	rows.Scan(&count)
+	return count > 0
+}
+
+// addFile copies file under uploads into archive. Missing file is skipped.
+func addFile(writer *zip.Writer, ref string) error {
+	local := strings.TrimPrefix(ref, "/")
+	if !strings.HasPrefix(local, "uploads/") || strings.Contains(local, "..") {
+		return nil
+	}
+
+	src, err := os.Open(local)
+	if err != nil {
+		return nil
+	}
+
+	defer src.Close()
+
+	dst, err := writer.Create("files/" + local)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// extractFile writes referenced file in archive to target, reading at most
+// limit bytes. Existing file is never overwritten.
+func extractFile(entries map[string]*zip.File, ref, target string, limit int64) (int64, error) {
+	local := strings.TrimPrefix(ref, "/")
+	if !strings.HasPrefix(local, "uploads/") || strings.Contains(local, "..") || strings.Contains(target, "..") {
+		return 0, errors.New("非法的文件路径")
+	}
+
+	f, ok := entries["files/"+local]
+	if !ok {
+		return 0, errors.New("文件缺失")
+	}
+
+	if f.UncompressedSize64 > uint64(limit) {
+		return 0, errTooLarge
+	}
+
+	src, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+
+	defer src.Close()
+
+	if err = os.MkdirAll(path.Dir(target), 0755); err != nil {
+		return 0, err
+	}
+
+	dst, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := io.Copy(dst, io.LimitReader(src, limit+1))
+	dst.Close()
+
+	if err == nil && size > limit {
+		err = errTooLarge
+	}
+
+	if err != nil {
+		os.Remove(target)
+		return 0, err
+	}
+
+	return size, nil
+}
+
+func readJSON(entries map[string]*zip.File, name string, v interface{}) error {
+	f, ok := entries[name]
+	if !ok {
+		return fmt.Errorf("归档文件中缺少%s", name)
+	}
+
+	reader, err := f.Open()
+	if err != nil {
+		return err
+	}
+
+	defer reader.Close()
+
+	if err = json.NewDecoder(io.LimitReader(reader, maxExtracted)).Decode(v); err != nil {
+		return fmt.Errorf("解析%s失败：%v", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,310 @@
+package document
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"team/common/orm"
+	"team/common/ot"
+	"team/model/user"
+)
+
+// SnapshotInterval is the period collaborative sessions save their content
+// as a new revision.
+var SnapshotInterval = time.Minute
+
+type (
+	// Cursor holds selection range of a collaborator.
+	Cursor struct {
+		Anchor int `json:"anchor"`
+		Head   int `json:"head"`
+	}
+
+	// Collaborator is a client joined in collaborative session. Messages to
+	// this client are pushed into Outbox, which is closed after leaving.
+	Collaborator struct {
+		ID     int64            `json:"id"`
+		UID    int64            `json:"uid"`
+		Name   string           `json:"name"`
+		Avatar string           `json:"avatar"`
+		Cursor *Cursor          `json:"cursor"`
+		Outbox chan interface{} `json:"-"`
+	}
+
+	// Session holds state of collaborative editing on a single document.
+	Session struct {
+		lock    sync.Mutex
+		doc     *Document
+		content string
+		history []ot.Operation
+		members map[int64]*Collaborator
+		editor  int64
+		dirty   bool
+		stop    chan bool
+	}
+)
+
+var (
+	sessions     = map[int64]*Session{}
+	sessionsLock sync.Mutex
+	lastClientID int64
+)
+
+// IsCollaborating tests if given document has a collaborative session.
+func IsCollaborating(did int64) bool {
+	sessionsLock.Lock()
+	defer sessionsLock.Unlock()
+
+	_, ok := sessions[did]
+	return ok
+}
+
+// Join collaborative session of this document. A new session is started if
+// there is none. The first message in Outbox is the initial state.
+func (d *Document) Join(uid int64) (*Session, *Collaborator) {
+	sessionsLock.Lock()
+	defer sessionsLock.Unlock()
+
+	s, ok := sessions[d.ID]
+	if !ok {
+		s = &Session{
+			doc:     d,
+			content: d.Content,
+			history: []ot.Operation{},
+			members: map[int64]*Collaborator{},
+			stop:    make(chan bool),
+		}
+
+		sessions[d.ID] = s
+		go s.snapshotLoop()
+	}
+
+	lastClientID++
+	name, avatar := user.FindInfo(uid)
+	c := &Collaborator{
+		ID:     lastClientID,
+		UID:    uid,
+		Name:   name,
+		Avatar: avatar,
+		Outbox: make(chan interface{}, 256),
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	others := []Collaborator{}
+	for _, one := range s.members {
+		others = append(others, one.copy())
+	}
+
+	s.broadcast(map[string]interface{}{"type": "join", "client": c.copy()})
+	s.members[c.ID] = c
+	c.Outbox <- map[string]interface{}{
+		"type":    "init",
+		"self":    c.ID,
+		"rev":     len(s.history),
+		"content": s.content,
+		"clients": others,
+	}
+
+	return s, c
+}
+
+// Leave this session. Session saves its content and stops after the last
+// collaborator left. If saving fails, session is kept and saved again by its
+// snapshot loop, so that edits are not lost.
+func (s *Session) Leave(c *Collaborator) {
+	sessionsLock.Lock()
+	defer sessionsLock.Unlock()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.members[c.ID]; ok {
+		s.remove(c)
+		s.broadcast(map[string]interface{}{"type": "leave", "client": c.ID})
+	}
+
+	if len(s.members) == 0 && sessions[s.doc.ID] == s && s.snapshot() == nil {
+		s.close()
+	}
+}
+
+// Apply an operation sent by collaborator. The operation is based on the
+// given revision, and will be transformed against all operations applied
+// after that revision.
+func (s *Session) Apply(c *Collaborator, rev int, op ot.Operation) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if rev < 0 || rev > len(s.history) {
+		return errors.New("无效的文档版本")
+	}
+
+	var err error
+	for _, applied := range s.history[rev:] {
+		if _, op, err = ot.Transform(applied, op); err != nil {
+			return err
+		}
+	}
+
+	content, err := op.Apply(s.content)
+	if err != nil {
+		return err
+	}
+
+	s.content = content
+	s.history = append(s.history, op)
+	s.editor = c.UID
+	s.dirty = true
+
+	for _, one := range s.members {
+		if one.Cursor != nil {
+			one.Cursor.Anchor = op.TransformIndex(one.Cursor.Anchor)
+			one.Cursor.Head = op.TransformIndex(one.Cursor.Head)
+		}
+	}
+
+	s.send(c, map[string]interface{}{"type": "ack", "rev": len(s.history)})
+	for _, one := range s.members {
+		if one != c {
+			s.send(one, map[string]interface{}{
+				"type":   "op",
+				"rev":    len(s.history),
+				"op":     op,
+				"client": c.ID,
+			})
+		}
+	}
+
+	return nil
+}
+
+// MoveCursor updates selection of collaborator and tells others. The cursor
+// is based on the given revision.
+func (s *Session) MoveCursor(c *Collaborator, rev int, cursor *Cursor) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if rev < 0 || rev > len(s.history) {
+		return
+	}
+
+	for _, applied := range s.history[rev:] {
+		cursor.Anchor = applied.TransformIndex(cursor.Anchor)
+		cursor.Head = applied.TransformIndex(cursor.Head)
+	}
+
+	c.Cursor = cursor
+	s.broadcast(map[string]interface{}{
+		"type":   "cursor",
+		"client": c.ID,
+		"cursor": *cursor,
+	})
+}
+
+// copy returns a snapshot of this collaborator which is safe to be encoded
+// outside of session lock.
+func (c *Collaborator) copy() Collaborator {
+	ret := *c
+	if c.Cursor != nil {
+		cursor := *c.Cursor
+		ret.Cursor = &cursor
+	}
+
+	return ret
+}
+
+func (s *Session) snapshotLoop() {
+	ticker := time.NewTicker(SnapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.lock.Lock()
+			err := s.snapshot()
+			idle := len(s.members) == 0
+			s.lock.Unlock()
+
+			// Session left by all collaborators but failed to save.
+			if err == nil && idle {
+				s.closeIfIdle()
+			}
+		}
+	}
+}
+
+// closeIfIdle stops this session if nobody joined again and content is saved.
+func (s *Session) closeIfIdle() {
+	sessionsLock.Lock()
+	defer sessionsLock.Unlock()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.members) == 0 && !s.dirty && sessions[s.doc.ID] == s {
+		s.close()
+	}
+}
+
+// close stops this session. Both sessionsLock and lock must be held.
+func (s *Session) close() {
+	close(s.stop)
+	delete(sessions, s.doc.ID)
+}
+
+// snapshot saves current content as a revision. Lock must be held.
+func (s *Session) snapshot() error {
+	if !s.dirty {
+		return nil
+	}
+
+	// Title may be changed during session, so always save on latest record.
+	doc, err := Find(s.doc.ID)
+	if err == orm.ErrNotFound {
+		// Document has been deleted. Nothing to save.
+		s.dirty = false
+		return nil
+	}
+
+	if err == nil {
+		_, err = doc.SetContent(s.editor, doc.Version, s.content)
+	}
+
+	if err != nil {
+		log.Printf("Save collaborative document %d failed, will retry. Reason: %v\n", s.doc.ID, err)
+		return err
+	}
+
+	s.dirty = false
+	return nil
+}
+
+// broadcast message to all collaborators. Lock must be held.
+func (s *Session) broadcast(msg interface{}) {
+	for _, one := range s.members {
+		s.send(one, msg)
+	}
+}
+
+// send message to collaborator. Collaborators too slow to receive messages
+// are kicked out. Lock must be held.
+func (s *Session) send(c *Collaborator, msg interface{}) {
+	select {
+	case c.Outbox <- msg:
+	default:
+		s.remove(c)
+	}
+}
+
+func (s *Session) remove(c *Collaborator) {
+	if _, ok := s.members[c.ID]; ok {
+		delete(s.members, c.ID)
+		close(c.Outbox)
+	}
+}
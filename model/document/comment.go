@@ -0,0 +1,298 @@
+package document
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"team/common/orm"
+	"team/model/notice"
+	"team/model/user"
+)
+
+// Document events used in notices.
+const (
+	EventComment        = 0
+	EventReplyComment   = 1
+	EventResolveComment = 2
+)
+
+type (
+	// DocComment schema. Root comments may be anchored to a heading or a
+	// range of content, and resolved when discussion is done. Replies are
+	// threaded under root comments.
+	DocComment struct {
+		ID         int64     `json:"id"`
+		DID        int64     `json:"did" orm:"index"`
+		UID        int64     `json:"uid"`
+		Parent     int64     `json:"parent" orm:"notnull,default=0"`
+		Time       time.Time `json:"time" orm:"default=CURRENT_TIMESTAMP"`
+		Heading    string    `json:"heading" orm:"type=VARCHAR(128)"`
+		Start      int32     `json:"start" orm:"notnull,default=0"`
+		End        int32     `json:"end" orm:"notnull,default=0"`
+		Quote      string    `json:"quote"`
+		IsResolved bool      `json:"isResolved" orm:"notnull,default=0"`
+		Resolver   int64     `json:"resolver" orm:"notnull,default=0"`
+		Content    string    `json:"content"`
+	}
+
+	// Anchor locates the part of document a comment talks about. Start and
+	// End are character offsets in content. Empty anchor means the whole
+	// document.
+	Anchor struct {
+		Heading string
+		Start   int32
+		End     int32
+	}
+)
+
+var headingLine = regexp.MustCompile(`^ {0,3}#{1,6}[ \t]+(.*?)(?:[ \t]+#+)?[ \t]*$`)
+
+// FindComment returns comment of this document by ID.
+func (d *Document) FindComment(cid int64) *DocComment {
+	c := &DocComment{ID: cid}
+	if err := orm.Read(c); err != nil || c.DID != d.ID {
+		return nil
+	}
+
+	return c
+}
+
+// AddComment on this document. Replies to a reply are threaded under the root
+// comment and can not be anchored. Author and last modifier of document, and
+// author of the replied thread are notified.
+func (d *Document) AddComment(uid, parent int64, anchor *Anchor, content string) (*DocComment, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, errors.New("评论内容不可为空")
+	}
+
+	add := &DocComment{
+		DID:     d.ID,
+		UID:     uid,
+		Time:    time.Now(),
+		Content: content,
+	}
+
+	notify := []int64{d.Author, d.Modifier}
+	ev := int8(EventComment)
+
+	if parent > 0 {
+		root := d.FindComment(parent)
+		if root == nil {
+			return nil, errors.New("回复的评论不存在或已删除")
+		}
+
+		if root.Parent > 0 {
+			if root = d.FindComment(root.Parent); root == nil {
+				return nil, errors.New("回复的评论不存在或已删除")
+			}
+		}
+
+		add.Parent = root.ID
+		notify = append(notify, root.UID)
+		ev = EventReplyComment
+	} else if anchor != nil {
+		if err := add.setAnchor(d.Content, anchor); err != nil {
+			return nil, err
+		}
+	}
+
+	rs, err := orm.Insert(add)
+	if err != nil {
+		return nil, err
+	}
+
+	add.ID, _ = rs.LastInsertId()
+
+	notified := map[int64]bool{uid: true}
+	for _, to := range notify {
+		if to > 0 && !notified[to] {
+			notified[to] = true
+			notice.AddDocument(d.ID, uid, to, ev)
+		}
+	}
+
+	return add, nil
+}
+
+// GetComments returns all comments of this document. Replies are nested in
+// their root comment.
+func (d *Document) GetComments() []map[string]interface{} {
+	list := []map[string]interface{}{}
+
+	rows, err := orm.Query("SELECT * FROM `doccomment` WHERE `did`=? ORDER BY `id`", d.ID)
+	if err != nil {
+		return list
+	}
+
+	defer rows.Close()
+
+	threads := map[int64][]map[string]interface{}{}
+	roots := []*DocComment{}
+
+	for rows.Next() {
+		one := &DocComment{}
+		if err = orm.Scan(rows, one); err != nil {
+			return list
+		}
+
+		if one.Parent > 0 {
+			threads[one.Parent] = append(threads[one.Parent], one.info())
+		} else {
+			roots = append(roots, one)
+		}
+	}
+
+	for _, one := range roots {
+		replies, ok := threads[one.ID]
+		if !ok {
+			replies = []map[string]interface{}{}
+		}
+
+		info := one.info()
+		info["replies"] = replies
+		list = append(list, info)
+	}
+
+	return list
+}
+
+// Edit content of this comment. Anchor is kept.
+func (c *DocComment) Edit(content string) error {
+	if strings.TrimSpace(content) == "" {
+		return errors.New("评论内容不可为空")
+	}
+
+	if _, err := orm.Exec("UPDATE `doccomment` SET `content`=? WHERE `id`=?", content, c.ID); err != nil {
+		return err
+	}
+
+	c.Content = content
+	return nil
+}
+
+// SetResolved marks discussion of this comment as resolved or reopens it.
+// Author of the comment is notified when others resolve it.
+func (c *DocComment) SetResolved(operator int64, resolved bool) error {
+	if c.Parent > 0 {
+		return errors.New("只能解决顶层评论")
+	}
+
+	if c.IsResolved == resolved {
+		return nil
+	}
+
+	resolver := int64(0)
+	if resolved {
+		resolver = operator
+	}
+
+	_, err := orm.Exec("UPDATE `doccomment` SET `isresolved`=?,`resolver`=? WHERE `id`=?", resolved, resolver, c.ID)
+	if err != nil {
+		return err
+	}
+
+	c.IsResolved = resolved
+	c.Resolver = resolver
+
+	if resolved && c.UID != operator {
+		notice.AddDocument(c.DID, operator, c.UID, EventResolveComment)
+	}
+
+	return nil
+}
+
+// Delete this comment and its replies.
+func (c *DocComment) Delete() {
+	orm.Exec("DELETE FROM `doccomment` WHERE `id`=? OR `parent`=?", c.ID, c.ID)
+}
+
+// setAnchor validates anchor against content and keeps quoted text, so that
+// comment can be located after content changes.
+func (c *DocComment) setAnchor(content string, anchor *Anchor) error {
+	heading := strings.TrimSpace(anchor.Heading)
+	if heading != "" && anchor.End > anchor.Start {
+		return errors.New("评论只能关联一个标题或一段文字")
+	}
+
+	if heading != "" {
+		for _, one := range headings(content) {
+			if one == heading {
+				c.Heading = heading
+				return nil
+			}
+		}
+
+		return errors.New("文档中不存在该标题")
+	}
+
+	if anchor.End <= anchor.Start {
+		return nil
+	}
+
+	chars := []rune(content)
+	if anchor.Start < 0 || int(anchor.End) > len(chars) {
+		return errors.New("选中的文字不在文档范围内")
+	}
+
+	c.Start = anchor.Start
+	c.End = anchor.End
+	c.Quote = string(chars[anchor.Start:anchor.End])
+	return nil
+}
+
+func (c *DocComment) info() map[string]interface{} {
+	name, avatar := user.FindInfo(c.UID)
+	resolver := ""
+	if c.IsResolved {
+		resolver, _ = user.FindInfo(c.Resolver)
+	}
+
+	return map[string]interface{}{
+		"id":         c.ID,
+		"uid":        c.UID,
+		"parent":     c.Parent,
+		"time":       c.Time.Format("2006-01-02 15:04:05"),
+		"user":       name,
+		"avatar":     avatar,
+		"heading":    c.Heading,
+		"start":      c.Start,
+		"end":        c.End,
+		"quote":      c.Quote,
+		"isResolved": c.IsResolved,
+		"resolver":   resolver,
+		"content":    c.Content,
+	}
+}
+
+// headings returns titles of ATX headings in content. Lines in fenced code
+// are skipped.
+func headings(content string) []string {
+	list := []string{}
+	fence := ""
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		trimmed := strings.TrimLeft(line, " ")
+
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+
+		if m := headingLine.FindStringSubmatch(line); m != nil && m[1] != "" {
+			list = append(list, m[1])
+		}
+	}
+
+	return list
+}
@@ -5,6 +5,8 @@ import (
 	"time"
 
 	"team/common/orm"
+	"team/model/link"
+	"team/model/search"
 	"team/model/user"
 )
 
@@ -13,25 +15,57 @@ type (
 	Document struct {
 		ID       int64     `json:"id"`
 		Parent   int64     `json:"parent" orm:"default='-1'"`
+		PID      int64     `json:"pid" orm:"notnull,default=0"`
+		Sort     int32     `json:"sort" orm:"notnull,default=0"`
 		Title    string    `json:"title" orm:"type=VARCHAR(64),notnull"`
 		Author   int64     `json:"author"`
 		Modifier int64     `json:"modifier"`
 		Time     time.Time `json:"time" orm:"default=CURRENT_TIMESTAMP"`
+		Version  int64     `json:"version" orm:"notnull,default=0"`
 		Content  string    `json:"content"`
 	}
 )
 
-// GetAll returns all documents from db.
-func GetAll() ([]map[string]interface{}, error) {
+// ErrConflict means document has been modified by others since it was read.
+var ErrConflict = errors.New("文档已被他人修改，请合并最新内容后重试")
+
+// GetAll returns all documents readable to given user. Documents whose
+// parent is invisible are attached to the nearest visible ancestor.
+func GetAll(uid int64) ([]map[string]interface{}, error) {
 	docs := []map[string]interface{}{}
 
-	rows, err := orm.Query("SELECT * FROM `document`")
+	me := user.Find(uid)
+	if me == nil {
+		return docs, errors.New("用户不存在")
+	}
+
+	perms := map[int64][]*Permission{}
+	rows, err := orm.Query("SELECT * FROM `permission`")
+	if err != nil {
+		return docs, err
+	}
+
+	for rows.Next() {
+		one := &Permission{}
+		if err = orm.Scan(rows, one); err != nil {
+			rows.Close()
+			return docs, err
+		}
+
+		perms[one.DID] = append(perms[one.DID], one)
+	}
+
+	rows.Close()
+
+	rows, err = orm.Query("SELECT * FROM `document` ORDER BY `sort`,`id`")
 	if err != nil {
 		return docs, err
 	}
 
 	defer rows.Close()
 
+	all := map[int64]*Document{}
+	visible := []*Document{}
 	for rows.Next() {
 		one := &Document{}
 
@@ -39,12 +73,39 @@ func GetAll() ([]map[string]interface{}, error) {
 			return docs, err
 		}
 
+		all[one.ID] = one
+		if read, _ := one.access(me, perms[one.ID]); read {
+			visible = append(visible, one)
+		}
+	}
+
+	readable := map[int64]bool{}
+	for _, one := range visible {
+		readable[one.ID] = true
+	}
+
+	for _, one := range visible {
+		parent := one.Parent
+		for depth := 0; parent != -1 && !readable[parent]; depth++ {
+			if depth > len(all) {
+				parent = -1
+				break
+			}
+
+			if p, ok := all[parent]; ok {
+				parent = p.Parent
+			} else {
+				parent = -1
+			}
+		}
+
 		creator, _ := user.FindInfo(one.Author)
 		modifier, _ := user.FindInfo(one.Modifier)
 
 		docs = append(docs, map[string]interface{}{
 			"id":       one.ID,
-			"parent":   one.Parent,
+			"parent":   parent,
+			"pid":      one.PID,
 			"title":    one.Title,
 			"creator":  creator,
 			"modifier": modifier,
@@ -62,8 +123,9 @@ func Find(ID int64) (*Document, error) {
 	return doc, err
 }
 
-// Add a new document.
-func Add(creator, parent int64, title string) error {
+// Add a new document with initial content. Zero pid means this document does
+// not belong to any project.
+func Add(creator, parent, pid int64, title, content string) error {
 	rows, err := orm.Query("SELECT COUNT(*) FROM `document` WHERE `parent`=? AND `title`=?", parent, title)
 	if err != nil {
 		return err
@@ -78,31 +140,118 @@ func Add(creator, parent int64, title string) error {
 		return errors.New("同级目录下已存在同名文档")
 	}
 
-	_, err = orm.Insert(&Document{
+	siblings, err := GetChildren(parent)
+	if err != nil {
+		return err
+	}
+
+	add := &Document{
 		Parent:   parent,
+		PID:      pid,
+		Sort:     int32(len(siblings)),
 		Title:    title,
 		Author:   creator,
 		Modifier: creator,
 		Time:     time.Now(),
-		Content:  "",
-	})
+		Content:  content,
+	}
+
+	rs, err := orm.Insert(add)
+	if err != nil {
+		return err
+	}
 
-	return err
+	add.ID, _ = rs.LastInsertId()
+	add.reindex()
+	link.Refresh(add.Title)
+	return nil
 }
 
-// Delete a document.
-func Delete(ID int64) {
-	doc := &Document{ID: ID}
-	err := orm.Read(doc)
+// Delete a document. When subtree is true, all its descendants are deleted
+// too. Otherwise its children are moved to its parent.
+func Delete(ID int64, subtree bool) error {
+	doc, err := Find(ID)
+	if err != nil {
+		return nil
+	}
+
+	targets := []*Document{doc}
+	if subtree {
+		if targets, err = doc.Subtree(); err != nil {
+			return err
+		}
+	}
+
+	tx, err := orm.Begin()
 	if err != nil {
-		return
+		return err
+	}
+
+	if !subtree {
+		if err = doc.liftChildren(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	for _, one := range targets {
+		for _, sql := range []string{
+			"DELETE FROM `history` WHERE `did`=?",
+			"DELETE FROM `permission` WHERE `did`=?",
+			"DELETE FROM `doccomment` WHERE `did`=?",
+			"DELETE FROM `notice` WHERE `did`=?",
+			"DELETE FROM `document` WHERE `id`=?",
+		} {
+			if _, err = tx.Exec(sql, one.ID); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, one := range targets {
+		search.Remove(search.KindDocument, one.ID)
+		link.Remove(search.KindDocument, one.ID)
+		link.Refresh(one.Title)
 	}
 
-	orm.Exec("UPDATE `document` SET `parent`=? WHERE `parent`=?", doc.Parent, ID)
-	orm.Delete("document", ID)
+	return nil
 }
 
-// Save modified document.
+// Save modified title, project and modifier of this document. Content is
+// saved by SetContent, so version is left unchanged.
 func (d *Document) Save() error {
-	return orm.Update(d)
+	_, err := orm.Exec(
+		"UPDATE `document` SET `title`=?,`pid`=?,`modifier`=?,`time`=? WHERE `id`=?",
+		d.Title, d.PID, d.Modifier, d.Time, d.ID)
+	if err != nil {
+		return err
+	}
+
+	d.reindex()
+	return nil
+}
+
+// Rename this document. References by title to both old and new title are
+// resolved again.
+func (d *Document) Rename(operator int64, title string) error {
+	old := d.Title
+
+	d.Title = title
+	d.Modifier = operator
+	d.Time = time.Now()
+	if err := d.Save(); err != nil {
+		return err
+	}
+
+	if old != title {
+		link.Refresh(old)
+		link.Refresh(title)
+	}
+
+	return nil
 }
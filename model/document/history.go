@@ -0,0 +1,172 @@
+package document
+
+import (
+	"errors"
+	"time"
+
+	"team/common/diff"
+	"team/common/orm"
+	"team/config"
+	"team/model/user"
+)
+
+type (
+	// History schema. Holds one saved revision of document content.
+	History struct {
+		ID      int64     `json:"id"`
+		DID     int64     `json:"did"`
+		UID     int64     `json:"uid"`
+		Time    time.Time `json:"time" orm:"default=CURRENT_TIMESTAMP"`
+		Size    int32     `json:"size"`
+		Content string    `json:"content" orm:"type=MEDIUMTEXT"`
+	}
+)
+
+// SetContent saves new content of this document and records it as a revision.
+// The version should be the one which content is based on. Returns
+// ErrConflict when content has been modified by others since then.
+func (d *Document) SetContent(operator, version int64, content string) (*History, error) {
+	now := time.Now()
+	rs, err := orm.Exec(
+		"UPDATE `document` SET `content`=?,`modifier`=?,`time`=?,`version`=`version`+1 WHERE `id`=? AND `version`=?",
+		content, operator, now, d.ID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if affected, err := rs.RowsAffected(); err != nil {
+		return nil, err
+	} else if affected == 0 {
+		return nil, ErrConflict
+	}
+
+	old := d.Content
+	oldModifier := d.Modifier
+
+	d.Version = version + 1
+	d.Content = content
+	d.Modifier = operator
+	d.Time = now
+	d.reindex()
+
+	return d.addHistory(operator, oldModifier, old, content)
+}
+
+// FindHistory returns revision of this document by ID.
+func (d *Document) FindHistory(hid int64) *History {
+	rev := &History{ID: hid}
+	if err := orm.Read(rev); err != nil || rev.DID != d.ID {
+		return nil
+	}
+
+	return rev
+}
+
+// GetHistories returns all revisions of this document. Latest first.
+func (d *Document) GetHistories() []map[string]interface{} {
+	list := []map[string]interface{}{}
+
+	rows, err := orm.Query("SELECT `id`,`did`,`uid`,`time`,`size` FROM `history` WHERE `did`=? ORDER BY `id` DESC", d.ID)
+	if err != nil {
+		return list
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		one := &History{}
+		if err = orm.Scan(rows, one); err != nil {
+			return list
+		}
+
+		list = append(list, one.Brief())
+	}
+
+	return list
+}
+
+// DiffHistories returns line-based diff between two revisions.
+func (d *Document) DiffHistories(from, to int64) ([]diff.Line, error) {
+	a := d.FindHistory(from)
+	b := d.FindHistory(to)
+	if a == nil || b == nil {
+		return nil, errors.New("指定版本不存在")
+	}
+
+	return diff.Lines(a.Content, b.Content), nil
+}
+
+// RestoreHistory saves content of given revision as a new revision.
+func (d *Document) RestoreHistory(operator, hid int64) (*History, error) {
+	rev := d.FindHistory(hid)
+	if rev == nil {
+		return nil, errors.New("指定版本不存在")
+	}
+
+	return d.SetContent(operator, d.Version, rev.Content)
+}
+
+// Brief returns brief information of this revision.
+func (h *History) Brief() map[string]interface{} {
+	name, _ := user.FindInfo(h.UID)
+
+	return map[string]interface{}{
+		"id":     h.ID,
+		"time":   h.Time.Format("2006-01-02 15:04:05"),
+		"author": name,
+		"size":   h.Size,
+	}
+}
+
+// addHistory records new content. For documents saved before history is
+// supported, previous content is saved as the first revision. Old revisions
+// beyond retention setting are removed.
+func (d *Document) addHistory(operator, oldModifier int64, old, content string) (*History, error) {
+	rows, err := orm.Query("SELECT COUNT(*) FROM `history` WHERE `did`=?", d.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	count := 0
+	rows.Next()
+	rows.Scan(&count)
+	rows.Close()
+
+	now := time.Now()
+	if count == 0 && old != "" && old != content {
+		_, err = orm.Insert(&History{
+			DID:     d.ID,
+			UID:     oldModifier,
+			Time:    now,
+			Size:    int32(len(old)),
+			Content: old,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	add := &History{
+		DID:     d.ID,
+		UID:     operator,
+		Time:    now,
+		Size:    int32(len(content)),
+		Content: content,
+	}
+
+	rs, err := orm.Insert(add)
+	if err != nil {
+		return nil, err
+	}
+
+	add.ID, _ = rs.LastInsertId()
+
+	if retention := config.Document.Retention; retention > 0 {
+		orm.Exec(
+			"DELETE FROM `history` WHERE `did`=? AND `id` NOT IN (SELECT `id` FROM (SELECT `id` FROM `history` WHERE `did`=? ORDER BY `id` DESC LIMIT ?) AS `keep`)",
+			d.ID, d.ID, retention)
+	}
+
+	return add, nil
+}
@@ -0,0 +1,190 @@
+package document
+
+import (
+	"errors"
+
+	"team/common/orm"
+	"team/model/project"
+	"team/model/user"
+)
+
+// Kinds of permission target.
+const (
+	PermitUser = 0
+	PermitRole = 1
+)
+
+type (
+	// Permission schema. Grants a user or a role in document's project
+	// access to a document.
+	Permission struct {
+		ID     int64 `json:"id"`
+		DID    int64 `json:"did"`
+		Kind   int8  `json:"kind"`
+		Target int64 `json:"target"`
+		Write  bool  `json:"write"`
+	}
+)
+
+// GetPermissions returns explicit permissions of this document.
+func (d *Document) GetPermissions() []*Permission {
+	list := []*Permission{}
+
+	rows, err := orm.Query("SELECT * FROM `permission` WHERE `did`=?", d.ID)
+	if err != nil {
+		return list
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		one := &Permission{}
+		if err = orm.Scan(rows, one); err != nil {
+			return list
+		}
+
+		list = append(list, one)
+	}
+
+	return list
+}
+
+// SetPermission grants user or role access to this document. Existing
+// permission of the same target is replaced.
+func (d *Document) SetPermission(kind int8, target int64, write bool) error {
+	switch kind {
+	case PermitUser:
+		if user.Find(target) == nil {
+			return errors.New("指定用户不存在")
+		}
+	case PermitRole:
+		if d.PID == 0 {
+			return errors.New("未关联项目的文档不可按角色授权")
+		}
+	default:
+		return errors.New("无效的授权类型")
+	}
+
+	orm.Exec("DELETE FROM `permission` WHERE `did`=? AND `kind`=? AND `target`=?", d.ID, kind, target)
+
+	_, err := orm.Insert(&Permission{
+		DID:    d.ID,
+		Kind:   kind,
+		Target: target,
+		Write:  write,
+	})
+
+	return err
+}
+
+// DelPermission removes explicit permission of this document.
+func (d *Document) DelPermission(id int64) {
+	orm.Exec("DELETE FROM `permission` WHERE `id`=? AND `did`=?", id, d.ID)
+}
+
+// SetProject moves this document into given project. Zero means this
+// document does not belong to any project.
+func (d *Document) SetProject(pid int64) error {
+	if pid != 0 && project.Find(pid) == nil {
+		return errors.New("指定项目不存在")
+	}
+
+	d.PID = pid
+	if err := d.Save(); err != nil {
+		return err
+	}
+
+	// Roles are defined by project, so they are meaningless after moving.
+	orm.Exec("DELETE FROM `permission` WHERE `did`=? AND `kind`=?", d.ID, PermitRole)
+	return nil
+}
+
+// CanManage tests if given user can change project or permissions of this
+// document, which is allowed to super users, author and project admins.
+func (d *Document) CanManage(uid int64) bool {
+	return d.canManage(user.Find(uid))
+}
+
+// Access returns if given user can read or write this document.
+func (d *Document) Access(uid int64) (bool, bool) {
+	return d.access(user.Find(uid), d.GetPermissions())
+}
+
+func (d *Document) canManage(u *user.User) bool {
+	if u == nil {
+		return false
+	}
+
+	if u.IsSu || d.Author == u.ID {
+		return true
+	}
+
+	if d.PID == 0 {
+		return false
+	}
+
+	proj := project.Find(d.PID)
+	return proj != nil && proj.IsAdmin(u.ID)
+}
+
+// access checks permission by following rules:
+//  1. managers have full access.
+//  2. with explicit permissions, only listed users and roles are allowed.
+//  3. project documents are accessible to project members.
+//  4. otherwise everyone has full access.
+func (d *Document) access(u *user.User, perms []*Permission) (bool, bool) {
+	if u == nil {
+		return false, false
+	}
+
+	if d.canManage(u) {
+		return true, true
+	}
+
+	var proj *project.Project
+	if d.PID != 0 {
+		proj = project.Find(d.PID)
+	}
+
+	// Document of a deleted project is treated as not belonging to any
+	// project, so only permissions granted to users are kept.
+	if d.PID != 0 && proj == nil {
+		granted := []*Permission{}
+		for _, one := range perms {
+			if one.Kind == PermitUser {
+				granted = append(granted, one)
+			}
+		}
+
+		perms = granted
+	}
+
+	if len(perms) > 0 {
+		role := int64(-1)
+		if proj != nil {
+			for _, one := range proj.Members {
+				if one.UID == u.ID {
+					role = int64(one.Role)
+					break
+				}
+			}
+		}
+
+		read, write := false, false
+		for _, one := range perms {
+			if (one.Kind == PermitUser && one.Target == u.ID) || (one.Kind == PermitRole && one.Target == role) {
+				read = true
+				write = write || one.Write
+			}
+		}
+
+		return read, write
+	}
+
+	if proj != nil {
+		member := proj.HasMember(u.ID)
+		return member, member
+	}
+
+	return true, true
+}
@@ -0,0 +1,103 @@
+package document
+
+import (
+	"team/common/orm"
+	"team/model/link"
+	"team/model/search"
+)
+
+func init() {
+	link.ResolveTitle = findByTitle
+	link.Register(search.KindDocument, func(pattern string, fn func(source, pid int64, content string)) error {
+		rows, err := orm.Query("SELECT `id`,`pid`,`content` FROM `document` WHERE `content` LIKE ?", pattern)
+		if err != nil {
+			return err
+		}
+
+		defer rows.Close()
+
+		for rows.Next() {
+			var id, pid int64
+			var content string
+			if err = rows.Scan(&id, &pid, &content); err != nil {
+				return err
+			}
+
+			fn(id, pid, content)
+		}
+
+		return nil
+	})
+
+	search.Register(search.KindDocument, &search.Source{
+		Each: func(fn func(target int64, title, content string)) error {
+			rows, err := orm.Query("SELECT `id`,`title`,`content` FROM `document`")
+			if err != nil {
+				return err
+			}
+
+			defer rows.Close()
+
+			for rows.Next() {
+				var id int64
+				var title, content string
+				if err = rows.Scan(&id, &title, &content); err != nil {
+					return err
+				}
+
+				fn(id, title, content)
+			}
+
+			return nil
+		},
+		Resolve: func(target, uid int64) *search.Entry {
+			doc, err := Find(target)
+			if err != nil {
+				return nil
+			}
+
+			if read, _ := doc.Access(uid); !read {
+				return nil
+			}
+
+			return &search.Entry{
+				Title:   doc.Title,
+				Content: doc.Content,
+				Extra: map[string]interface{}{
+					"pid":  doc.PID,
+					"time": doc.Time.Format("2006-01-02 15:04"),
+				},
+			}
+		},
+	})
+}
+
+// reindex updates search index and references of this document.
+func (d *Document) reindex() {
+	search.Index(search.KindDocument, d.ID, d.Title, d.Content)
+	link.Update(search.KindDocument, d.ID, d.PID, d.Content)
+}
+
+// GetBacklinks returns tasks, comments and documents referencing this
+// document and visible to given user.
+func (d *Document) GetBacklinks(uid int64) []map[string]interface{} {
+	return link.Backlinks(search.KindDocument, d.ID, uid)
+}
+
+// findByTitle returns ID of document with given title. Documents in given
+// project are preferred, then the earliest created one.
+func findByTitle(title string, pid int64) int64 {
+	rows, err := orm.Query("SELECT `id` FROM `document` WHERE `title`=? ORDER BY `pid`<>?,`id` LIMIT 1", title, pid)
+	if err != nil {
+		return 0
+	}
+
+	defer rows.Close()
+
+	var id int64
+	if rows.Next() {
+		rows.Scan(&id)
+	}
+
+	return id
+}
@@ -0,0 +1,190 @@
+package document
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"team/common/orm"
+	"team/model/project"
+	"team/model/user"
+)
+
+type (
+	// Template schema. Initial content of new documents. Templates with zero
+	// PID are global, others are only available in their project.
+	Template struct {
+		ID      int64     `json:"id"`
+		PID     int64     `json:"pid" orm:"notnull,default=0"`
+		Name    string    `json:"name" orm:"type=VARCHAR(64),notnull"`
+		Author  int64     `json:"author"`
+		Time    time.Time `json:"time" orm:"default=CURRENT_TIMESTAMP"`
+		Content string    `json:"content"`
+	}
+)
+
+// Placeholders supported in template content.
+var Placeholders = map[string]string{
+	"{{date}}":     "创建日期，如 2006-01-02",
+	"{{time}}":     "创建时间，如 15:04",
+	"{{datetime}}": "创建日期和时间",
+	"{{weekday}}":  "创建日是星期几",
+	"{{author}}":   "创建者名称",
+	"{{project}}":  "所属项目名称",
+	"{{title}}":    "文档标题",
+}
+
+var weekdays = []string{"星期日", "星期一", "星期二", "星期三", "星期四", "星期五", "星期六"}
+
+// GetTemplates returns templates available to documents in given project,
+// including global ones. Zero PID returns only global templates.
+func GetTemplates(pid int64) []*Template {
+	list := []*Template{}
+
+	rows, err := orm.Query("SELECT * FROM `template` WHERE `pid`=0 OR `pid`=? ORDER BY `pid`,`name`", pid)
+	if err != nil {
+		return list
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		one := &Template{}
+		if err = orm.Scan(rows, one); err != nil {
+			return list
+		}
+
+		list = append(list, one)
+	}
+
+	return list
+}
+
+// FindTemplate returns template by ID.
+func FindTemplate(tid int64) *Template {
+	tpl := &Template{ID: tid}
+	if err := orm.Read(tpl); err != nil {
+		return nil
+	}
+
+	return tpl
+}
+
+// AddTemplate creates a new template in given project, or a global one if
+// PID is zero.
+func AddTemplate(author, pid int64, name, content string) (*Template, error) {
+	if pid != 0 && project.Find(pid) == nil {
+		return nil, errors.New("指定项目不存在")
+	}
+
+	add := &Template{
+		PID:     pid,
+		Name:    name,
+		Author:  author,
+		Time:    time.Now(),
+		Content: content,
+	}
+
+	if err := add.checkName(); err != nil {
+		return nil, err
+	}
+
+	rs, err := orm.Insert(add)
+	if err != nil {
+		return nil, err
+	}
+
+	add.ID, _ = rs.LastInsertId()
+	return add, nil
+}
+
+// Edit name and content of this template.
+func (t *Template) Edit(name, content string) error {
+	edited := *t
+	edited.Name = name
+	edited.Content = content
+	edited.Time = time.Now()
+
+	if err := edited.checkName(); err != nil {
+		return err
+	}
+
+	if err := orm.Update(&edited); err != nil {
+		return err
+	}
+
+	*t = edited
+	return nil
+}
+
+// Delete this template. Documents created from it are not affected.
+func (t *Template) Delete() {
+	orm.Delete("template", t.ID)
+}
+
+// CanManage tests if given user can edit this template. Global templates are
+// managed by super users, project templates by project admins.
+func (t *Template) CanManage(uid int64) bool {
+	if me := user.Find(uid); me != nil && me.IsSu {
+		return true
+	}
+
+	if t.PID == 0 {
+		return false
+	}
+
+	proj := project.Find(t.PID)
+	return proj != nil && proj.IsAdmin(uid)
+}
+
+// IsAvailable tests if this template can be used by documents in given
+// project.
+func (t *Template) IsAvailable(pid int64) bool {
+	return t.PID == 0 || t.PID == pid
+}
+
+// Expand fills placeholders with information of the document being created.
+func (t *Template) Expand(creator, pid int64, title string) string {
+	now := time.Now()
+	author, _ := user.FindInfo(creator)
+
+	projName := ""
+	if pid != 0 {
+		if proj := project.Find(pid); proj != nil {
+			projName = proj.Name
+		}
+	}
+
+	return strings.NewReplacer(
+		"{{date}}", now.Format("2006-01-02"),
+		"{{time}}", now.Format("15:04"),
+		"{{datetime}}", now.Format("2006-01-02 15:04"),
+		"{{weekday}}", weekdays[now.Weekday()],
+		"{{author}}", author,
+		"{{project}}", projName,
+		"{{title}}", title,
+	).Replace(t.Content)
+}
+
+// checkName makes sure name is unique in the same scope.
+func (t *Template) checkName() error {
+	if strings.TrimSpace(t.Name) == "" {
+		return errors.New("模板名称不可为空")
+	}
+
+	rows, err := orm.Query("SELECT COUNT(*) FROM `template` WHERE `pid`=? AND `name`=? AND `id`<>?", t.PID, t.Name, t.ID)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	count := 0
+	rows.Next()
+	rows.Scan(&count)
+	if count != 0 {
+		return errors.New("已存在同名模板")
+	}
+
+	return nil
+}
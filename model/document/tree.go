@@ -0,0 +1,174 @@
+package document
+
+import (
+	"errors"
+	"fmt"
+
+	"team/common/orm"
+)
+
+// GetChildren returns direct children of given parent in order.
+func GetChildren(parent int64) ([]*Document, error) {
+	list := []*Document{}
+
+	rows, err := orm.Query("SELECT * FROM `document` WHERE `parent`=? ORDER BY `sort`,`id`", parent)
+	if err != nil {
+		return list, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		one := &Document{}
+		if err = orm.Scan(rows, one); err != nil {
+			return list, err
+		}
+
+		list = append(list, one)
+	}
+
+	return list, nil
+}
+
+// Path returns all ancestors of this document from root, including itself.
+func (d *Document) Path() []*Document {
+	path := []*Document{d}
+	visited := map[int64]bool{d.ID: true}
+
+	parent := d.Parent
+	for parent != -1 && !visited[parent] {
+		one, err := Find(parent)
+		if err != nil {
+			break
+		}
+
+		visited[one.ID] = true
+		path = append([]*Document{one}, path...)
+		parent = one.Parent
+	}
+
+	return path
+}
+
+// Subtree returns this document and all its descendants. Parents always
+// come before their children.
+func (d *Document) Subtree() ([]*Document, error) {
+	list := []*Document{d}
+
+	for i := 0; i < len(list); i++ {
+		children, err := GetChildren(list[i].ID)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, children...)
+	}
+
+	return list, nil
+}
+
+// Move this document under given parent at given position among siblings.
+// Negative index means the last one.
+func (d *Document) Move(parent int64, index int) error {
+	if parent != -1 {
+		target, err := Find(parent)
+		if err != nil {
+			return errors.New("目标文档不存在")
+		}
+
+		for _, one := range target.Path() {
+			if one.ID == d.ID {
+				return errors.New("不可将文档移动到自身或其子文档下")
+			}
+		}
+	}
+
+	siblings, err := GetChildren(parent)
+	if err != nil {
+		return err
+	}
+
+	ordered := []*Document{}
+	for _, one := range siblings {
+		if one.ID == d.ID {
+			continue
+		}
+
+		if one.Title == d.Title {
+			return errors.New("目标目录下已存在同名文档")
+		}
+
+		ordered = append(ordered, one)
+	}
+
+	if index < 0 || index > len(ordered) {
+		index = len(ordered)
+	}
+
+	ordered = append(ordered[:index], append([]*Document{d}, ordered[index:]...)...)
+
+	tx, err := orm.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec("UPDATE `document` SET `parent`=? WHERE `id`=?", parent, d.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for i, one := range ordered {
+		if _, err = tx.Exec("UPDATE `document` SET `sort`=? WHERE `id`=?", i, one.ID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	d.Parent = parent
+	d.Sort = int32(index)
+	return nil
+}
+
+// liftChildren moves children of this document to its parent, in place of
+// this document.
+func (d *Document) liftChildren(tx *orm.Tx) error {
+	children, err := GetChildren(d.ID)
+	if err != nil || len(children) == 0 {
+		return err
+	}
+
+	siblings, err := GetChildren(d.Parent)
+	if err != nil {
+		return err
+	}
+
+	ordered := []*Document{}
+	for _, one := range siblings {
+		if one.ID != d.ID {
+			ordered = append(ordered, one)
+			continue
+		}
+
+		for _, child := range children {
+			for _, other := range siblings {
+				if other.ID != d.ID && other.Title == child.Title {
+					return fmt.Errorf("子文档【%s】与上级目录中的文档重名，请先重命名或移动", child.Title)
+				}
+			}
+
+			ordered = append(ordered, child)
+		}
+	}
+
+	for i, one := range ordered {
+		if _, err = tx.Exec("UPDATE `document` SET `parent`=?,`sort`=? WHERE `id`=?", d.Parent, i, one.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,281 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"time"
+
+	"team/common/orm"
+	"team/model/markup"
+	"team/model/project"
+	"team/model/task"
+	"team/model/user"
+)
+
+type (
+	activity struct {
+		Source string
+		ID     int64
+		TID    int64
+		TName  string
+		UID    int64
+		Kind   int8
+		Time   time.Time
+		Extra  string
+	}
+
+	atomFeed struct {
+		XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+		ID      string      `xml:"id"`
+		Title   string      `xml:"title"`
+		Updated string      `xml:"updated"`
+		Link    atomLink    `xml:"link"`
+		Entries []atomEntry `xml:"entry"`
+	}
+
+	atomEntry struct {
+		ID      string      `xml:"id"`
+		Title   string      `xml:"title"`
+		Updated string      `xml:"updated"`
+		Author  string      `xml:"author>name"`
+		Link    atomLink    `xml:"link"`
+		Content atomContent `xml:"content"`
+	}
+
+	atomLink struct {
+		Href string `xml:"href,attr"`
+	}
+
+	atomContent struct {
+		Type string `xml:"type,attr"`
+		Body string `xml:",chardata"`
+	}
+)
+
+// Activities returns task events and project changes of given project in
+// reverse chronological order. Page starts from 1.
+func Activities(proj *project.Project, page, size int) ([]map[string]interface{}, int, error) {
+	if page < 1 {
+		page = 1
+	}
+
+	if size < 1 || size > 100 {
+		size = 20
+	}
+
+	total := 0
+	rows, err := orm.Query(
+		"SELECT (SELECT COUNT(*) FROM `event` INNER JOIN `task` ON `event`.`tid`=`task`.`id` WHERE `task`.`pid`=?)+"+
+			"(SELECT COUNT(*) FROM `activity` WHERE `pid`=?)", proj.ID, proj.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows.Next()
+	rows.Scan(&total)
+	rows.Close()
+
+	list, err := queryActivities(proj.ID, (page-1)*size, size)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ret := []map[string]interface{}{}
+	for _, one := range list {
+		name, avatar := user.FindInfo(one.UID)
+		item := map[string]interface{}{
+			"source": one.Source,
+			"id":     one.ID,
+			"kind":   one.Kind,
+			"time":   one.Time.Format("2006-01-02 15:04:05"),
+			"extra":  one.Extra,
+			"operator": map[string]interface{}{
+				"id":     one.UID,
+				"name":   name,
+				"avatar": avatar,
+			},
+			"desc": one.describe(),
+		}
+
+		if one.Source == "task" {
+			item["task"] = map[string]interface{}{
+				"id":   one.TID,
+				"name": one.TName,
+			}
+
+			if one.Kind == task.EventComment || one.Kind == task.EventEditComment {
+				item["comment"] = one.content()
+			}
+		}
+
+		ret = append(ret, item)
+	}
+
+	return ret, total, nil
+}
+
+// ActivityAtom renders latest activities of given project as Atom feed for
+// given reader. Comments are rendered as HTML.
+func ActivityAtom(proj *project.Project, reader int64, baseURL string) ([]byte, error) {
+	list, err := queryActivities(proj.ID, 0, 50)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := time.Now()
+	if len(list) > 0 {
+		updated = list[0].Time
+	}
+
+	feed := &atomFeed{
+		ID:      fmt.Sprintf("%s/feed/project/%d", baseURL, proj.ID),
+		Title:   proj.Name + " 项目动态",
+		Updated: updated.Format(time.RFC3339),
+		Link:    atomLink{Href: baseURL},
+		Entries: []atomEntry{},
+	}
+
+	renderer := &markup.Renderer{BaseURL: baseURL, UID: reader}
+	for _, one := range list {
+		operator, _ := user.FindInfo(one.UID)
+		link := baseURL
+		content := atomContent{Type: "text", Body: one.content()}
+		if one.Source == "task" {
+			link = fmt.Sprintf("%s/?task=%d", baseURL, one.TID)
+			if one.Kind == task.EventComment || one.Kind == task.EventEditComment {
+				content = atomContent{Type: "html", Body: renderer.Render(content.Body)}
+			}
+		}
+
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      fmt.Sprintf("%s/feed/%s/%d", baseURL, one.Source, one.ID),
+			Title:   operator + one.describe(),
+			Updated: one.Time.Format(time.RFC3339),
+			Author:  operator,
+			Link:    atomLink{Href: link},
+			Content: content,
+		})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err = encoder.Encode(feed); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func queryActivities(pid int64, offset, limit int) ([]*activity, error) {
+	rows, err := orm.Query(
+		"SELECT 'task' AS `source`,`event`.`id` AS `id`,`event`.`tid` AS `tid`,`task`.`name` AS `tname`,`event`.`uid` AS `uid`,`event`.`event` AS `kind`,`event`.`time` AS `time`,`event`.`extra` AS `extra` "+
+			"FROM `event` INNER JOIN `task` ON `event`.`tid`=`task`.`id` WHERE `task`.`pid`=? "+
+			"UNION ALL SELECT 'project' AS `source`,`id`,0 AS `tid`,'' AS `tname`,`uid`,`kind`,`time`,`extra` FROM `activity` WHERE `pid`=? "+
+			"ORDER BY `time` DESC,`id` DESC LIMIT ? OFFSET ?",
+		pid, pid, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	list := []*activity{}
+	for rows.Next() {
+		one := &activity{}
+		if err = orm.Scan(rows, one); err != nil {
+			return nil, err
+		}
+
+		list = append(list, one)
+	}
+
+	return list, nil
+}
+
+// describe returns readable text of this activity.
+func (a *activity) describe() string {
+	if a.Source == "project" {
+		switch a.Kind {
+		case project.ActivityAddMilestone:
+			return "新建了里程碑：" + a.Extra
+		case project.ActivityEditMilestone:
+			return "修改了里程碑：" + a.Extra
+		case project.ActivityDelMilestone:
+			return "删除了里程碑：" + a.Extra
+		case project.ActivityAddMember:
+			return "添加了成员：" + a.Extra
+		case project.ActivityEditMember:
+			return "修改了成员：" + a.Extra
+		case project.ActivityDelMember:
+			return "移除了成员：" + a.Extra
+		}
+
+		return "修改了项目"
+	}
+
+	prefix := "在任务【" + a.TName + "】中"
+	switch a.Kind {
+	case task.EventCreate:
+		return "创建了任务【" + a.TName + "】"
+	case task.EventModName:
+		return prefix + "修改了任务名，原名：" + a.Extra
+	case task.EventModState:
+		state, _ := strconv.Atoi(a.Extra)
+		if state >= 0 && state < len(task.StateNames) {
+			return prefix + "修改了任务状态为：" + task.StateNames[state]
+		}
+
+		return prefix + "修改了任务状态"
+	case task.EventModTime:
+		return prefix + "修改了任务的时间，原时间：" + a.Extra
+	case task.EventModCreator:
+		return prefix + "移交了任务，原负责人：" + a.Extra
+	case task.EventModDeveloper:
+		return prefix + "修改了任务开发者，原开发者：" + a.Extra
+	case task.EventModTester:
+		return prefix + "修改了任务的测试/验收人员，原人员：" + a.Extra
+	case task.EventModWeight:
+		return prefix + "修改了任务的优先级"
+	case task.EventModContent:
+		return prefix + "修改了任务的具体内容"
+	case task.EventComment:
+		return "评论了任务【" + a.TName + "】"
+	case task.EventEditComment:
+		return prefix + "编辑了评论"
+	case task.EventDelComment:
+		return prefix + "删除了评论"
+	case task.EventAddLabel:
+		return prefix + "添加了标签：" + a.Extra
+	case task.EventDelLabel:
+		return prefix + "移除了标签：" + a.Extra
+	case task.EventModField:
+		return prefix + "修改了自定义字段"
+	case task.EventModEstimate:
+		return prefix + "修改了任务的工作量估算，原估算：" + a.Extra
+	case task.EventModSprint:
+		return prefix + "调整了任务所属迭代"
+	case task.EventAddDepend:
+		return prefix + "添加了前置依赖：" + a.Extra
+	case task.EventDelDepend:
+		return prefix + "移除了前置依赖：" + a.Extra
+	}
+
+	return prefix + "进行了修改"
+}
+
+// content returns detail of this activity. Comment events show its content.
+func (a *activity) content() string {
+	if a.Source == "task" && (a.Kind == task.EventComment || a.Kind == task.EventEditComment) {
+		cid, _ := strconv.ParseInt(a.Extra, 10, 64)
+		if comment := task.FindComment(cid); comment != nil && !comment.IsDeleted {
+			return comment.Comment
+		}
+	}
+
+	return a.describe()
+}
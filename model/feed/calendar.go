@@ -0,0 +1,136 @@
+package feed
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"team/common/orm"
+	"team/model/project"
+	"team/model/task"
+)
+
+// UserCalendar renders milestones of joined projects and open tasks assigned to
+// given user as iCalendar (RFC 5545).
+func UserCalendar(uid int64, name, baseURL string) ([]byte, error) {
+	projs, err := project.GetAllByUser(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks, err := queryTasks("SELECT * FROM `task` WHERE `state`<4 AND (`developer`=? OR `tester`=?)", uid, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	return renderCalendar(name, projs, tasks, baseURL), nil
+}
+
+// ProjectCalendar renders milestones and open tasks of given project as
+// iCalendar (RFC 5545).
+func ProjectCalendar(proj *project.Project, baseURL string) ([]byte, error) {
+	tasks, err := queryTasks("SELECT * FROM `task` WHERE `state`<4 AND `pid`=?", proj.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return renderCalendar(proj.Name, []*project.Project{proj}, tasks, baseURL), nil
+}
+
+func queryTasks(query string, args ...interface{}) ([]*task.Task, error) {
+	rows, err := orm.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	list := []*task.Task{}
+	for rows.Next() {
+		one := &task.Task{}
+		if err = orm.Scan(rows, one); err != nil {
+			return nil, err
+		}
+
+		list = append(list, one)
+	}
+
+	return list, nil
+}
+
+func renderCalendar(name string, projs []*project.Project, tasks []*task.Task, baseURL string) []byte {
+	var buf bytes.Buffer
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+
+	writeLine(&buf, "BEGIN:VCALENDAR")
+	writeLine(&buf, "VERSION:2.0")
+	writeLine(&buf, "PRODID:-//Team//Team Calendar//ZH")
+	writeLine(&buf, "CALSCALE:GREGORIAN")
+	writeLine(&buf, "METHOD:PUBLISH")
+	writeLine(&buf, "X-WR-CALNAME:"+escapeText(name))
+
+	for _, proj := range projs {
+		for _, milestone := range proj.Milestones {
+			writeLine(&buf, "BEGIN:VEVENT")
+			writeLine(&buf, fmt.Sprintf("UID:milestone-%d@team", milestone.ID))
+			writeLine(&buf, "DTSTAMP:"+stamp)
+			writeLine(&buf, "DTSTART;VALUE=DATE:"+milestone.StartTime.Format("20060102"))
+			writeLine(&buf, "DTEND;VALUE=DATE:"+milestone.EndTime.AddDate(0, 0, 1).Format("20060102"))
+			writeLine(&buf, "SUMMARY:"+escapeText("["+proj.Name+"] "+milestone.Name))
+			writeLine(&buf, "DESCRIPTION:"+escapeText(milestone.Desc))
+			writeLine(&buf, "TRANSP:TRANSPARENT")
+			writeLine(&buf, "END:VEVENT")
+		}
+	}
+
+	for _, t := range tasks {
+		link := fmt.Sprintf("%s/?task=%d", baseURL, t.ID)
+		state := ""
+		if int(t.State) < len(task.StateNames) {
+			state = task.StateNames[t.State]
+		}
+
+		summary := "#" + fmt.Sprint(t.ID) + " " + t.Name
+		if proj := project.Find(t.PID); proj != nil {
+			summary = "[" + proj.Name + "] " + summary
+		}
+
+		writeLine(&buf, "BEGIN:VEVENT")
+		writeLine(&buf, fmt.Sprintf("UID:task-%d@team", t.ID))
+		writeLine(&buf, "DTSTAMP:"+stamp)
+		writeLine(&buf, "DTSTART;VALUE=DATE:"+t.EndTime.Format("20060102"))
+		writeLine(&buf, "DTEND;VALUE=DATE:"+t.EndTime.AddDate(0, 0, 1).Format("20060102"))
+		writeLine(&buf, "SUMMARY:"+escapeText(summary))
+		writeLine(&buf, "DESCRIPTION:"+escapeText("状态："+state+"\n"+link))
+		writeLine(&buf, "URL:"+link)
+		writeLine(&buf, "TRANSP:TRANSPARENT")
+		writeLine(&buf, "END:VEVENT")
+	}
+
+	writeLine(&buf, "END:VCALENDAR")
+	return buf.Bytes()
+}
+
+// writeLine writes a content line folded at 75 octets without breaking UTF-8
+// characters.
+func writeLine(buf *bytes.Buffer, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+
+		buf.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		limit = 74
+	}
+
+	buf.WriteString(line + "\r\n")
+}
+
+func escapeText(s string) string {
+	return strings.NewReplacer("\\", "\\\\", ";", "\\;", ",", "\\,", "\r\n", "\\n", "\n", "\\n", "\r", "").Replace(s)
+}
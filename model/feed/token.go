@@ -0,0 +1,116 @@
+package feed
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"team/common/orm"
+)
+
+// Kinds of feed.
+const (
+	KindUserCalendar    = 0
+	KindProjectCalendar = 1
+	KindProjectActivity = 2
+)
+
+type (
+	// Token schema. Secret token in feed URL, which is used by calendar apps
+	// and feed readers that can not login.
+	Token struct {
+		ID     int64     `json:"id"`
+		UID    int64     `json:"uid"`
+		Kind   int8      `json:"kind"`
+		Target int64     `json:"target"`
+		Token  string    `json:"token" orm:"type=CHAR(32),unique,notnull"`
+		Time   time.Time `json:"time" orm:"default=CURRENT_TIMESTAMP"`
+	}
+)
+
+// GetTokens returns all feed tokens created by given user.
+func GetTokens(uid int64) ([]*Token, error) {
+	rows, err := orm.Query("SELECT * FROM `token` WHERE `uid`=?", uid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	list := []*Token{}
+	for rows.Next() {
+		one := &Token{}
+		if err = orm.Scan(rows, one); err != nil {
+			return nil, err
+		}
+
+		list = append(list, one)
+	}
+
+	return list, nil
+}
+
+// FindToken returns feed token by its secret.
+func FindToken(secret string) *Token {
+	if len(secret) != 32 {
+		return nil
+	}
+
+	token := &Token{Token: secret}
+	if err := orm.Read(token, "token"); err != nil {
+		return nil
+	}
+
+	return token
+}
+
+// AddToken creates a new feed token. Existing token of the same feed will be
+// replaced.
+func AddToken(uid int64, kind int8, target int64) (*Token, error) {
+	secret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	orm.Exec("DELETE FROM `token` WHERE `uid`=? AND `kind`=? AND `target`=?", uid, kind, target)
+
+	token := &Token{
+		UID:    uid,
+		Kind:   kind,
+		Target: target,
+		Token:  secret,
+		Time:   time.Now(),
+	}
+
+	result, err := orm.Insert(token)
+	if err != nil {
+		return nil, err
+	}
+
+	token.ID, _ = result.LastInsertId()
+	return token, nil
+}
+
+// RevokeToken deletes feed token of given user.
+func RevokeToken(uid, id int64) error {
+	result, err := orm.Exec("DELETE FROM `token` WHERE `id`=? AND `uid`=?", id, uid)
+	if err != nil {
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errors.New("订阅链接不存在或已被撤销")
+	}
+
+	return nil
+}
+
+func newSecret() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
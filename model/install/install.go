@@ -6,9 +6,14 @@ import (
 
 	"team/common/orm"
 	"team/model/document"
+	"team/model/feed"
+	"team/model/link"
 	"team/model/notice"
 	"team/model/project"
+	"team/model/report"
+	"team/model/search"
 	"team/model/share"
+	"team/model/stats"
 	"team/model/task"
 	"team/model/user"
 )
@@ -26,6 +31,41 @@ type Job struct {
 	Schema interface{}
 }
 
+// All tables used by this app.
+var jobs = []Job{
+	{Table: "user", Schema: &user.User{}},
+	{Table: "feed token", Schema: &feed.Token{}},
+	{Table: "notice", Schema: &notice.Notice{}},
+	{Table: "project", Schema: &project.Project{}},
+	{Table: "project milestone", Schema: &project.Milestone{}},
+	{Table: "project member", Schema: &project.Member{}},
+	{Table: "project label", Schema: &project.Label{}},
+	{Table: "project custom field", Schema: &project.CustomField{}},
+	{Table: "project sprint", Schema: &project.Sprint{}},
+	{Table: "project report schedule", Schema: &report.Schedule{}},
+	{Table: "project activity", Schema: &project.Activity{}},
+	{Table: "task", Schema: &task.Task{}},
+	{Table: "task label", Schema: &task.TaskLabel{}},
+	{Table: "task custom field", Schema: &task.FieldValue{}},
+	{Table: "task sprint", Schema: &task.SprintTask{}},
+	{Table: "task dependency", Schema: &task.Dependency{}},
+	{Table: "task attachment", Schema: &task.Attachment{}},
+	{Table: "task event", Schema: &task.Event{}},
+	{Table: "task revision", Schema: &task.Revision{}},
+	{Table: "task comment", Schema: &task.Comment{}},
+	{Table: "task comment history", Schema: &task.CommentHistory{}},
+	{Table: "task comment reaction", Schema: &task.CommentReaction{}},
+	{Table: "document", Schema: &document.Document{}},
+	{Table: "document history", Schema: &document.History{}},
+	{Table: "document permission", Schema: &document.Permission{}},
+	{Table: "document template", Schema: &document.Template{}},
+	{Table: "document comment", Schema: &document.DocComment{}},
+	{Table: "share", Schema: &share.Share{}},
+	{Table: "milestone snapshot", Schema: &stats.Snapshot{}},
+	{Table: "search index", Schema: &search.Posting{}},
+	{Table: "reference link", Schema: &link.Link{}},
+}
+
 // Run mysql database installation.
 func Run(db string, status *Status) {
 	err := orm.OpenDB("mysql", db)
@@ -35,20 +75,6 @@ func Run(db string, status *Status) {
 		return
 	}
 
-	jobs := []Job{
-		{Table: "user", Schema: &user.User{}},
-		{Table: "notice", Schema: &notice.Notice{}},
-		{Table: "project", Schema: &project.Project{}},
-		{Table: "project milestone", Schema: &project.Milestone{}},
-		{Table: "project member", Schema: &project.Member{}},
-		{Table: "task", Schema: &task.Task{}},
-		{Table: "task attachment", Schema: &task.Attachment{}},
-		{Table: "task event", Schema: &task.Event{}},
-		{Table: "task comment", Schema: &task.Comment{}},
-		{Table: "document", Schema: &document.Document{}},
-		{Table: "share", Schema: &share.Share{}},
-	}
-
 	for _, job := range jobs {
 		status.Status = append(status.Status, "创建数据表: "+job.Table)
 
@@ -64,6 +90,17 @@ func Run(db string, status *Status) {
 	status.Status = append(status.Status, "应用配置完成!")
 }
 
+// Upgrade creates missing tables and columns for an installed database.
+func Upgrade() error {
+	for _, job := range jobs {
+		if err := orm.SyncTable(job.Schema); err != nil {
+			return fmt.Errorf("upgrade table [%s] failed: %v", job.Table, err)
+		}
+	}
+
+	return nil
+}
+
 // AddDefaultAdmin insert a user into database as default admin account.
 func AddDefaultAdmin(account, name, pswd string) error {
 	hash := md5.New()
@@ -75,6 +112,7 @@ func AddDefaultAdmin(account, name, pswd string) error {
 		Password:  fmt.Sprintf("%X", hash.Sum(nil)),
 		IsBuildin: true,
 		IsSu:      true,
+		Capacity:  user.DefaultCapacity,
 	}
 
 	_, err := orm.Insert(user)
@@ -0,0 +1,276 @@
+package link
+
+import (
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"team/common/orm"
+	"team/model/search"
+)
+
+type (
+	// Link schema. Records that source record references target record in
+	// its content. Kinds are the same as search kinds.
+	Link struct {
+		ID         int64 `json:"id"`
+		SourceKind int8  `json:"sourceKind"`
+		Source     int64 `json:"source" orm:"index"`
+		TargetKind int8  `json:"targetKind"`
+		Target     int64 `json:"target" orm:"index"`
+	}
+
+	// Ref is a target parsed from content.
+	Ref struct {
+		Kind   int8
+		Target int64
+	}
+
+	// Mentions walks through records whose content matches given LIKE
+	// pattern. Fn receives ID, project and content of each record.
+	Mentions func(pattern string, fn func(source, pid int64, content string)) error
+)
+
+// ResolveTitle finds document by title, preferring those in given project.
+// Returns zero if not found. Set by document package.
+var ResolveTitle func(title string, pid int64) int64
+
+var mentions = map[int8]Mentions{}
+
+var (
+	inlineCode = regexp.MustCompile("`+[^`\\n]*`+")
+	taskRef    = regexp.MustCompile(`(?:^|[^\w&/#])#(\d+)\b|\btask:(\d+)\b|/\?task=(\d+)\b`)
+	docRef     = regexp.MustCompile(`\b(?:doc|document):(\d+)\b|/\?document=(\d+)\b`)
+	titleRef   = regexp.MustCompile(`\[\[([^\[\]\n]{1,64})\]\]`)
+)
+
+// Register finder of records of given kind mentioning a text. Should be
+// called in package init.
+func Register(kind int8, find Mentions) {
+	mentions[kind] = find
+}
+
+// Parse finds references in content. Tasks are referenced by `#123`,
+// `task:123` or task link, documents by `[[Title]]`, `doc:123` or document
+// link. References inside code are ignored.
+func Parse(content string, pid int64) []Ref {
+	content = stripCode(content)
+
+	refs := []Ref{}
+	found := map[Ref]bool{}
+	add := func(kind int8, target int64) {
+		ref := Ref{Kind: kind, Target: target}
+		if target > 0 && !found[ref] {
+			found[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+
+	for _, m := range taskRef.FindAllStringSubmatch(content, -1) {
+		add(search.KindTask, firstID(m[1:]))
+	}
+
+	for _, m := range docRef.FindAllStringSubmatch(content, -1) {
+		add(search.KindDocument, firstID(m[1:]))
+	}
+
+	if ResolveTitle != nil {
+		for _, m := range titleRef.FindAllStringSubmatch(content, -1) {
+			if title := strings.TrimSpace(m[1]); title != "" {
+				add(search.KindDocument, ResolveTitle(title, pid))
+			}
+		}
+	}
+
+	return refs
+}
+
+// Update replaces references of given record with those parsed from its
+// content. PID is the project of the record, used to resolve titles.
+func Update(kind int8, source, pid int64, content string) error {
+	tx, err := orm.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec("DELETE FROM `link` WHERE `sourcekind`=? AND `source`=?", kind, source); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, ref := range Parse(content, pid) {
+		if ref.Kind == kind && ref.Target == source {
+			continue
+		}
+
+		_, err = tx.Exec("INSERT INTO `link`(`sourcekind`,`source`,`targetkind`,`target`) VALUES(?,?,?,?)", kind, source, ref.Kind, ref.Target)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Refresh updates references of records mentioning given title by
+// `[[Title]]`, so that they are resolved again after a document with this
+// title is created, renamed or deleted.
+func Refresh(title string) {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return
+	}
+
+	type record struct {
+		source  int64
+		pid     int64
+		content string
+	}
+
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(title) + "%"
+
+	for kind, find := range mentions {
+		records := []record{}
+		err := find(pattern, func(source, pid int64, content string) {
+			if mentionsTitle(content, title) {
+				records = append(records, record{source, pid, content})
+			}
+		})
+
+		if err != nil {
+			log.Printf("Find mentions of [[%s]] failed. Reason: %v\n", title, err)
+			continue
+		}
+
+		for _, one := range records {
+			if err = Update(kind, one.source, one.pid, one.content); err != nil {
+				log.Printf("Update references of %d:%d failed. Reason: %v\n", kind, one.source, err)
+			}
+		}
+	}
+}
+
+// Remove all references from or to given record.
+func Remove(kind int8, id int64) {
+	orm.Exec("DELETE FROM `link` WHERE (`sourcekind`=? AND `source`=?) OR (`targetkind`=? AND `target`=?)", kind, id, kind, id)
+}
+
+// Backlinks returns records referencing given target and visible to given
+// user.
+func Backlinks(kind int8, target, uid int64) []map[string]interface{} {
+	list := []map[string]interface{}{}
+
+	rows, err := orm.Query("SELECT `sourcekind`,`source` FROM `link` WHERE `targetkind`=? AND `target`=? ORDER BY `sourcekind`,`source` DESC", kind, target)
+	if err != nil {
+		return list
+	}
+
+	sources := []Ref{}
+	for rows.Next() {
+		one := Ref{}
+		if rows.Scan(&one.Kind, &one.Target) == nil {
+			sources = append(sources, one)
+		}
+	}
+
+	rows.Close()
+
+	for _, one := range sources {
+		entry := search.Resolve(one.Kind, one.Target, uid)
+		if entry == nil {
+			continue
+		}
+
+		item := map[string]interface{}{
+			"kind":  one.Kind,
+			"id":    one.Target,
+			"title": entry.Title,
+		}
+
+		for k, v := range entry.Extra {
+			item[k] = v
+		}
+
+		list = append(list, item)
+	}
+
+	return list
+}
+
+// RebuildIfEmpty builds references for installations upgraded from old
+// version. Titles are resolved without project preference.
+func RebuildIfEmpty() {
+	rows, err := orm.Query("SELECT COUNT(*) FROM `link`")
+	if err != nil {
+		return
+	}
+
+	count := 0
+	rows.Next()
+	rows.Scan(&count)
+	rows.Close()
+
+	if count != 0 {
+		return
+	}
+
+	err = search.Each(func(kind int8, source int64, title, content string) {
+		if err := Update(kind, source, 0, content); err != nil {
+			log.Printf("Update references of %d:%d failed. Reason: %v\n", kind, source, err)
+		}
+	})
+
+	if err != nil {
+		log.Printf("Rebuild references failed. Reason: %v\n", err)
+	}
+}
+
+func firstID(groups []string) int64 {
+	for _, g := range groups {
+		if g != "" {
+			id, _ := strconv.ParseInt(g, 10, 64)
+			return id
+		}
+	}
+
+	return 0
+}
+
+func mentionsTitle(content, title string) bool {
+	for _, m := range titleRef.FindAllStringSubmatch(stripCode(content), -1) {
+		if strings.TrimSpace(m[1]) == title {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stripCode removes fenced code blocks and code spans.
+func stripCode(content string) string {
+	var buf strings.Builder
+	fence := ""
+
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+
+		buf.WriteString(inlineCode.ReplaceAllString(line, ""))
+		buf.WriteByte('\n')
+	}
+
+	return buf.String()
+}
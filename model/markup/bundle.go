@@ -0,0 +1,193 @@
+package markup
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html/template"
+	"time"
+
+	"team/model/document"
+	"team/model/user"
+)
+
+type (
+	page struct {
+		Title    string
+		Author   string
+		Modifier string
+		Time     string
+		Path     []*document.Document
+		Links    map[int64]string
+		Index    bool
+		Body     template.HTML
+	}
+
+	tocNode struct {
+		Doc      *document.Document
+		Link     string
+		Children []*tocNode
+	}
+)
+
+var bundleTemplate = template.Must(template.New("bundle").Parse(`{{define "toc"}}<ul>
+{{range .}}<li><a href="{{.Link}}">{{.Doc.Title}}</a>{{if .Children}}{{template "toc" .Children}}{{end}}</li>
+{{end}}</ul>{{end}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body{margin:0 auto;max-width:960px;padding:24px;font-family:-apple-system,"PingFang SC","Microsoft YaHei",sans-serif;font-size:14px;line-height:1.7;color:#333}
+nav{color:#6c757d;font-size:12px;margin-bottom:8px}
+nav a{color:#6c757d}
+.meta{color:#6c757d;font-size:12px;border-bottom:1px solid #eee;padding-bottom:8px;margin-bottom:16px}
+a{color:#1890ff;text-decoration:none}
+a:hover{text-decoration:underline}
+h1,h2{border-bottom:1px solid #eee;padding-bottom:4px}
+pre{background:#f6f8fa;padding:12px;overflow:auto;border-radius:4px}
+code{background:#f6f8fa;padding:2px 4px;border-radius:2px;font-family:Consolas,Menlo,monospace}
+pre code{padding:0}
+blockquote{margin:0;padding:0 12px;color:#6c757d;border-left:4px solid #ddd}
+table{border-collapse:collapse}
+th,td{border:1px solid #ddd;padding:4px 12px}
+img{max-width:100%}
+li.task{list-style:none}
+li.task input{margin:0 6px 0 -20px}
+</style>
+</head>
+<body>
+{{if .Path}}<nav>{{range $i, $d := .Path}}{{if $i}} / {{end}}{{with index $.Links $d.ID}}<a href="{{.}}">{{$d.Title}}</a>{{else}}{{$d.Title}}{{end}}{{end}}</nav>{{end}}
+<h1>{{.Title}}</h1>
+{{if not .Index}}<div class="meta">作者：{{.Author}}　最后修改：{{.Modifier}} {{.Time}}</div>{{end}}
+{{.Body}}
+</body>
+</html>
+`))
+
+// Export renders document into a self-contained HTML page. When subtree is
+// set, the document and all its descendants visible to reader are bundled
+// into a zip file with a table of contents, linked to each other. Returns
+// data, file extension and content type.
+func Export(root *document.Document, uid int64, subtree bool, baseURL string) ([]byte, string, string, error) {
+	r := &Renderer{BaseURL: baseURL, UID: uid, InlineImages: true}
+
+	if !subtree {
+		data, err := renderPage(r, root, nil)
+		return data, "html", "text/html; charset=utf-8", err
+	}
+
+	all, err := root.Subtree()
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	// Documents invisible to reader are skipped, their children are attached
+	// to the nearest visible ancestor.
+	r.Documents = map[int64]string{}
+	nodes := map[int64]*tocNode{}
+	nearest := map[int64]int64{}
+	docs := []*document.Document{}
+
+	for _, d := range all {
+		if d.ID != root.ID {
+			if read, _ := d.Access(uid); !read {
+				nearest[d.ID] = nearest[d.Parent]
+				continue
+			}
+		}
+
+		link := fmt.Sprintf("%d.html", d.ID)
+		r.Documents[d.ID] = link
+		nearest[d.ID] = d.ID
+		nodes[d.ID] = &tocNode{Doc: d, Link: link}
+		docs = append(docs, d)
+
+		if d.ID != root.ID {
+			parent := nodes[nearest[d.Parent]]
+			parent.Children = append(parent.Children, nodes[d.ID])
+		}
+	}
+
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+
+	index := &page{Title: root.Title, Index: true}
+	var toc bytes.Buffer
+	if err = bundleTemplate.ExecuteTemplate(&toc, "toc", []*tocNode{nodes[root.ID]}); err != nil {
+		return nil, "", "", err
+	}
+
+	index.Body = template.HTML(toc.String())
+	if err = writePage(writer, "index.html", index); err != nil {
+		return nil, "", "", err
+	}
+
+	for _, d := range docs {
+		path := []*document.Document{}
+		for id := d.ID; ; id = nearest[nodes[id].Doc.Parent] {
+			path = append([]*document.Document{nodes[id].Doc}, path...)
+			if id == root.ID {
+				break
+			}
+		}
+
+		data, err := renderPage(r, d, path)
+		if err != nil {
+			return nil, "", "", err
+		}
+
+		f, err := writer.CreateHeader(&zip.FileHeader{Name: r.Documents[d.ID], Method: zip.Deflate, Modified: d.Time})
+		if err != nil {
+			return nil, "", "", err
+		}
+
+		if _, err = f.Write(data); err != nil {
+			return nil, "", "", err
+		}
+	}
+
+	if err = writer.Close(); err != nil {
+		return nil, "", "", err
+	}
+
+	return buf.Bytes(), "zip", "application/zip", nil
+}
+
+// renderPage renders a document with breadcrumb of given path.
+func renderPage(r *Renderer, d *document.Document, path []*document.Document) ([]byte, error) {
+	author, _ := user.FindInfo(d.Author)
+	modifier, _ := user.FindInfo(d.Modifier)
+
+	p := &page{
+		Title:    d.Title,
+		Author:   author,
+		Modifier: modifier,
+		Time:     d.Time.Format("2006-01-02 15:04"),
+		Links:    map[int64]string{},
+		Body:     template.HTML(r.Render(d.Content)),
+	}
+
+	if len(path) > 0 {
+		// Breadcrumb starts from table of contents.
+		p.Path = append([]*document.Document{{ID: 0, Title: "目录"}}, path[:len(path)-1]...)
+		p.Links[0] = "index.html"
+		for _, one := range path {
+			p.Links[one.ID] = r.Documents[one.ID]
+		}
+	}
+
+	var buf bytes.Buffer
+	err := bundleTemplate.Execute(&buf, p)
+	return buf.Bytes(), err
+}
+
+func writePage(writer *zip.Writer, name string, p *page) error {
+	f, err := writer.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+
+	return bundleTemplate.Execute(f, p)
+}
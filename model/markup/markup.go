@@ -0,0 +1,132 @@
+package markup
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"team/common/markdown"
+	"team/model/document"
+	"team/model/task"
+)
+
+// Max size of a single image inlined into HTML.
+const maxInlineImage = 8 * 1024 * 1024
+
+var (
+	taskLink     = regexp.MustCompile(`^(?:task:|/\?task=)(\d+)$`)
+	documentLink = regexp.MustCompile(`^(?:doc:|document:|/\?document=)(\d+)$`)
+)
+
+// Renderer converts markdown content of tasks, comments and documents into
+// sanitized HTML. Links like `task:12` and `doc:34` are resolved to pages of
+// this site.
+type Renderer struct {
+	// BaseURL is scheme and host of this site. Relative links are prefixed
+	// with it so that HTML works outside of this site, e.g. in mails.
+	BaseURL string
+	// UID is the reader. Names of tasks and documents invisible to the
+	// reader are hidden.
+	UID int64
+	// Documents overrides links of given documents. Used by bundles to link
+	// documents exported together.
+	Documents map[int64]string
+	// InlineImages embeds uploaded images as data URI.
+	InlineImages bool
+
+	images map[string]string
+}
+
+// Render markdown content into HTML.
+func (r *Renderer) Render(content string) string {
+	return markdown.Render(content, &markdown.Options{Link: r.link, Image: r.image})
+}
+
+func (r *Renderer) link(href string) (string, string) {
+	if m := taskLink.FindStringSubmatch(href); m != nil {
+		tid, _ := strconv.ParseInt(m[1], 10, 64)
+		text := "#" + m[1]
+		if t := task.Find(tid); t != nil && t.IsVisibleTo(r.UID) {
+			text += " " + t.Name
+		}
+
+		return fmt.Sprintf("%s/?task=%d", r.BaseURL, tid), text
+	}
+
+	if m := documentLink.FindStringSubmatch(href); m != nil {
+		did, _ := strconv.ParseInt(m[1], 10, 64)
+		text := "文档#" + m[1]
+		if d, err := document.Find(did); err == nil {
+			if read, _ := d.Access(r.UID); read {
+				text = d.Title
+			}
+		}
+
+		if local, ok := r.Documents[did]; ok {
+			return local, text
+		}
+
+		return fmt.Sprintf("%s/?document=%d", r.BaseURL, did), text
+	}
+
+	if strings.HasPrefix(href, "/") && !strings.HasPrefix(href, "//") {
+		return r.BaseURL + href, ""
+	}
+
+	return href, ""
+}
+
+func (r *Renderer) image(src string) string {
+	if r.InlineImages {
+		if data := r.inline(src); data != "" {
+			return data
+		}
+	}
+
+	if strings.HasPrefix(src, "/") && !strings.HasPrefix(src, "//") {
+		return r.BaseURL + src
+	}
+
+	return src
+}
+
+// inline reads uploaded image into data URI. Returns empty string if src is
+// not an uploaded image.
+func (r *Renderer) inline(src string) string {
+	if r.images == nil {
+		r.images = map[string]string{}
+	}
+
+	if data, ok := r.images[src]; ok {
+		return data
+	}
+
+	local := strings.TrimPrefix(src, r.BaseURL)
+	if idx := strings.IndexAny(local, "?#"); idx >= 0 {
+		local = local[:idx]
+	}
+
+	local = strings.TrimPrefix(path.Clean("/"+local), "/")
+	data := ""
+
+	if strings.HasPrefix(local, "uploads/") {
+		contentType := mime.TypeByExtension(path.Ext(local))
+		if strings.HasPrefix(contentType, "image/") && !strings.HasPrefix(contentType, "image/svg") {
+			if raw, err := ioutil.ReadFile(local); err == nil && len(raw) <= maxInlineImage {
+				if idx := strings.IndexByte(contentType, ';'); idx >= 0 {
+					contentType = contentType[:idx]
+				}
+
+				data = "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(raw)
+			}
+		}
+	}
+
+	r.images[src] = data
+	return data
+}
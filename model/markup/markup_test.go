@@ -0,0 +1,52 @@
+package markup
+
+import "testing"
+
+func TestRenderLinks(t *testing.T) {
+	r := &Renderer{
+		BaseURL:   "https://team.example.com",
+		Documents: map[int64]string{7: "#doc-7"},
+	}
+
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"[](task:12)", "<p><a href=\"https://team.example.com/?task=12\">#12</a></p>\n"},
+		{"[see](/?task=12)", "<p><a href=\"https://team.example.com/?task=12\">see</a></p>\n"},
+		{"[](doc:34)", "<p><a href=\"https://team.example.com/?document=34\">文档#34</a></p>\n"},
+		{"[](document:34)", "<p><a href=\"https://team.example.com/?document=34\">文档#34</a></p>\n"},
+		{"[](/?document=34)", "<p><a href=\"https://team.example.com/?document=34\">文档#34</a></p>\n"},
+		{"[](doc:7)", "<p><a href=\"#doc-7\">文档#7</a></p>\n"},
+		{"[x](/help)", "<p><a href=\"https://team.example.com/help\">x</a></p>\n"},
+		{"[x](//evil.example.com)", "<p><a href=\"//evil.example.com\">x</a></p>\n"},
+		{"[x](task:abc)", "<p><a>x</a></p>\n"},
+		{"[x](javascript:alert(1))", "<p><a>x</a></p>\n"},
+		{"![a](/uploads/a.png)", "<p><img src=\"https://team.example.com/uploads/a.png\" alt=\"a\"></p>\n"},
+		{"![a](https://cdn.example.com/a.png)", "<p><img src=\"https://cdn.example.com/a.png\" alt=\"a\"></p>\n"},
+	}
+
+	for _, c := range cases {
+		if got := r.Render(c.src); got != c.want {
+			t.Errorf("Render(%q) = %q, want %q", c.src, got, c.want)
+		}
+	}
+}
+
+func TestRenderMissingImage(t *testing.T) {
+	r := &Renderer{BaseURL: "https://team.example.com", InlineImages: true}
+
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"![a](/uploads/missing.png)", "<p><img src=\"https://team.example.com/uploads/missing.png\" alt=\"a\"></p>\n"},
+		{"![a](/uploads/../../etc/passwd)", "<p><img src=\"https://team.example.com/uploads/../../etc/passwd\" alt=\"a\"></p>\n"},
+	}
+
+	for _, c := range cases {
+		if got := r.Render(c.src); got != c.want {
+			t.Errorf("Render(%q) = %q, want %q", c.src, got, c.want)
+		}
+	}
+}
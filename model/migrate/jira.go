@@ -0,0 +1,398 @@
+package migrate
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type (
+	jiraUser struct {
+		EmailAddress string `json:"emailAddress"`
+		Name         string `json:"name"`
+		Key          string `json:"key"`
+		DisplayName  string `json:"displayName"`
+	}
+
+	jiraIssue struct {
+		Key    string                     `json:"key"`
+		Fields map[string]json.RawMessage `json:"fields"`
+	}
+
+	jiraRSS struct {
+		Items []struct {
+			Key            string `xml:"key"`
+			Summary        string `xml:"summary"`
+			Description    string `xml:"description"`
+			Status         string `xml:"status"`
+			StatusCategory struct {
+				Key string `xml:"key,attr"`
+			} `xml:"statusCategory"`
+			Priority     string       `xml:"priority"`
+			Assignee     jiraXMLUser  `xml:"assignee"`
+			Reporter     jiraXMLUser  `xml:"reporter"`
+			Created      string       `xml:"created"`
+			Resolved     string       `xml:"resolved"`
+			Due          string       `xml:"due"`
+			FixVersions  []string     `xml:"fixVersion"`
+			CustomFields []jiraXMLCF  `xml:"customfields>customfield"`
+			Comments     []jiraXMLCmt `xml:"comments>comment"`
+		} `xml:"channel>item"`
+	}
+
+	jiraXMLUser struct {
+		Username  string `xml:"username,attr"`
+		AccountID string `xml:"accountid,attr"`
+		Name      string `xml:",chardata"`
+	}
+
+	jiraXMLCF struct {
+		Key    string   `xml:"key,attr"`
+		Name   string   `xml:"customfieldname"`
+		Values []string `xml:"customfieldvalues>customfieldvalue"`
+	}
+
+	jiraXMLCmt struct {
+		Author  string `xml:"author,attr"`
+		Created string `xml:"created,attr"`
+		Body    string `xml:",chardata"`
+	}
+)
+
+var (
+	legacySprint = regexp.MustCompile(`com\.atlassian\.greenhopper\.service\.sprint\.Sprint@.*\[(.*)\]`)
+	htmlTag      = regexp.MustCompile(`<[^>]*>`)
+)
+
+// ParseJiraJSON reads issues from Jira REST search result or an array of
+// issues.
+func ParseJiraJSON(data []byte) (*Source, error) {
+	issues := []*jiraIssue{}
+
+	wrapper := struct {
+		Issues []*jiraIssue `json:"issues"`
+	}{}
+
+	if err := json.Unmarshal(data, &wrapper); err == nil && len(wrapper.Issues) > 0 {
+		issues = wrapper.Issues
+	} else if err := json.Unmarshal(data, &issues); err != nil {
+		return nil, errors.New("无法识别的Jira JSON导出文件")
+	}
+
+	src := &Source{Milestones: []*Milestone{}, Tasks: []*Issue{}}
+	milestones := map[string]*Milestone{}
+
+	for _, one := range issues {
+		fields := one.Fields
+		issue := &Issue{
+			Key:      one.Key,
+			Name:     jsonString(fields["summary"]),
+			Content:  plainText(fields["description"]),
+			Created:  parseTime(jsonString(fields["created"])),
+			Resolved: parseTime(jsonString(fields["resolutiondate"])),
+			Due:      parseTime(jsonString(fields["duedate"])),
+			Comments: []*Remark{},
+		}
+
+		status := struct {
+			Name           string `json:"name"`
+			StatusCategory struct {
+				Key string `json:"key"`
+			} `json:"statusCategory"`
+		}{}
+
+		json.Unmarshal(fields["status"], &status)
+		issue.State = stateOf(status.Name, status.StatusCategory.Key == "done")
+		if status.StatusCategory.Key == "indeterminate" && issue.State == 0 {
+			issue.State = 1
+		}
+
+		priority := struct {
+			Name string `json:"name"`
+		}{}
+
+		json.Unmarshal(fields["priority"], &priority)
+		issue.Weight = weightOf(priority.Name)
+		issue.Assignee = jiraCandidates(fields["assignee"])
+		issue.Reporter = jiraCandidates(fields["reporter"])
+
+		comments := struct {
+			Comments []struct {
+				Author  json.RawMessage `json:"author"`
+				Body    json.RawMessage `json:"body"`
+				Created string          `json:"created"`
+			} `json:"comments"`
+		}{}
+
+		json.Unmarshal(fields["comment"], &comments)
+		for _, c := range comments.Comments {
+			issue.Comments = append(issue.Comments, &Remark{
+				Author:  jiraCandidates(c.Author),
+				Time:    parseTime(c.Created),
+				Content: plainText(c.Body),
+			})
+		}
+
+		if sprint := jiraSprint(fields); sprint != nil {
+			issue.Milestone = sprint.Key
+			if _, ok := milestones[sprint.Key]; !ok {
+				milestones[sprint.Key] = sprint
+				src.Milestones = append(src.Milestones, sprint)
+			}
+		} else {
+			versions := []struct {
+				Name        string `json:"name"`
+				StartDate   string `json:"startDate"`
+				ReleaseDate string `json:"releaseDate"`
+			}{}
+
+			json.Unmarshal(fields["fixVersions"], &versions)
+			if len(versions) > 0 {
+				version := versions[len(versions)-1]
+				key := "version:" + version.Name
+				issue.Milestone = key
+
+				if _, ok := milestones[key]; !ok {
+					milestones[key] = &Milestone{
+						Key:       key,
+						Name:      version.Name,
+						StartTime: parseTime(version.StartDate),
+						EndTime:   parseTime(version.ReleaseDate),
+					}
+
+					src.Milestones = append(src.Milestones, milestones[key])
+				}
+			}
+		}
+
+		src.Tasks = append(src.Tasks, issue)
+	}
+
+	return src, nil
+}
+
+// ParseJiraXML reads issues from Jira XML (RSS) export.
+func ParseJiraXML(data []byte) (*Source, error) {
+	rss := &jiraRSS{}
+	if err := xml.Unmarshal(data, rss); err != nil {
+		return nil, errors.New("无法识别的Jira XML导出文件")
+	}
+
+	src := &Source{Milestones: []*Milestone{}, Tasks: []*Issue{}}
+	milestones := map[string]bool{}
+
+	for _, item := range rss.Items {
+		issue := &Issue{
+			Key:      strings.TrimSpace(item.Key),
+			Name:     strings.TrimSpace(item.Summary),
+			Content:  stripHTML(item.Description),
+			State:    stateOf(item.Status, item.StatusCategory.Key == "done"),
+			Weight:   weightOf(item.Priority),
+			Assignee: xmlCandidates(item.Assignee),
+			Reporter: xmlCandidates(item.Reporter),
+			Created:  parseTime(item.Created),
+			Resolved: parseTime(item.Resolved),
+			Due:      parseTime(item.Due),
+			Comments: []*Remark{},
+		}
+
+		if item.StatusCategory.Key == "indeterminate" && issue.State == 0 {
+			issue.State = 1
+		}
+
+		for _, c := range item.Comments {
+			issue.Comments = append(issue.Comments, &Remark{
+				Author:  []string{c.Author},
+				Time:    parseTime(c.Created),
+				Content: stripHTML(c.Body),
+			})
+		}
+
+		milestone := ""
+		for _, cf := range item.CustomFields {
+			if (strings.Contains(cf.Key, "gh-sprint") || cf.Name == "Sprint") && len(cf.Values) > 0 {
+				milestone = strings.TrimSpace(cf.Values[len(cf.Values)-1])
+				issue.Milestone = "sprint:" + milestone
+			}
+		}
+
+		if issue.Milestone == "" && len(item.FixVersions) > 0 {
+			milestone = strings.TrimSpace(item.FixVersions[len(item.FixVersions)-1])
+			issue.Milestone = "version:" + milestone
+		}
+
+		if issue.Milestone != "" && !milestones[issue.Milestone] {
+			milestones[issue.Milestone] = true
+			src.Milestones = append(src.Milestones, &Milestone{Key: issue.Milestone, Name: milestone})
+		}
+
+		src.Tasks = append(src.Tasks, issue)
+	}
+
+	return src, nil
+}
+
+// jiraSprint finds the latest sprint from custom fields.
+func jiraSprint(fields map[string]json.RawMessage) *Milestone {
+	for key, raw := range fields {
+		if !strings.HasPrefix(key, "customfield_") {
+			continue
+		}
+
+		sprints := []struct {
+			Name      string `json:"name"`
+			State     string `json:"state"`
+			BoardID   int64  `json:"boardId"`
+			StartDate string `json:"startDate"`
+			EndDate   string `json:"endDate"`
+		}{}
+
+		if err := json.Unmarshal(raw, &sprints); err == nil && len(sprints) > 0 && sprints[0].Name != "" && (sprints[0].BoardID > 0 || sprints[0].State != "") {
+			sprint := sprints[len(sprints)-1]
+			return &Milestone{
+				Key:       "sprint:" + sprint.Name,
+				Name:      sprint.Name,
+				StartTime: parseTime(sprint.StartDate),
+				EndTime:   parseTime(sprint.EndDate),
+			}
+		}
+
+		legacy := []string{}
+		if err := json.Unmarshal(raw, &legacy); err == nil && len(legacy) > 0 {
+			match := legacySprint.FindStringSubmatch(legacy[len(legacy)-1])
+			if match == nil {
+				continue
+			}
+
+			props := map[string]string{}
+			for _, pair := range strings.Split(match[1], ",") {
+				kv := strings.SplitN(pair, "=", 2)
+				if len(kv) == 2 {
+					props[kv[0]] = kv[1]
+				}
+			}
+
+			if props["name"] != "" {
+				return &Milestone{
+					Key:       "sprint:" + props["name"],
+					Name:      props["name"],
+					StartTime: parseTime(props["startDate"]),
+					EndTime:   parseTime(props["endDate"]),
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func jiraCandidates(raw json.RawMessage) []string {
+	u := &jiraUser{}
+	if len(raw) == 0 || json.Unmarshal(raw, u) != nil {
+		return nil
+	}
+
+	return compact(u.EmailAddress, u.Name, u.Key, u.DisplayName)
+}
+
+func xmlCandidates(u jiraXMLUser) []string {
+	return compact(u.Username, u.AccountID, strings.TrimSpace(u.Name))
+}
+
+func compact(values ...string) []string {
+	ret := []string{}
+	for _, one := range values {
+		if one != "" && one != "-1" {
+			ret = append(ret, one)
+		}
+	}
+
+	if len(ret) == 0 {
+		return nil
+	}
+
+	return ret
+}
+
+func jsonString(raw json.RawMessage) string {
+	s := ""
+	json.Unmarshal(raw, &s)
+	return s
+}
+
+// plainText returns text of string or Atlassian Document Format value.
+func plainText(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+
+	s := ""
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return ""
+	}
+
+	var builder strings.Builder
+	var walk func(node interface{})
+	walk = func(node interface{}) {
+		obj, ok := node.(map[string]interface{})
+		if !ok {
+			return
+		}
+
+		if text, ok := obj["text"].(string); ok {
+			builder.WriteString(text)
+		}
+
+		if children, ok := obj["content"].([]interface{}); ok {
+			for _, child := range children {
+				walk(child)
+			}
+		}
+
+		switch obj["type"] {
+		case "paragraph", "heading", "listItem", "codeBlock", "hardBreak":
+			builder.WriteString("\n")
+		}
+	}
+
+	walk(doc)
+	return strings.TrimSpace(builder.String())
+}
+
+func stripHTML(s string) string {
+	s = strings.NewReplacer("<br/>", "\n", "<br>", "\n", "</p>", "\n").Replace(s)
+	return strings.TrimSpace(html.UnescapeString(htmlTag.ReplaceAllString(s, "")))
+}
+
+func parseTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}
+	}
+
+	layouts := []string{
+		time.RFC3339,
+		"2006-01-02T15:04:05.000-0700",
+		"2006-01-02T15:04:05.000Z",
+		"Mon, 2 Jan 2006 15:04:05 -0700",
+		"2006-01-02",
+		"02/Jan/06",
+	}
+
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
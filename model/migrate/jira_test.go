@@ -0,0 +1,89 @@
+package migrate
+
+import "testing"
+
+func TestParseJiraJSON(t *testing.T) {
+	src := parseFixture(t, "jira-json", "jira.json")
+
+	checkMilestones(t, src.Milestones, []wantMilestone{
+		{"sprint:Sprint 2", "Sprint 2", "2024-03-04T01:00:00Z", "2024-03-15T01:00:00Z"},
+		{"sprint:Legacy Sprint", "Legacy Sprint", "2024-02-01T09:00:00+08:00", "2024-02-14T18:00:00+08:00"},
+		{"version:1.0", "1.0", "2024-03-01T00:00:00Z", "2024-03-31T00:00:00Z"},
+	})
+
+	checkIssues(t, src.Tasks, []wantIssue{
+		{
+			key:       "TEAM-1",
+			name:      "Login page",
+			content:   "Build the login page.\nSupport SSO.",
+			state:     1,
+			weight:    2,
+			milestone: "sprint:Sprint 2",
+			assignee:  []string{"alice@example.com", "alice", "alice", "Alice"},
+			reporter:  []string{"Bob"},
+			created:   "2024-03-01T10:00:00+08:00",
+			due:       "2024-03-08T00:00:00Z",
+			comments: []wantRemark{
+				{[]string{"bob", "Bob"}, "2024-03-02T09:30:00+08:00", "Please add a captcha."},
+				{[]string{"alice@example.com", "Alice"}, "2024-03-03T18:00:00+08:00", "Done in review."},
+			},
+		},
+		{
+			key:       "TEAM-2",
+			name:      "Fix crash on logout",
+			content:   "App crashes when session expires.",
+			state:     3,
+			weight:    3,
+			milestone: "sprint:Legacy Sprint",
+			reporter:  []string{"carol", "carol", "Carol"},
+			created:   "2024-03-02T08:00:00+08:00",
+			resolved:  "2024-03-05T17:00:00+08:00",
+		},
+		{
+			key:       "TEAM-3",
+			name:      "Write release notes",
+			weight:    1,
+			milestone: "version:1.0",
+			assignee:  []string{"Dave"},
+			reporter:  []string{"alice", "Alice"},
+			created:   "2024-03-04T12:00:00+08:00",
+		},
+	})
+}
+
+func TestParseJiraXML(t *testing.T) {
+	src := parseFixture(t, "jira-xml", "jira.xml")
+
+	checkMilestones(t, src.Milestones, []wantMilestone{
+		{key: "sprint:Sprint 2", name: "Sprint 2"},
+		{key: "version:1.0", name: "1.0"},
+	})
+
+	checkIssues(t, src.Tasks, []wantIssue{
+		{
+			key:       "TEAM-10",
+			name:      "Export report",
+			content:   "Export monthly report as CSV.\nInclude totals & averages.",
+			state:     2,
+			weight:    0,
+			milestone: "sprint:Sprint 2",
+			assignee:  []string{"alice", "5b10a2844c20165700ede21f", "Alice"},
+			reporter:  []string{"bob", "Bob"},
+			created:   "2024-03-01T10:00:00+08:00",
+			comments: []wantRemark{
+				{[]string{"bob"}, "2024-03-02T09:30:00+08:00", "Needs a date filter."},
+			},
+		},
+		{
+			key:       "TEAM-11",
+			name:      "Old importer",
+			state:     4,
+			weight:    3,
+			milestone: "version:1.0",
+			reporter:  []string{"carol", "Carol"},
+			created:   "2024-02-01T10:00:00+08:00",
+			resolved:  "2024-02-07T16:00:00+08:00",
+			due:       "2024-02-09T00:00:00+08:00",
+		},
+	})
+}
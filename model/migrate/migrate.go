@@ -0,0 +1,460 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"team/common/orm"
+	"team/model/project"
+	"team/model/task"
+	"team/model/user"
+)
+
+// Status of import job.
+const (
+	JobRunning = 0
+	JobDone    = 1
+	JobFailed  = 2
+)
+
+type (
+	// Source is the data parsed from exports of other systems.
+	Source struct {
+		Milestones []*Milestone
+		Tasks      []*Issue
+	}
+
+	// Milestone is sprint or release in other systems.
+	Milestone struct {
+		Key       string
+		Name      string
+		StartTime time.Time
+		EndTime   time.Time
+	}
+
+	// Issue is issue or card in other systems.
+	Issue struct {
+		Key       string
+		Name      string
+		Content   string
+		State     int8
+		Weight    int8
+		Milestone string
+		Assignee  []string
+		Reporter  []string
+		Created   time.Time
+		Resolved  time.Time
+		Due       time.Time
+		Comments  []*Remark
+	}
+
+	// Remark is comment in other systems.
+	Remark struct {
+		Author  []string
+		Time    time.Time
+		Content string
+	}
+
+	// Job imports source into project in background.
+	Job struct {
+		ID       int64     `json:"id"`
+		PID      int64     `json:"pid"`
+		UID      int64     `json:"uid"`
+		Kind     string    `json:"kind"`
+		Status   int8      `json:"status"`
+		Total    int       `json:"total"`
+		Done     int       `json:"done"`
+		Errors   []string  `json:"errors"`
+		Started  time.Time `json:"started"`
+		Finished time.Time `json:"finished"`
+
+		lock sync.Mutex
+	}
+)
+
+// JobRetention is how long a finished job is kept for querying its result.
+var JobRetention = time.Hour
+
+var (
+	jobs   = sync.Map{}
+	lastID = int64(0)
+)
+
+// Parse reads export data of given kind. Supports jira-json, jira-xml and
+// trello.
+func Parse(kind string, data []byte) (*Source, error) {
+	switch kind {
+	case "jira-json":
+		return ParseJiraJSON(data)
+	case "jira-xml":
+		return ParseJiraXML(data)
+	case "trello":
+		return ParseTrello(data)
+	default:
+		return nil, errors.New("不支持的导入来源")
+	}
+}
+
+// Start imports parsed source into project in background.
+func Start(proj *project.Project, operator int64, kind string, src *Source) *Job {
+	job := &Job{
+		ID:      atomic.AddInt64(&lastID, 1),
+		PID:     proj.ID,
+		UID:     operator,
+		Kind:    kind,
+		Status:  JobRunning,
+		Total:   len(src.Tasks),
+		Errors:  []string{},
+		Started: time.Now(),
+	}
+
+	jobs.Store(job.ID, job)
+	go job.run(proj, src)
+	return job
+}
+
+// FindJob returns import job by ID.
+func FindJob(id int64) *Job {
+	if job, ok := jobs.Load(id); ok {
+		return job.(*Job)
+	}
+
+	return nil
+}
+
+// Info returns progress of this job.
+func (j *Job) Info() map[string]interface{} {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	return map[string]interface{}{
+		"id":       j.ID,
+		"pid":      j.PID,
+		"kind":     j.Kind,
+		"status":   j.Status,
+		"total":    j.Total,
+		"done":     j.Done,
+		"errors":   append([]string{}, j.Errors...),
+		"started":  j.Started.Format("2006-01-02 15:04:05"),
+		"finished": j.Finished.Format("2006-01-02 15:04:05"),
+	}
+}
+
+func (j *Job) fail(format string, args ...interface{}) {
+	j.lock.Lock()
+	j.Errors = append(j.Errors, fmt.Sprintf(format, args...))
+	j.lock.Unlock()
+}
+
+func (j *Job) step() {
+	j.lock.Lock()
+	j.Done++
+	j.lock.Unlock()
+}
+
+func (j *Job) finish(status int8) {
+	j.lock.Lock()
+	j.Status = status
+	j.Finished = time.Now()
+	j.lock.Unlock()
+
+	time.AfterFunc(JobRetention, func() { jobs.Delete(j.ID) })
+}
+
+func (j *Job) run(proj *project.Project, src *Source) {
+	defer func() {
+		if except := recover(); except != nil {
+			j.fail("导入中断：%v", except)
+			j.finish(JobFailed)
+		}
+	}()
+
+	users, err := user.GetAll()
+	if err != nil {
+		j.fail("读取用户列表失败：%v", err)
+		j.finish(JobFailed)
+		return
+	}
+
+	missing := map[string]bool{}
+	resolve := func(candidates []string) int64 {
+		if len(candidates) == 0 {
+			return j.UID
+		}
+
+		for _, one := range candidates {
+			for _, u := range users {
+				if one != "" && (strings.EqualFold(u.Account, one) || u.Name == one) {
+					return u.ID
+				}
+			}
+		}
+
+		if !missing[candidates[0]] {
+			missing[candidates[0]] = true
+			j.fail("用户【%s】不存在，已由导入者代替", candidates[0])
+		}
+
+		return j.UID
+	}
+
+	mids := j.prepareMilestones(proj, src)
+
+	for _, issue := range src.Tasks {
+		if err := j.importIssue(proj, issue, mids[issue.Milestone], resolve); err != nil {
+			j.fail("%s 导入失败：%v", issue.Key, err)
+		}
+
+		j.step()
+	}
+
+	j.finish(JobDone)
+}
+
+// prepareMilestones creates milestones used by issues. Existing milestones
+// with the same name are reused and extended to cover the imported tasks.
+func (j *Job) prepareMilestones(proj *project.Project, src *Source) map[string]int64 {
+	mids := map[string]int64{"": 0}
+
+	ranges := map[string][2]time.Time{}
+	for _, one := range src.Milestones {
+		ranges[one.Key] = [2]time.Time{one.StartTime, one.EndTime}
+	}
+
+	for _, issue := range src.Tasks {
+		if issue.Milestone == "" {
+			continue
+		}
+
+		start, end := issue.times()
+		span, ok := ranges[issue.Milestone]
+		if !ok {
+			continue
+		}
+
+		if span[0].IsZero() || start.Before(span[0]) {
+			span[0] = start
+		}
+
+		if span[1].IsZero() || end.After(span[1]) {
+			span[1] = end
+		}
+
+		ranges[issue.Milestone] = span
+	}
+
+	for _, one := range src.Milestones {
+		span := ranges[one.Key]
+		if span[0].IsZero() {
+			span[0] = dayOf(time.Now())
+		}
+
+		if span[1].Before(span[0]) {
+			span[1] = span[0]
+		}
+
+		var found *project.Milestone
+		for _, exists := range proj.Milestones {
+			if exists.Name == one.Name {
+				found = exists
+				break
+			}
+		}
+
+		if found == nil {
+			if err := proj.AddMilestone(one.Name, "", span[0], span[1]); err != nil {
+				j.fail("创建里程碑【%s】失败：%v", one.Name, err)
+				continue
+			}
+
+			found = proj.Milestones[len(proj.Milestones)-1]
+		} else if span[0].Before(found.StartTime) || span[1].After(found.EndTime) {
+			start, end := found.StartTime, found.EndTime
+			if span[0].Before(start) {
+				start = span[0]
+			}
+
+			if span[1].After(end) {
+				end = span[1]
+			}
+
+			proj.EditMilestone(found.ID, found.Name, found.Desc, start, end)
+		}
+
+		mids[one.Key] = found.ID
+	}
+
+	return mids
+}
+
+func (j *Job) importIssue(proj *project.Project, issue *Issue, mid int64, resolve func([]string) int64) error {
+	start, end := issue.times()
+	developer := resolve(issue.Assignee)
+	creator := resolve(issue.Reporter)
+	if len(issue.Reporter) == 0 {
+		creator = j.UID
+	}
+
+	name := issue.Name
+	if issue.Key != "" {
+		name = "[" + issue.Key + "] " + name
+	}
+
+	if len([]rune(name)) > 128 {
+		name = string([]rune(name)[:128])
+	}
+
+	t := &task.Task{
+		PID:         proj.ID,
+		MID:         mid,
+		Creator:     creator,
+		Developer:   developer,
+		Tester:      creator,
+		Name:        name,
+		Weight:      issue.Weight,
+		State:       issue.State,
+		StartTime:   start,
+		EndTime:     end,
+		ArchiveTime: task.TimeInfinite,
+		Content:     issue.Content,
+	}
+
+	resolved := issue.Resolved
+	if resolved.IsZero() {
+		resolved = time.Now()
+	}
+
+	if t.State == 4 {
+		t.ArchiveTime = resolved
+	}
+
+	// Task, its events and comments are imported entirely or not at all.
+	tx, err := orm.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Insert(t)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	t.ID, _ = result.LastInsertId()
+
+	created := issue.Created
+	if created.IsZero() {
+		created = time.Now()
+	}
+
+	events := []*task.Event{{TID: t.ID, UID: creator, Event: task.EventCreate, Time: created}}
+	if t.State > 0 {
+		events = append(events, &task.Event{TID: t.ID, UID: developer, Event: task.EventModState, Time: resolved, Extra: fmt.Sprint(t.State)})
+	}
+
+	comments := []*task.Comment{}
+	for _, remark := range issue.Comments {
+		if strings.TrimSpace(remark.Content) == "" {
+			continue
+		}
+
+		when := remark.Time
+		if when.IsZero() {
+			when = created
+		}
+
+		author := resolve(remark.Author)
+		c := &task.Comment{TID: t.ID, UID: author, Time: when, Comment: remark.Content}
+		result, err := tx.Insert(c)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		c.ID, _ = result.LastInsertId()
+		comments = append(comments, c)
+		events = append(events, &task.Event{TID: t.ID, UID: author, Event: task.EventComment, Time: when, Extra: fmt.Sprint(c.ID)})
+	}
+
+	for _, ev := range events {
+		if _, err = tx.Insert(ev); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	t.Reindex()
+	for _, c := range comments {
+		c.Reindex()
+	}
+
+	return nil
+}
+
+// times returns start and end day of this issue.
+func (i *Issue) times() (time.Time, time.Time) {
+	start := dayOf(i.Created)
+	if i.Created.IsZero() {
+		start = dayOf(time.Now())
+	}
+
+	end := start
+	if !i.Due.IsZero() {
+		end = dayOf(i.Due)
+	} else if !i.Resolved.IsZero() {
+		end = dayOf(i.Resolved)
+	}
+
+	if end.Before(start) {
+		end = start
+	}
+
+	return start, end
+}
+
+// stateOf guesses Team state from status name.
+func stateOf(status string, done bool) int8 {
+	name := strings.ToLower(status)
+
+	switch {
+	case strings.Contains(name, "closed") || strings.Contains(name, "关闭") || strings.Contains(name, "archived"):
+		return 4
+	case done || strings.Contains(name, "done") || strings.Contains(name, "resolved") || strings.Contains(name, "完成"):
+		return 3
+	case strings.Contains(name, "test") || strings.Contains(name, "review") || strings.Contains(name, "qa") || strings.Contains(name, "测试") || strings.Contains(name, "验收"):
+		return 2
+	case strings.Contains(name, "progress") || strings.Contains(name, "doing") || strings.Contains(name, "进行"):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// weightOf maps priority name to Team weight.
+func weightOf(priority string) int8 {
+	name := strings.ToLower(priority)
+
+	switch {
+	case strings.Contains(name, "blocker") || strings.Contains(name, "critical") || strings.Contains(name, "highest"):
+		return 3
+	case strings.Contains(name, "major") || strings.Contains(name, "high"):
+		return 2
+	case strings.Contains(name, "minor") || strings.Contains(name, "low") || strings.Contains(name, "trivial"):
+		return 1
+	default:
+		return 0
+	}
+}
+
+func dayOf(t time.Time) time.Time {
+	day, _ := time.Parse("2006-01-02", t.Format("2006-01-02"))
+	return day
+}
@@ -0,0 +1,241 @@
+package migrate
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type (
+	wantIssue struct {
+		key       string
+		name      string
+		content   string
+		state     int8
+		weight    int8
+		milestone string
+		assignee  []string
+		reporter  []string
+		created   string
+		resolved  string
+		due       string
+		comments  []wantRemark
+	}
+
+	wantRemark struct {
+		author  []string
+		time    string
+		content string
+	}
+
+	wantMilestone struct {
+		key   string
+		name  string
+		start string
+		end   string
+	}
+)
+
+func TestStateOf(t *testing.T) {
+	cases := []struct {
+		status string
+		done   bool
+		want   int8
+	}{
+		{"To Do", false, 0},
+		{"Backlog", false, 0},
+		{"", false, 0},
+		{"In Progress", false, 1},
+		{"Doing", false, 1},
+		{"进行中", false, 1},
+		{"In Review", false, 2},
+		{"Testing", false, 2},
+		{"QA", false, 2},
+		{"测试中", false, 2},
+		{"待验收", false, 2},
+		{"Done", false, 3},
+		{"Resolved", false, 3},
+		{"已完成", false, 3},
+		{"Fixed", true, 3},
+		{"QA", true, 3},
+		{"Closed", false, 4},
+		{"Closed", true, 4},
+		{"已关闭", false, 4},
+		{"Archived", false, 4},
+	}
+
+	for _, c := range cases {
+		if got := stateOf(c.status, c.done); got != c.want {
+			t.Errorf("stateOf(%q, %v) = %d, want %d", c.status, c.done, got, c.want)
+		}
+	}
+}
+
+func TestWeightOf(t *testing.T) {
+	cases := []struct {
+		priority string
+		want     int8
+	}{
+		{"Blocker", 3},
+		{"Critical", 3},
+		{"Highest", 3},
+		{"High", 2},
+		{"Major", 2},
+		{"Medium", 0},
+		{"", 0},
+		{"Minor", 1},
+		{"Low", 1},
+		{"Lowest", 1},
+		{"Trivial", 1},
+	}
+
+	for _, c := range cases {
+		if got := weightOf(c.priority); got != c.want {
+			t.Errorf("weightOf(%q) = %d, want %d", c.priority, got, c.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	cases := []struct {
+		kind string
+		data string
+	}{
+		{"jira-json", "{"},
+		{"jira-json", "{}"},
+		{"jira-xml", "not xml"},
+		{"trello", "["},
+		{"trello", `{"lists":[]}`},
+		{"redmine", "{}"},
+	}
+
+	for _, c := range cases {
+		if _, err := Parse(c.kind, []byte(c.data)); err == nil {
+			t.Errorf("Parse(%q, %q) should fail", c.kind, c.data)
+		}
+	}
+}
+
+func parseFixture(t *testing.T, kind, name string) *Source {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := Parse(kind, data)
+	if err != nil {
+		t.Fatalf("parse %s: %v", name, err)
+	}
+
+	return src
+}
+
+func checkMilestones(t *testing.T, got []*Milestone, want []wantMilestone) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d milestones, want %d", len(got), len(want))
+	}
+
+	for i, w := range want {
+		m := got[i]
+		if m.Key != w.key || m.Name != w.name {
+			t.Errorf("milestone %d = %q/%q, want %q/%q", i, m.Key, m.Name, w.key, w.name)
+		}
+
+		checkTime(t, w.key+" start", m.StartTime, w.start)
+		checkTime(t, w.key+" end", m.EndTime, w.end)
+	}
+}
+
+func checkIssues(t *testing.T, got []*Issue, want []wantIssue) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d issues, want %d", len(got), len(want))
+	}
+
+	for i, w := range want {
+		issue := got[i]
+		if issue.Key != w.key {
+			t.Errorf("issue %d key = %q, want %q", i, issue.Key, w.key)
+			continue
+		}
+
+		if issue.Name != w.name {
+			t.Errorf("%s name = %q, want %q", w.key, issue.Name, w.name)
+		}
+
+		if issue.Content != w.content {
+			t.Errorf("%s content = %q, want %q", w.key, issue.Content, w.content)
+		}
+
+		if issue.State != w.state {
+			t.Errorf("%s state = %d, want %d", w.key, issue.State, w.state)
+		}
+
+		if issue.Weight != w.weight {
+			t.Errorf("%s weight = %d, want %d", w.key, issue.Weight, w.weight)
+		}
+
+		if issue.Milestone != w.milestone {
+			t.Errorf("%s milestone = %q, want %q", w.key, issue.Milestone, w.milestone)
+		}
+
+		if !reflect.DeepEqual(issue.Assignee, w.assignee) {
+			t.Errorf("%s assignee = %q, want %q", w.key, issue.Assignee, w.assignee)
+		}
+
+		if !reflect.DeepEqual(issue.Reporter, w.reporter) {
+			t.Errorf("%s reporter = %q, want %q", w.key, issue.Reporter, w.reporter)
+		}
+
+		checkTime(t, w.key+" created", issue.Created, w.created)
+		checkTime(t, w.key+" resolved", issue.Resolved, w.resolved)
+		checkTime(t, w.key+" due", issue.Due, w.due)
+
+		if len(issue.Comments) != len(w.comments) {
+			t.Errorf("%s got %d comments, want %d", w.key, len(issue.Comments), len(w.comments))
+			continue
+		}
+
+		for j, wc := range w.comments {
+			c := issue.Comments[j]
+			if !reflect.DeepEqual(c.Author, wc.author) {
+				t.Errorf("%s comment %d author = %q, want %q", w.key, j, c.Author, wc.author)
+			}
+
+			if c.Content != wc.content {
+				t.Errorf("%s comment %d content = %q, want %q", w.key, j, c.Content, wc.content)
+			}
+
+			checkTime(t, w.key+" comment time", c.Time, wc.time)
+		}
+	}
+}
+
+// checkTime compares with an RFC3339 time. Empty want means zero time.
+func checkTime(t *testing.T, what string, got time.Time, want string) {
+	t.Helper()
+
+	if want == "" {
+		if !got.IsZero() {
+			t.Errorf("%s = %v, want zero", what, got)
+		}
+
+		return
+	}
+
+	expect, err := time.Parse(time.RFC3339, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !got.Equal(expect) {
+		t.Errorf("%s = %v, want %v", what, got, expect)
+	}
+}
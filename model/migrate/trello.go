@@ -0,0 +1,138 @@
+package migrate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+type (
+	trelloBoard struct {
+		Lists []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"lists"`
+		Cards []struct {
+			ID               string   `json:"id"`
+			IDShort          int      `json:"idShort"`
+			Name             string   `json:"name"`
+			Desc             string   `json:"desc"`
+			IDList           string   `json:"idList"`
+			Closed           bool     `json:"closed"`
+			Due              string   `json:"due"`
+			DueComplete      bool     `json:"dueComplete"`
+			DateLastActivity string   `json:"dateLastActivity"`
+			IDMembers        []string `json:"idMembers"`
+		} `json:"cards"`
+		Members []*trelloMember `json:"members"`
+		Actions []struct {
+			Type          string       `json:"type"`
+			Date          string       `json:"date"`
+			MemberCreator trelloMember `json:"memberCreator"`
+			Data          struct {
+				Text string `json:"text"`
+				Card struct {
+					ID string `json:"id"`
+				} `json:"card"`
+			} `json:"data"`
+		} `json:"actions"`
+	}
+
+	trelloMember struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+		FullName string `json:"fullName"`
+	}
+)
+
+// ParseTrello reads cards from Trello board JSON export. Lists are mapped to
+// task states by their names.
+func ParseTrello(data []byte) (*Source, error) {
+	board := &trelloBoard{}
+	if err := json.Unmarshal(data, board); err != nil || board.Cards == nil {
+		return nil, errors.New("无法识别的Trello导出文件")
+	}
+
+	lists := map[string]string{}
+	for _, one := range board.Lists {
+		lists[one.ID] = one.Name
+	}
+
+	members := map[string]*trelloMember{}
+	for _, one := range board.Members {
+		members[one.ID] = one
+	}
+
+	issues := map[string]*Issue{}
+	src := &Source{Milestones: []*Milestone{}, Tasks: []*Issue{}}
+
+	for _, card := range board.Cards {
+		issue := &Issue{
+			Key:      fmt.Sprintf("#%d", card.IDShort),
+			Name:     card.Name,
+			Content:  card.Desc,
+			State:    stateOf(lists[card.IDList], card.DueComplete),
+			Created:  trelloCreated(card.ID),
+			Due:      parseTime(card.Due),
+			Comments: []*Remark{},
+		}
+
+		if card.Closed {
+			issue.State = 4
+		}
+
+		if issue.State >= 3 {
+			issue.Resolved = parseTime(card.DateLastActivity)
+		}
+
+		for _, mid := range card.IDMembers {
+			if member, ok := members[mid]; ok {
+				issue.Assignee = compact(member.Username, member.FullName)
+				break
+			}
+		}
+
+		issues[card.ID] = issue
+		src.Tasks = append(src.Tasks, issue)
+	}
+
+	// Actions are listed from the newest to the oldest.
+	for i := len(board.Actions) - 1; i >= 0; i-- {
+		action := board.Actions[i]
+		issue, ok := issues[action.Data.Card.ID]
+		if !ok {
+			continue
+		}
+
+		author := compact(action.MemberCreator.Username, action.MemberCreator.FullName)
+		switch action.Type {
+		case "createCard":
+			issue.Reporter = author
+		case "commentCard":
+			issue.Comments = append(issue.Comments, &Remark{
+				Author:  author,
+				Time:    parseTime(action.Date),
+				Content: action.Data.Text,
+			})
+		}
+	}
+
+	return src, nil
+}
+
+// trelloCreated returns creation time encoded in the first 8 hex digits of
+// Trello object ID.
+func trelloCreated(id string) time.Time {
+	if len(id) < 8 {
+		return time.Time{}
+	}
+
+	seconds, err := strconv.ParseInt(id[:8], 16, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(seconds, 0)
+}
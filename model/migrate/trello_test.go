@@ -0,0 +1,49 @@
+package migrate
+
+import "testing"
+
+func TestParseTrello(t *testing.T) {
+	src := parseFixture(t, "trello", "trello.json")
+
+	checkMilestones(t, src.Milestones, []wantMilestone{})
+
+	checkIssues(t, src.Tasks, []wantIssue{
+		{
+			key:      "#1",
+			name:     "Design logo",
+			content:  "Three drafts.",
+			state:    1,
+			assignee: []string{"alice", "Alice"},
+			reporter: []string{"bob", "Bob"},
+			created:  "2024-03-01T09:45:36Z",
+			due:      "2024-03-08T10:00:00Z",
+			comments: []wantRemark{
+				{[]string{"bob", "Bob"}, "2024-03-02T09:00:00Z", "Use blue."},
+				{[]string{"alice", "Alice"}, "2024-03-04T09:00:00Z", "Second draft uploaded."},
+			},
+		},
+		{
+			key:      "#2",
+			name:     "Set up CI",
+			state:    3,
+			reporter: []string{"alice", "Alice"},
+			created:  "2024-03-01T09:45:37Z",
+			resolved: "2024-03-05T12:00:00Z",
+		},
+		{
+			key:      "#3",
+			name:     "Old idea",
+			state:    4,
+			assignee: []string{"bob", "Bob"},
+			created:  "2024-03-01T09:45:38Z",
+			resolved: "2024-03-06T08:00:00Z",
+		},
+		{
+			key:      "#4",
+			name:     "Write tests",
+			state:    3,
+			created:  "2024-03-01T09:45:39Z",
+			resolved: "2024-03-07T08:00:00Z",
+		},
+	})
+}
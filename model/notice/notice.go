@@ -8,12 +8,13 @@ import (
 )
 
 type (
-	// Notice schema
+	// Notice schema. Events of documents have non-zero DID instead of TID.
 	Notice struct {
 		ID       int64     `json:"id"`
 		Time     time.Time `json:"time" orm:"default=CURRENT_TIMESTAMP"`
 		UID      int64     `json:"uid"`
 		TID      int64     `json:"tid"`
+		DID      int64     `json:"did" orm:"notnull,default=0"`
 		Operator int64     `json:"operator"`
 		Event    int8      `json:"event"`
 	}
@@ -23,7 +24,11 @@ type (
 func GetMine(uid int64) []map[string]interface{} {
 	list := []map[string]interface{}{}
 
-	rows, err := orm.Query("SELECT `notice`.`id` AS id, `notice`.`tid` AS tid, `task`.`name` AS tname, `notice`.`operator` AS operator, `notice`.`time` AS time, `notice`.`event` AS ev FROM `notice` LEFT JOIN `task` ON `notice`.`tid`=`task`.`id` WHERE `uid`=?", uid)
+	rows, err := orm.Query(
+		"SELECT `notice`.`id` AS id, `notice`.`tid` AS tid, `task`.`name` AS tname, `notice`.`did` AS did, `document`.`title` AS dname, "+
+			"`notice`.`operator` AS operator, `notice`.`time` AS time, `notice`.`event` AS ev "+
+			"FROM `notice` LEFT JOIN `task` ON `notice`.`tid`=`task`.`id` LEFT JOIN `document` ON `notice`.`did`=`document`.`id` WHERE `uid`=?",
+		uid)
 	if err != nil {
 		return list
 	}
@@ -34,6 +39,8 @@ func GetMine(uid int64) []map[string]interface{} {
 		ID       int64
 		TID      int64
 		TName    string
+		DID      int64
+		DName    string
 		Operator int64
 		Time     time.Time
 		Ev       int16
@@ -50,6 +57,8 @@ func GetMine(uid int64) []map[string]interface{} {
 			"id":       one.ID,
 			"tid":      one.TID,
 			"tname":    one.TName,
+			"did":      one.DID,
+			"dname":    one.DName,
 			"operator": operator,
 			"time":     one.Time.Format("2006-01-02 15:04:05"),
 			"ev":       one.Ev,
@@ -70,6 +79,17 @@ func Add(tid, operator, to int64, ev int8) {
 	})
 }
 
+// AddDocument adds notice of document event to db.
+func AddDocument(did, operator, to int64, ev int8) {
+	orm.Insert(&Notice{
+		Time:     time.Now(),
+		DID:      did,
+		UID:      to,
+		Operator: operator,
+		Event:    ev,
+	})
+}
+
 // Delete notice by ID.
 func Delete(ID int64) {
 	orm.Delete("notice", ID)
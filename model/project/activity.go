@@ -0,0 +1,41 @@
+package project
+
+import (
+	"time"
+
+	"team/common/orm"
+)
+
+// Project activities.
+const (
+	ActivityAddMilestone  = 0
+	ActivityEditMilestone = 1
+	ActivityDelMilestone  = 2
+	ActivityAddMember     = 3
+	ActivityEditMember    = 4
+	ActivityDelMember     = 5
+)
+
+type (
+	// Activity schema. Holds changes of project itself, such as milestones and
+	// members. Changes of tasks are recorded as task events.
+	Activity struct {
+		ID    int64     `json:"id"`
+		PID   int64     `json:"pid"`
+		UID   int64     `json:"uid"`
+		Kind  int8      `json:"kind"`
+		Time  time.Time `json:"time" orm:"default=CURRENT_TIMESTAMP"`
+		Extra string    `json:"extra"`
+	}
+)
+
+// LogActivity records a change of this project.
+func (p *Project) LogActivity(operator int64, kind int8, extra string) {
+	orm.Insert(&Activity{
+		PID:   p.ID,
+		UID:   operator,
+		Kind:  kind,
+		Time:  time.Now(),
+		Extra: extra,
+	})
+}
@@ -0,0 +1,274 @@
+package project
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"team/common/orm"
+	"team/model/user"
+)
+
+// Kinds of custom field.
+const (
+	FieldText        = 0
+	FieldNumber      = 1
+	FieldDate        = 2
+	FieldSelect      = 3
+	FieldMultiSelect = 4
+	FieldUser        = 5
+)
+
+type (
+	// CustomField schema. Typed field defined by project administrators for tasks.
+	CustomField struct {
+		ID       int64    `json:"id"`
+		PID      int64    `json:"-"`
+		Name     string   `json:"name" orm:"type=VARCHAR(32),notnull"`
+		Kind     int8     `json:"kind"`
+		Options  []string `json:"options"`
+		Required bool     `json:"required"`
+	}
+)
+
+// FetchFields preloads all custom fields for this project.
+func (p *Project) FetchFields() {
+	p.Fields = []*CustomField{}
+
+	rows, err := orm.Query("SELECT * FROM `customfield` WHERE `pid`=?", p.ID)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		one := &CustomField{}
+		if err = orm.Scan(rows, one); err != nil {
+			continue
+		}
+
+		p.Fields = append(p.Fields, one)
+	}
+}
+
+// FindField returns custom field by ID
+func (p *Project) FindField(fid int64) *CustomField {
+	for _, one := range p.Fields {
+		if one.ID == fid {
+			return one
+		}
+	}
+
+	return nil
+}
+
+// AddField adds new custom field to this project.
+func (p *Project) AddField(name string, kind int8, options []string, required bool) error {
+	add := &CustomField{
+		PID:      p.ID,
+		Name:     name,
+		Kind:     kind,
+		Options:  options,
+		Required: required,
+	}
+
+	if err := p.checkField(add); err != nil {
+		return err
+	}
+
+	rs, err := orm.Insert(add)
+	if err == nil {
+		add.ID, _ = rs.LastInsertId()
+		p.Fields = append(p.Fields, add)
+	}
+
+	return err
+}
+
+// EditField modifies custom field in this project. Kind of field can NOT be changed.
+func (p *Project) EditField(fid int64, name string, options []string, required bool) error {
+	field := p.FindField(fid)
+	if field == nil {
+		return errors.New("编辑的字段不存在或已删除")
+	}
+
+	edited := *field
+	edited.Name = name
+	edited.Options = options
+	edited.Required = required
+	if err := p.checkField(&edited); err != nil {
+		return err
+	}
+
+	if err := orm.Update(&edited); err != nil {
+		return err
+	}
+
+	*field = edited
+	return nil
+}
+
+// DelField deletes custom field of this project by ID and all values of it.
+func (p *Project) DelField(fid int64) {
+	if p.FindField(fid) == nil {
+		return
+	}
+
+	orm.Exec("DELETE FROM `customfield` WHERE `id`=? AND `pid`=?", fid, p.ID)
+	orm.Exec("DELETE FROM `fieldvalue` WHERE `fid`=?", fid)
+
+	idx := -1
+	for i, one := range p.Fields {
+		if one.ID == fid {
+			idx = i
+			break
+		}
+	}
+
+	if idx > -1 {
+		p.Fields = append(p.Fields[:idx], p.Fields[idx+1:]...)
+	}
+}
+
+// Normalize validates submitted values for this field and returns the
+// string to store. Empty string means no value.
+func (f *CustomField) Normalize(values []string) (string, error) {
+	trimed := []string{}
+	for _, one := range values {
+		if one = strings.TrimSpace(one); len(one) > 0 {
+			trimed = append(trimed, one)
+		}
+	}
+
+	if len(trimed) == 0 {
+		if f.Required {
+			return "", fmt.Errorf("字段【%s】不可为空", f.Name)
+		}
+
+		return "", nil
+	}
+
+	if f.Kind != FieldMultiSelect && len(trimed) > 1 {
+		return "", fmt.Errorf("字段【%s】只能填写一个值", f.Name)
+	}
+
+	value := trimed[0]
+
+	switch f.Kind {
+	case FieldText:
+		return value, nil
+	case FieldNumber:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return "", fmt.Errorf("字段【%s】必须是数字", f.Name)
+		}
+
+		return value, nil
+	case FieldDate:
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return "", fmt.Errorf("字段【%s】必须是日期", f.Name)
+		}
+
+		return value, nil
+	case FieldSelect:
+		if !f.hasOption(value) {
+			return "", fmt.Errorf("字段【%s】的值不在可选范围内", f.Name)
+		}
+
+		return value, nil
+	case FieldMultiSelect:
+		for _, one := range trimed {
+			if !f.hasOption(one) {
+				return "", fmt.Errorf("字段【%s】的值不在可选范围内", f.Name)
+			}
+		}
+
+		data, _ := json.Marshal(trimed)
+		return string(data), nil
+	case FieldUser:
+		uid, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("字段【%s】必须是有效的用户", f.Name)
+		}
+
+		if u := user.Find(uid); u == nil || u.IsLocked {
+			return "", fmt.Errorf("字段【%s】指定的用户不存在或已删除", f.Name)
+		}
+
+		return value, nil
+	}
+
+	return "", fmt.Errorf("字段【%s】类型无效", f.Name)
+}
+
+// Readable returns value can be sent to client from stored string.
+func (f *CustomField) Readable(value string) interface{} {
+	switch f.Kind {
+	case FieldMultiSelect:
+		list := []string{}
+		json.Unmarshal([]byte(value), &list)
+		return list
+	case FieldUser:
+		uid, _ := strconv.ParseInt(value, 10, 64)
+		name, _ := user.FindInfo(uid)
+		return map[string]interface{}{
+			"id":   uid,
+			"name": name,
+		}
+	default:
+		return value
+	}
+}
+
+// Text returns human readable text of stored value.
+func (f *CustomField) Text(value string) string {
+	switch f.Kind {
+	case FieldMultiSelect:
+		return strings.Join(f.Readable(value).([]string), ",")
+	case FieldUser:
+		if len(value) == 0 {
+			return ""
+		}
+
+		uid, _ := strconv.ParseInt(value, 10, 64)
+		name, _ := user.FindInfo(uid)
+		return name
+	default:
+		return value
+	}
+}
+
+func (f *CustomField) hasOption(opt string) bool {
+	for _, one := range f.Options {
+		if one == opt {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Project) checkField(f *CustomField) error {
+	if f.Kind < FieldText || f.Kind > FieldUser {
+		return errors.New("无效的字段类型")
+	}
+
+	for _, one := range p.Fields {
+		if one.ID != f.ID && one.Name == f.Name {
+			return errors.New("同名字段已存在")
+		}
+	}
+
+	if f.Kind == FieldSelect || f.Kind == FieldMultiSelect {
+		if len(f.Options) == 0 {
+			return errors.New("选择类字段必须提供可选项")
+		}
+	} else {
+		f.Options = []string{}
+	}
+
+	return nil
+}
@@ -17,8 +17,11 @@ type (
 		Desc string `json:"-"`
 
 		// Runtime data.
-		Milestones []*Milestone `json:"milestones" orm:"-"`
-		Members    []*Member    `json:"members" orm:"-"`
+		Milestones []*Milestone   `json:"milestones" orm:"-"`
+		Members    []*Member      `json:"members" orm:"-"`
+		Labels     []*Label       `json:"labels" orm:"-"`
+		Fields     []*CustomField `json:"fields" orm:"-"`
+		Sprints    []*Sprint      `json:"sprints" orm:"-"`
 	}
 
 	// Milestone schema
@@ -42,6 +45,14 @@ type (
 		// Runtime data
 		User *user.User `json:"user" orm:"-"`
 	}
+
+	// Label schema
+	Label struct {
+		ID    int64  `json:"id"`
+		PID   int64  `json:"-"`
+		Name  string `json:"name" orm:"type=VARCHAR(32),notnull"`
+		Color string `json:"color" orm:"type=VARCHAR(16),notnull"`
+	}
 )
 
 var (
@@ -110,6 +121,9 @@ func Find(ID int64) *Project {
 
 	proj.FetchMilestones()
 	proj.FetchMembers()
+	proj.FetchLabels()
+	proj.FetchFields()
+	proj.FetchSprints()
 
 	projectCache.Store(proj.ID, proj)
 	return proj
@@ -140,7 +154,7 @@ func Add(name string, uid int64, role int8) error {
 		return errors.New("默认管理员当前被禁止登录")
 	}
 
-	proj := &Project{Name: name, Milestones: []*Milestone{}, Members: []*Member{}}
+	proj := &Project{Name: name, Milestones: []*Milestone{}, Members: []*Member{}, Labels: []*Label{}, Fields: []*CustomField{}, Sprints: []*Sprint{}}
 	rs, err := orm.Insert(proj)
 	if err != nil {
 		return errors.New("写入新项目失败")
@@ -160,6 +174,16 @@ func Delete(ID int64) {
 	orm.Exec("DELETE FROM `milestone` WHERE `pid`=?", ID)
 	orm.Exec("DELETE FROM `member` WHERE `pid`=?", ID)
 	orm.Exec("DELETE FROM `task` WHERE `pid`=?", ID)
+	orm.Exec("DELETE FROM `label` WHERE `pid`=?", ID)
+	orm.Exec("DELETE FROM `customfield` WHERE `pid`=?", ID)
+	orm.Exec("DELETE FROM `sprint` WHERE `pid`=?", ID)
+	orm.Exec("DELETE FROM `schedule` WHERE `pid`=?", ID)
+	orm.Exec("DELETE FROM `activity` WHERE `pid`=?", ID)
+
+	// Documents of this project no longer belong to any project. Permissions
+	// granted to roles (kind 1) of this project are meaningless then.
+	orm.Exec("DELETE FROM `permission` WHERE `kind`=1 AND `did` IN (SELECT `id` FROM `document` WHERE `pid`=?)", ID)
+	orm.Exec("UPDATE `document` SET `pid`=0 WHERE `pid`=?", ID)
 
 	projectCache.Delete(ID)
 }
@@ -195,11 +219,21 @@ func (p *Project) Info() map[string]interface{} {
 		}
 	}
 
+	sprints := []map[string]interface{}{}
+	for _, one := range p.Sprints {
+		if one.State != SprintClosed {
+			sprints = append(sprints, one.Info())
+		}
+	}
+
 	return map[string]interface{}{
 		"id":         p.ID,
 		"name":       p.Name,
 		"milestones": milestones,
+		"sprints":    sprints,
 		"members":    members,
+		"labels":     p.Labels,
+		"fields":     p.Fields,
 	}
 }
 
@@ -295,6 +329,7 @@ func (p *Project) AddMilestone(name, desc string, startTime, endTime time.Time)
 func (p *Project) DelMilestone(mid int64) {
 	orm.Delete("milestone", mid)
 	orm.Exec("UPDATE `task` SET `mid`=-1 WHERE `mid`=?", mid)
+	orm.Exec("DELETE FROM `snapshot` WHERE `mid`=?", mid)
 
 	idx := -1
 	for i, one := range p.Milestones {
@@ -390,6 +425,17 @@ func (p *Project) IsAdmin(uid int64) bool {
 	return false
 }
 
+// HasMember returns true if given user has joined this project.
+func (p *Project) HasMember(uid int64) bool {
+	for _, one := range p.Members {
+		if one.UID == uid {
+			return true
+		}
+	}
+
+	return false
+}
+
 // DelMember remove given user from this project.
 func (p *Project) DelMember(uid int64) {
 	backup := []*Member{}
@@ -402,6 +448,103 @@ func (p *Project) DelMember(uid int64) {
 	orm.Exec("DELETE FROM `member` WHERE `pid`=? AND `uid`=?", p.ID, uid)
 }
 
+// FetchLabels preloads all labels for this project.
+func (p *Project) FetchLabels() {
+	p.Labels = []*Label{}
+
+	rows, err := orm.Query("SELECT * FROM `label` WHERE `pid`=?", p.ID)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		one := &Label{}
+		if err = orm.Scan(rows, one); err != nil {
+			continue
+		}
+
+		p.Labels = append(p.Labels, one)
+	}
+}
+
+// FindLabel returns label by ID
+func (p *Project) FindLabel(lid int64) *Label {
+	for _, one := range p.Labels {
+		if one.ID == lid {
+			return one
+		}
+	}
+
+	return nil
+}
+
+// AddLabel adds new label to this project.
+func (p *Project) AddLabel(name, color string) error {
+	for _, one := range p.Labels {
+		if one.Name == name {
+			return errors.New("同名标签已存在")
+		}
+	}
+
+	add := &Label{
+		PID:   p.ID,
+		Name:  name,
+		Color: color,
+	}
+
+	rs, err := orm.Insert(add)
+	if err == nil {
+		add.ID, _ = rs.LastInsertId()
+		p.Labels = append(p.Labels, add)
+	}
+
+	return err
+}
+
+// EditLabel modifies label in this project.
+func (p *Project) EditLabel(lid int64, name, color string) error {
+	label := p.FindLabel(lid)
+	if label == nil {
+		return errors.New("编辑的标签不存在或已删除")
+	}
+
+	for _, one := range p.Labels {
+		if one.ID != lid && one.Name == name {
+			return errors.New("同名标签已存在")
+		}
+	}
+
+	label.Name = name
+	label.Color = color
+
+	return orm.Update(label)
+}
+
+// DelLabel deletes label of this project by ID. Tasks using this label will
+// lose it.
+func (p *Project) DelLabel(lid int64) {
+	if p.FindLabel(lid) == nil {
+		return
+	}
+
+	orm.Exec("DELETE FROM `label` WHERE `id`=? AND `pid`=?", lid, p.ID)
+	orm.Exec("DELETE FROM `tasklabel` WHERE `lid`=?", lid)
+
+	idx := -1
+	for i, one := range p.Labels {
+		if one.ID == lid {
+			idx = i
+			break
+		}
+	}
+
+	if idx > -1 {
+		p.Labels = append(p.Labels[:idx], p.Labels[idx+1:]...)
+	}
+}
+
 // Save project.
 func (p *Project) Save() error {
 	return orm.Update(p)
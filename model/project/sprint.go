@@ -0,0 +1,184 @@
+package project
+
+import (
+	"errors"
+	"time"
+
+	"team/common/orm"
+)
+
+// States of sprint.
+const (
+	SprintPlanning = 0
+	SprintActive   = 1
+	SprintClosed   = 2
+)
+
+type (
+	// Sprint schema. Time-boxed iteration independent of milestones.
+	Sprint struct {
+		ID        int64     `json:"id"`
+		PID       int64     `json:"-"`
+		Name      string    `json:"name" orm:"type=VARCHAR(64),notnull"`
+		Goal      string    `json:"goal"`
+		StartTime time.Time `json:"-" orm:"notnull,default='2000-01-01'"`
+		EndTime   time.Time `json:"-" orm:"notnull,default='2000-01-01'"`
+		Capacity  int32     `json:"capacity"`
+		State     int8      `json:"state"`
+	}
+)
+
+// FetchSprints preloads all sprints for this project.
+func (p *Project) FetchSprints() {
+	p.Sprints = []*Sprint{}
+
+	rows, err := orm.Query("SELECT * FROM `sprint` WHERE `pid`=? ORDER BY `starttime`", p.ID)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		one := &Sprint{}
+		if err = orm.Scan(rows, one); err != nil {
+			continue
+		}
+
+		p.Sprints = append(p.Sprints, one)
+	}
+}
+
+// GetSprints returns readable sprints of this project.
+func (p *Project) GetSprints() []map[string]interface{} {
+	list := []map[string]interface{}{}
+
+	for _, one := range p.Sprints {
+		list = append(list, one.Info())
+	}
+
+	return list
+}
+
+// FindSprint returns sprint by ID
+func (p *Project) FindSprint(sid int64) *Sprint {
+	for _, one := range p.Sprints {
+		if one.ID == sid {
+			return one
+		}
+	}
+
+	return nil
+}
+
+// ActiveSprint returns the running sprint of this project.
+func (p *Project) ActiveSprint() *Sprint {
+	for _, one := range p.Sprints {
+		if one.State == SprintActive {
+			return one
+		}
+	}
+
+	return nil
+}
+
+// AddSprint adds new sprint to this project.
+func (p *Project) AddSprint(name, goal string, startTime, endTime time.Time, capacity int32) error {
+	if endTime.Before(startTime) {
+		return errors.New("迭代结束时间不可早于开始时间")
+	}
+
+	add := &Sprint{
+		PID:       p.ID,
+		Name:      name,
+		Goal:      goal,
+		StartTime: startTime,
+		EndTime:   endTime,
+		Capacity:  capacity,
+		State:     SprintPlanning,
+	}
+
+	rs, err := orm.Insert(add)
+	if err == nil {
+		add.ID, _ = rs.LastInsertId()
+		p.Sprints = append(p.Sprints, add)
+	}
+
+	return err
+}
+
+// EditSprint modifies sprint in this project. Closed sprint can NOT be changed.
+func (p *Project) EditSprint(sid int64, name, goal string, start, end time.Time, capacity int32) error {
+	sprint := p.FindSprint(sid)
+	if sprint == nil {
+		return errors.New("编辑的迭代不存在或已删除")
+	}
+
+	if sprint.State == SprintClosed {
+		return errors.New("迭代已结束，无法修改")
+	}
+
+	if end.Before(start) {
+		return errors.New("迭代结束时间不可早于开始时间")
+	}
+
+	sprint.Name = name
+	sprint.Goal = goal
+	sprint.StartTime = start
+	sprint.EndTime = end
+	sprint.Capacity = capacity
+
+	return orm.Update(sprint)
+}
+
+// DelSprint deletes sprint that has NOT been started.
+func (p *Project) DelSprint(sid int64) error {
+	sprint := p.FindSprint(sid)
+	if sprint == nil {
+		return nil
+	}
+
+	if sprint.State != SprintPlanning {
+		return errors.New("只能删除尚未开始的迭代")
+	}
+
+	orm.Delete("sprint", sid)
+	orm.Exec("DELETE FROM `sprinttask` WHERE `sid`=?", sid)
+
+	idx := -1
+	for i, one := range p.Sprints {
+		if one.ID == sid {
+			idx = i
+			break
+		}
+	}
+
+	if idx > -1 {
+		p.Sprints = append(p.Sprints[:idx], p.Sprints[idx+1:]...)
+	}
+
+	return nil
+}
+
+// SetState changes state of this sprint.
+func (s *Sprint) SetState(state int8) error {
+	if _, err := orm.Exec("UPDATE `sprint` SET `state`=? WHERE `id`=?", state, s.ID); err != nil {
+		return err
+	}
+
+	s.State = state
+	return nil
+}
+
+// Info returns readable information of this sprint.
+func (s *Sprint) Info() map[string]interface{} {
+	return map[string]interface{}{
+		"id":        s.ID,
+		"name":      s.Name,
+		"goal":      s.Goal,
+		"startTime": s.StartTime.Format("2006-01-02"),
+		"endTime":   s.EndTime.Format("2006-01-02"),
+		"capacity":  s.Capacity,
+		"state":     s.State,
+	}
+}
@@ -0,0 +1,259 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+	"time"
+
+	"team/model/project"
+	"team/model/task"
+	"team/model/user"
+)
+
+type (
+	// Week report grouped by milestone and assignee.
+	Week struct {
+		Project    string
+		Start      string
+		End        string
+		Archived   int
+		Unarchived int
+		Milestones []*MilestoneGroup
+	}
+
+	// MilestoneGroup holds tasks of one milestone.
+	MilestoneGroup struct {
+		Name      string
+		Assignees []*AssigneeGroup
+	}
+
+	// AssigneeGroup holds tasks of one developer.
+	AssigneeGroup struct {
+		Name  string
+		Tasks []*Row
+	}
+
+	// Row is one task in report.
+	Row struct {
+		ID        int64
+		Name      string
+		State     string
+		Archived  bool
+		Tester    string
+		StartTime string
+		EndTime   string
+		Weight    string
+		Estimate  int32
+	}
+)
+
+// Build collects tasks of given week.
+func Build(proj *project.Project, weekStart int64, filter *task.Filter) *Week {
+	start := time.Unix(weekStart, 0)
+	undone, done := task.GetWeekTasks(proj.ID, weekStart, filter)
+
+	week := &Week{
+		Project:    proj.Name,
+		Start:      start.Format("2006-01-02"),
+		End:        start.AddDate(0, 0, 6).Format("2006-01-02"),
+		Archived:   len(done),
+		Unarchived: len(undone),
+		Milestones: []*MilestoneGroup{},
+	}
+
+	groups := map[int64]*MilestoneGroup{}
+	assignees := map[int64]map[int64]*AssigneeGroup{}
+
+	for _, milestone := range proj.Milestones {
+		groups[milestone.ID] = &MilestoneGroup{Name: milestone.Name, Assignees: []*AssigneeGroup{}}
+		week.Milestones = append(week.Milestones, groups[milestone.ID])
+	}
+
+	others := &MilestoneGroup{Name: "未关联里程碑", Assignees: []*AssigneeGroup{}}
+
+	add := func(t *task.Task, archived bool) {
+		mid := t.MID
+		group, ok := groups[mid]
+		if !ok {
+			mid = 0
+			group = others
+		}
+
+		if _, ok := assignees[mid]; !ok {
+			assignees[mid] = map[int64]*AssigneeGroup{}
+		}
+
+		assignee, ok := assignees[mid][t.Developer]
+		if !ok {
+			name, _ := user.FindInfo(t.Developer)
+			assignee = &AssigneeGroup{Name: name, Tasks: []*Row{}}
+			assignees[mid][t.Developer] = assignee
+			group.Assignees = append(group.Assignees, assignee)
+		}
+
+		tester, _ := user.FindInfo(t.Tester)
+		row := &Row{
+			ID:        t.ID,
+			Name:      t.Name,
+			Archived:  archived,
+			Tester:    tester,
+			StartTime: t.StartTime.Format("2006-01-02"),
+			EndTime:   t.EndTime.Format("2006-01-02"),
+			Estimate:  t.Estimate,
+		}
+
+		if int(t.State) < len(task.StateNames) {
+			row.State = task.StateNames[t.State]
+		}
+
+		if int(t.Weight) < len(task.WeightNames) {
+			row.Weight = task.WeightNames[t.Weight]
+		}
+
+		assignee.Tasks = append(assignee.Tasks, row)
+	}
+
+	for _, t := range done {
+		add(t, true)
+	}
+
+	for _, t := range undone {
+		add(t, false)
+	}
+
+	if len(others.Assignees) > 0 {
+		week.Milestones = append(week.Milestones, others)
+	}
+
+	filtered := []*MilestoneGroup{}
+	for _, group := range week.Milestones {
+		if len(group.Assignees) > 0 {
+			filtered = append(filtered, group)
+		}
+	}
+
+	week.Milestones = filtered
+	return week
+}
+
+// Title returns subject of this report.
+func (w *Week) Title() string {
+	return fmt.Sprintf("%s 周报（%s ~ %s）", w.Project, w.Start, w.End)
+}
+
+// Render report in given format. Supports md, csv and html.
+func (w *Week) Render(format string) ([]byte, string, error) {
+	switch format {
+	case "md":
+		return w.markdown(), "text/markdown; charset=utf-8", nil
+	case "csv":
+		data, err := w.csv()
+		return data, "text/csv; charset=utf-8", err
+	case "html":
+		data, err := w.html()
+		return data, "text/html; charset=utf-8", err
+	default:
+		return nil, "", errors.New("不支持的导出格式")
+	}
+}
+
+func (w *Week) markdown() []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "# %s\n\n", w.Title())
+	fmt.Fprintf(&buf, "本周验收 %d 个任务，未验收 %d 个任务。\n", w.Archived, w.Unarchived)
+
+	for _, group := range w.Milestones {
+		fmt.Fprintf(&buf, "\n## %s\n", escapeMarkdown(group.Name))
+
+		for _, assignee := range group.Assignees {
+			fmt.Fprintf(&buf, "\n### %s\n\n", escapeMarkdown(assignee.Name))
+			buf.WriteString("| 编号 | 任务 | 状态 | 优先级 | 测试 | 开始 | 结束 | 预估 |\n")
+			buf.WriteString("| --- | --- | --- | --- | --- | --- | --- | --- |\n")
+
+			for _, row := range assignee.Tasks {
+				fmt.Fprintf(&buf, "| #%d | %s | %s | %s | %s | %s | %s | %d |\n",
+					row.ID, escapeMarkdown(row.Name), row.State, row.Weight,
+					escapeMarkdown(row.Tester), row.StartTime, row.EndTime, row.Estimate)
+			}
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func (w *Week) csv() ([]byte, error) {
+	var buf bytes.Buffer
+
+	// UTF-8 BOM makes Excel decode Chinese correctly.
+	buf.WriteString("\xEF\xBB\xBF")
+
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{"里程碑", "负责人", "编号", "任务", "状态", "优先级", "测试", "开始", "结束", "预估"})
+
+	for _, group := range w.Milestones {
+		for _, assignee := range group.Assignees {
+			for _, row := range assignee.Tasks {
+				writer.Write([]string{
+					group.Name,
+					assignee.Name,
+					strconv.FormatInt(row.ID, 10),
+					row.Name,
+					row.State,
+					row.Weight,
+					row.Tester,
+					row.StartTime,
+					row.EndTime,
+					strconv.Itoa(int(row.Estimate)),
+				})
+			}
+		}
+	}
+
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+var htmlTemplate = template.Must(template.New("week").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+</head>
+<body style="font-family:sans-serif;font-size:14px;color:#333">
+<h2>{{.Title}}</h2>
+<p>本周验收 <b>{{.Archived}}</b> 个任务，未验收 <b>{{.Unarchived}}</b> 个任务。</p>
+{{range .Milestones}}
+<h3 style="border-bottom:1px solid #ddd;padding-bottom:4px">{{.Name}}</h3>
+{{range .Assignees}}
+<h4>{{.Name}}</h4>
+<table cellspacing="0" cellpadding="6" style="border-collapse:collapse;width:100%">
+<tr style="background:#f5f5f5;text-align:left">
+<th>编号</th><th>任务</th><th>状态</th><th>优先级</th><th>测试</th><th>开始</th><th>结束</th><th>预估</th>
+</tr>
+{{range .Tasks}}
+<tr style="border-top:1px solid #eee{{if .Archived}};color:#28a745{{end}}">
+<td>#{{.ID}}</td><td>{{.Name}}</td><td>{{.State}}</td><td>{{.Weight}}</td><td>{{.Tester}}</td><td>{{.StartTime}}</td><td>{{.EndTime}}</td><td>{{.Estimate}}</td>
+</tr>
+{{end}}
+</table>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+func (w *Week) html() ([]byte, error) {
+	var buf bytes.Buffer
+	err := htmlTemplate.Execute(&buf, w)
+	return buf.Bytes(), err
+}
+
+func escapeMarkdown(s string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ", "\r", "").Replace(s)
+}
@@ -0,0 +1,141 @@
+package report
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"team/common/orm"
+	"team/config"
+	"team/model/project"
+)
+
+type (
+	// Schedule schema. Sends week report of a project by mail every week.
+	Schedule struct {
+		ID         int64     `json:"id"`
+		PID        int64     `json:"pid" orm:"unique"`
+		Weekday    int8      `json:"weekday"`
+		Hour       int8      `json:"hour"`
+		Recipients string    `json:"recipients" orm:"type=TEXT"`
+		LastSent   time.Time `json:"lastSent" orm:"notnull,default='2000-01-01'"`
+	}
+)
+
+// FindSchedule returns mail schedule of given project.
+func FindSchedule(pid int64) *Schedule {
+	schedule := &Schedule{PID: pid}
+	if err := orm.Read(schedule, "pid"); err != nil {
+		return nil
+	}
+
+	return schedule
+}
+
+// SetSchedule creates or updates mail schedule of given project.
+func SetSchedule(pid int64, weekday, hour int8, recipients []string) (*Schedule, error) {
+	if weekday < 0 || weekday > 6 || hour < 0 || hour > 23 {
+		return nil, errors.New("无效的发送时间")
+	}
+
+	valid := []string{}
+	for _, one := range recipients {
+		one = strings.TrimSpace(one)
+		if one == "" {
+			continue
+		}
+
+		if !strings.Contains(one, "@") {
+			return nil, errors.New("无效的收件人地址：" + one)
+		}
+
+		valid = append(valid, one)
+	}
+
+	if len(valid) == 0 {
+		return nil, errors.New("请至少填写一个收件人")
+	}
+
+	schedule := FindSchedule(pid)
+	if schedule == nil {
+		schedule = &Schedule{PID: pid, LastSent: time.Date(2000, 1, 1, 0, 0, 0, 0, time.Local)}
+		schedule.Weekday = weekday
+		schedule.Hour = hour
+		schedule.Recipients = strings.Join(valid, ",")
+
+		result, err := orm.Insert(schedule)
+		if err != nil {
+			return nil, err
+		}
+
+		schedule.ID, _ = result.LastInsertId()
+		return schedule, nil
+	}
+
+	schedule.Weekday = weekday
+	schedule.Hour = hour
+	schedule.Recipients = strings.Join(valid, ",")
+	_, err := orm.Exec(
+		"UPDATE `schedule` SET `weekday`=?,`hour`=?,`recipients`=? WHERE `id`=?",
+		weekday, hour, schedule.Recipients, schedule.ID)
+	return schedule, err
+}
+
+// DelSchedule removes mail schedule of given project.
+func DelSchedule(pid int64) {
+	orm.Exec("DELETE FROM `schedule` WHERE `pid`=?", pid)
+}
+
+// StartScheduleJob checks mail schedules in background.
+func StartScheduleJob() {
+	go func() {
+		for {
+			SendScheduled(time.Now())
+			time.Sleep(10 * time.Minute)
+		}
+	}()
+}
+
+// SendScheduled sends week reports whose schedule is due at given time.
+func SendScheduled(now time.Time) {
+	if !config.Mailer.Enabled() {
+		return
+	}
+
+	rows, err := orm.Query("SELECT * FROM `schedule` WHERE `weekday`=? AND `hour`<=?", int8(now.Weekday()), now.Hour())
+	if err != nil {
+		return
+	}
+
+	due := []*Schedule{}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for rows.Next() {
+		one := &Schedule{}
+		if err = orm.Scan(rows, one); err == nil && one.LastSent.Before(today) {
+			due = append(due, one)
+		}
+	}
+
+	rows.Close()
+
+	weekStart := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	for _, one := range due {
+		proj := project.Find(one.PID)
+		if proj == nil {
+			continue
+		}
+
+		week := Build(proj, weekStart.Unix(), nil)
+		body, contentType, err := week.Render("html")
+		if err == nil {
+			err = config.Mailer.Send(strings.Split(one.Recipients, ","), week.Title(), contentType, body)
+		}
+
+		if err != nil {
+			log.Printf("Failed to send week report of project %d. Reason: %v\n", one.PID, err)
+		}
+
+		orm.Exec("UPDATE `schedule` SET `lastsent`=? WHERE `id`=?", now, one.ID)
+	}
+}
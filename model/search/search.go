@@ -0,0 +1,383 @@
+package search
+
+import (
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"team/common/orm"
+)
+
+// Kinds of searchable records.
+const (
+	KindDocument = 0
+	KindTask     = 1
+	KindComment  = 2
+)
+
+// Weight of a term appeared in title. Terms in content weight 1 each time.
+const titleWeight = 10
+
+// Max candidates checked for permission in one query.
+const maxCandidates = 1000
+
+// Max postings read for one term in a query. Those with higher weight are
+// preferred.
+const maxPostings = 5000
+
+type (
+	// Posting schema. Records how important a term is for a record.
+	Posting struct {
+		ID     int64  `json:"id"`
+		Kind   int8   `json:"kind"`
+		Target int64  `json:"target"`
+		Term   string `json:"term" orm:"type=VARCHAR(32),notnull,index"`
+		Weight int32  `json:"weight"`
+	}
+
+	// Entry holds readable data of a search result.
+	Entry struct {
+		Title   string
+		Content string
+		Extra   map[string]interface{}
+	}
+
+	// Source provides records of one kind to search engine.
+	Source struct {
+		// Each walks through all records. Used to rebuild index.
+		Each func(fn func(target int64, title, content string)) error
+		// Resolve returns record visible to given user, or nil.
+		Resolve func(target, uid int64) *Entry
+	}
+)
+
+var sources = map[int8]*Source{}
+
+var (
+	// indexed is the number of records in index. Negative means unknown.
+	indexed     = -1
+	indexedLock sync.Mutex
+)
+
+// Register a searchable source. Should be called in package init.
+func Register(kind int8, src *Source) {
+	sources[kind] = src
+}
+
+// Index (re)builds terms of a record.
+func Index(kind int8, target int64, title, content string) error {
+	weights := map[string]int32{}
+	tokenize(title, false, func(term string) { weights[term] += titleWeight })
+	tokenize(content, false, func(term string) { weights[term]++ })
+
+	tx, err := orm.Begin()
+	if err != nil {
+		return err
+	}
+
+	rs, err := tx.Exec("DELETE FROM `posting` WHERE `kind`=? AND `target`=?", kind, target)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	delta := 0
+	if removed, _ := rs.RowsAffected(); removed > 0 {
+		delta--
+	}
+
+	if len(weights) > 0 {
+		delta++
+	}
+
+	terms := make([]string, 0, len(weights))
+	for term := range weights {
+		terms = append(terms, term)
+	}
+
+	for start := 0; start < len(terms); start += 200 {
+		end := start + 200
+		if end > len(terms) {
+			end = len(terms)
+		}
+
+		holders := []string{}
+		args := []interface{}{}
+		for _, term := range terms[start:end] {
+			holders = append(holders, "(?,?,?,?)")
+			args = append(args, kind, target, term, weights[term])
+		}
+
+		_, err = tx.Exec("INSERT INTO `posting`(`kind`,`target`,`term`,`weight`) VALUES "+strings.Join(holders, ","), args...)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	adjustIndexed(delta)
+	return nil
+}
+
+// Remove all terms of a record.
+func Remove(kind int8, target int64) {
+	rs, err := orm.Exec("DELETE FROM `posting` WHERE `kind`=? AND `target`=?", kind, target)
+	if err != nil {
+		return
+	}
+
+	if removed, _ := rs.RowsAffected(); removed > 0 {
+		adjustIndexed(-1)
+	}
+}
+
+// Resolve returns record of given kind visible to given user, or nil.
+func Resolve(kind int8, target, uid int64) *Entry {
+	src, ok := sources[kind]
+	if !ok {
+		return nil
+	}
+
+	return src.Resolve(target, uid)
+}
+
+// Each walks through all records of registered sources.
+func Each(fn func(kind int8, target int64, title, content string)) error {
+	for kind, src := range sources {
+		k := kind
+		err := src.Each(func(target int64, title, content string) {
+			fn(k, target, title, content)
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Rebuild whole index from all registered sources.
+func Rebuild() error {
+	if _, err := orm.Exec("DELETE FROM `posting`"); err != nil {
+		return err
+	}
+
+	indexedLock.Lock()
+	indexed = 0
+	indexedLock.Unlock()
+
+	return Each(func(kind int8, target int64, title, content string) {
+		if err := Index(kind, target, title, content); err != nil {
+			log.Printf("Index record %d:%d failed. Reason: %v\n", kind, target, err)
+		}
+	})
+}
+
+// RebuildIfEmpty builds index for installations upgraded from old version.
+func RebuildIfEmpty() {
+	rows, err := orm.Query("SELECT COUNT(*) FROM `posting`")
+	if err != nil {
+		return
+	}
+
+	count := 0
+	rows.Next()
+	rows.Scan(&count)
+	rows.Close()
+
+	if count == 0 {
+		if err = Rebuild(); err != nil {
+			log.Printf("Rebuild search index failed. Reason: %v\n", err)
+		}
+	}
+}
+
+// Query records matching all terms of given text and visible to given user.
+// Negative kind means all kinds. Returns results of given page and total
+// count of visible results.
+func Query(uid int64, text string, kind int8, page, size int) ([]map[string]interface{}, int, error) {
+	list := []map[string]interface{}{}
+	if page < 1 {
+		page = 1
+	}
+
+	if size <= 0 || size > 100 {
+		size = 20
+	}
+
+	terms := Terms(text)
+	if len(terms) == 0 {
+		return list, 0, errors.New("请输入有效的关键词")
+	}
+
+	type candidate struct {
+		kind    int8
+		target  int64
+		matched map[string]int32
+		score   float64
+	}
+
+	candidates := map[[2]int64]*candidate{}
+	df := map[string]int{}
+	for _, term := range terms {
+		count, err := countTerm(term)
+		if err != nil {
+			return list, 0, err
+		}
+
+		df[term] = count
+
+		sql := "SELECT `kind`,`target`,`weight` FROM `posting` WHERE `term`=?"
+		args := []interface{}{term}
+		if kind >= 0 {
+			sql += " AND `kind`=?"
+			args = append(args, kind)
+		}
+
+		rows, err := orm.Query(sql+" ORDER BY `weight` DESC LIMIT ?", append(args, maxPostings)...)
+		if err != nil {
+			return list, 0, err
+		}
+
+		for rows.Next() {
+			one := &Posting{Term: term}
+			if err = rows.Scan(&one.Kind, &one.Target, &one.Weight); err != nil {
+				rows.Close()
+				return list, 0, err
+			}
+
+			key := [2]int64{int64(one.Kind), one.Target}
+			c, ok := candidates[key]
+			if !ok {
+				c = &candidate{kind: one.Kind, target: one.Target, matched: map[string]int32{}}
+				candidates[key] = c
+			}
+
+			c.matched[term] = one.Weight
+		}
+
+		rows.Close()
+	}
+
+	total, err := countIndexed()
+	if err != nil {
+		return list, 0, err
+	}
+
+	ranked := []*candidate{}
+	for _, c := range candidates {
+		if len(c.matched) < len(terms) {
+			continue
+		}
+
+		for term, weight := range c.matched {
+			idf := math.Log(1 + float64(total)/float64(df[term]))
+			c.score += (1 + math.Log(float64(weight))) * idf
+		}
+
+		ranked = append(ranked, c)
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+
+		return ranked[i].target > ranked[j].target
+	})
+
+	if len(ranked) > maxCandidates {
+		ranked = ranked[:maxCandidates]
+	}
+
+	visible := 0
+	skip := (page - 1) * size
+	for _, c := range ranked {
+		src, ok := sources[c.kind]
+		if !ok {
+			continue
+		}
+
+		entry := src.Resolve(c.target, uid)
+		if entry == nil {
+			continue
+		}
+
+		visible++
+		if visible <= skip || len(list) >= size {
+			continue
+		}
+
+		info := map[string]interface{}{
+			"kind":    c.kind,
+			"id":      c.target,
+			"title":   entry.Title,
+			"snippet": Snippet(entry.Content, terms, 120),
+			"score":   math.Round(c.score*100) / 100,
+		}
+
+		for k, v := range entry.Extra {
+			info[k] = v
+		}
+
+		list = append(list, info)
+	}
+
+	return list, visible, nil
+}
+
+// countIndexed returns number of records in index. It is counted once and
+// kept up to date by Index and Remove.
+func countIndexed() (int, error) {
+	indexedLock.Lock()
+	defer indexedLock.Unlock()
+
+	if indexed >= 0 {
+		return indexed, nil
+	}
+
+	rows, err := orm.Query("SELECT COUNT(DISTINCT `kind`,`target`) FROM `posting`")
+	if err != nil {
+		return 0, err
+	}
+
+	defer rows.Close()
+
+	count := 0
+	rows.Next()
+	rows.Scan(&count)
+
+	indexed = count
+	return indexed, nil
+}
+
+func adjustIndexed(delta int) {
+	indexedLock.Lock()
+	if indexed >= 0 {
+		indexed += delta
+	}
+	indexedLock.Unlock()
+}
+
+// countTerm returns number of records containing given term.
+func countTerm(term string) (int, error) {
+	rows, err := orm.Query("SELECT COUNT(*) FROM `posting` WHERE `term`=?", term)
+	if err != nil {
+		return 0, err
+	}
+
+	defer rows.Close()
+
+	count := 0
+	rows.Next()
+	rows.Scan(&count)
+	return count, nil
+}
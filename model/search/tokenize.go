@@ -0,0 +1,133 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// MaxTermLength is the max length of a single term in runes.
+const MaxTermLength = 32
+
+// Terms splits query text into distinct terms. CJK text is matched by
+// bigrams, so single characters are only used when query has nothing else.
+func Terms(query string) []string {
+	terms := []string{}
+	exists := map[string]bool{}
+
+	tokenize(query, true, func(term string) {
+		if !exists[term] {
+			exists[term] = true
+			terms = append(terms, term)
+		}
+	})
+
+	return terms
+}
+
+// tokenize splits text into terms. Latin words and numbers are kept as a
+// whole, CJK runs are split into unigrams and bigrams. When forQuery is set,
+// unigrams are skipped for CJK runs longer than one character.
+func tokenize(text string, forQuery bool, fn func(term string)) {
+	word := []rune{}
+	cjk := []rune{}
+
+	flushWord := func() {
+		if len(word) > MaxTermLength {
+			word = word[:MaxTermLength]
+		}
+
+		if len(word) > 0 {
+			fn(string(word))
+		}
+
+		word = word[:0]
+	}
+
+	flushCJK := func() {
+		if len(cjk) == 1 {
+			fn(string(cjk))
+		} else {
+			for i := range cjk {
+				if !forQuery {
+					fn(string(cjk[i]))
+				}
+
+				if i+1 < len(cjk) {
+					fn(string(cjk[i : i+2]))
+				}
+			}
+		}
+
+		cjk = cjk[:0]
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case r > 0xFFFF:
+			// Database uses 3-byte utf8, characters out of BMP can not be stored.
+			flushWord()
+			flushCJK()
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+
+	flushWord()
+	flushCJK()
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r)
+}
+
+// Snippet returns a short piece of text around the first matched term.
+func Snippet(text string, terms []string, size int) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	lower := []rune(strings.ToLower(string(runes)))
+
+	pos := -1
+	for _, term := range terms {
+		if idx := strings.Index(string(lower), term); idx >= 0 {
+			at := len([]rune(string(lower)[:idx]))
+			if pos < 0 || at < pos {
+				pos = at
+			}
+		}
+	}
+
+	// Lower case may change length of some rare characters, so clamp it.
+	start := 0
+	if pos > size/4 {
+		start = pos - size/4
+	}
+
+	if start > len(runes) {
+		start = len(runes)
+	}
+
+	end := start + size
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	snippet := string(runes[start:end])
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+
+	if end < len(runes) {
+		snippet = snippet + "…"
+	}
+
+	return snippet
+}
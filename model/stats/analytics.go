@@ -0,0 +1,199 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	// AnalyticsFilter selects tasks to be analyzed. Zero/negative value means no limit.
+	AnalyticsFilter struct {
+		PID       int64
+		MID       int64
+		Developer int64
+		Weight    int8
+	}
+)
+
+// Analytics computes lead time (created -> archived), cycle time
+// (underway -> finished), time spent in each state and weekly throughput from
+// task events. All durations are in hours.
+func Analytics(filter *AnalyticsFilter) (map[string]interface{}, error) {
+	conditions := []string{"`task`.`pid`=?"}
+	args := []interface{}{filter.PID}
+
+	if filter.MID > 0 {
+		conditions = append(conditions, "`task`.`mid`=?")
+		args = append(args, filter.MID)
+	}
+
+	if filter.Developer > 0 {
+		conditions = append(conditions, "`task`.`developer`=?")
+		args = append(args, filter.Developer)
+	}
+
+	if filter.Weight >= 0 {
+		conditions = append(conditions, "`task`.`weight`=?")
+		args = append(args, filter.Weight)
+	}
+
+	histories, err := loadStateHistories(strings.Join(conditions, " AND "), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	leads := []float64{}
+	cycles := []float64{}
+	inStates := make([][]float64, 5)
+	throughput := map[string]int{}
+
+	for _, line := range histories {
+		final := line.changes[len(line.changes)-1]
+
+		if lead, ok := line.lead(); ok {
+			leads = append(leads, lead)
+			week := weekOf(final.time).Format("2006-01-02")
+			throughput[week]++
+		}
+
+		if cycle, ok := line.cycle(); ok {
+			cycles = append(cycles, cycle)
+		}
+
+		for state, hours := range line.durations(now) {
+			if hours > 0 {
+				inStates[state] = append(inStates[state], hours)
+			}
+		}
+	}
+
+	states := []map[string]interface{}{}
+	for state, list := range inStates {
+		summary := summarize(list)
+		summary["state"] = state
+		states = append(states, summary)
+	}
+
+	weeks := []string{}
+	for week := range throughput {
+		weeks = append(weeks, week)
+	}
+
+	sort.Strings(weeks)
+
+	perWeek := []map[string]interface{}{}
+	for _, week := range weeks {
+		perWeek = append(perWeek, map[string]interface{}{
+			"week":  week,
+			"count": throughput[week],
+		})
+	}
+
+	return map[string]interface{}{
+		"tasks":      len(histories),
+		"leadTime":   summarize(leads),
+		"cycleTime":  summarize(cycles),
+		"states":     states,
+		"throughput": perWeek,
+	}, nil
+}
+
+// lead returns hours from creation to archived if task is archived now.
+func (l *stateHistory) lead() (float64, bool) {
+	final := l.changes[len(l.changes)-1]
+	if final.state != 4 {
+		return 0, false
+	}
+
+	return final.time.Sub(l.created).Hours(), true
+}
+
+// cycle returns hours from first underway to the last time it was finished.
+func (l *stateHistory) cycle() (float64, bool) {
+	final := l.changes[len(l.changes)-1]
+	if final.state < 3 {
+		return 0, false
+	}
+
+	var start, done *time.Time
+	for i := range l.changes {
+		change := &l.changes[i]
+		if change.state >= 1 && start == nil {
+			start = &change.time
+		}
+
+		if change.state >= 3 && (i == 0 || l.changes[i-1].state < 3) {
+			done = &change.time
+		}
+	}
+
+	if start == nil || done == nil {
+		return 0, false
+	}
+
+	return done.Sub(*start).Hours(), true
+}
+
+// durations returns total hours spent in each state.
+func (l *stateHistory) durations(now time.Time) []float64 {
+	ret := make([]float64, 5)
+
+	for i, change := range l.changes {
+		end := now
+		if i+1 < len(l.changes) {
+			end = l.changes[i+1].time
+		} else if change.state == 4 {
+			continue
+		}
+
+		ret[change.state] += end.Sub(change.time).Hours()
+	}
+
+	return ret
+}
+
+func summarize(list []float64) map[string]interface{} {
+	if len(list) == 0 {
+		return map[string]interface{}{"count": 0, "avg": 0, "p50": 0, "p75": 0, "p90": 0, "p95": 0}
+	}
+
+	sorted := append([]float64{}, list...)
+	sort.Float64s(sorted)
+
+	sum := 0.0
+	for _, one := range sorted {
+		sum += one
+	}
+
+	return map[string]interface{}{
+		"count": len(sorted),
+		"avg":   round(sum / float64(len(sorted))),
+		"p50":   round(percentile(sorted, 50)),
+		"p75":   round(percentile(sorted, 75)),
+		"p90":   round(percentile(sorted, 90)),
+		"p95":   round(percentile(sorted, 95)),
+	}
+}
+
+// percentile uses nearest-rank method on sorted list.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
+
+func round(hours float64) float64 {
+	return math.Round(hours*10) / 10
+}
+
+func weekOf(t time.Time) time.Time {
+	day := dayOf(t)
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
@@ -0,0 +1,308 @@
+package stats
+
+import (
+	"log"
+	"time"
+
+	"team/common/orm"
+	"team/model/project"
+	"team/model/task"
+)
+
+type (
+	// Snapshot schema. Holds task counts of a milestone at the end of one day.
+	Snapshot struct {
+		ID             int64     `json:"id"`
+		MID            int64     `json:"mid"`
+		Date           time.Time `json:"date" orm:"notnull,default='2000-01-01'"`
+		Total          int32     `json:"total"`
+		Open           int32     `json:"open"`
+		Closed         int32     `json:"closed"`
+		TotalEstimate  int32     `json:"totalEstimate"`
+		ClosedEstimate int32     `json:"closedEstimate"`
+	}
+)
+
+// StartSnapshotJob runs daily snapshot job in background. Missing history of
+// existing milestones will be rebuilt from task events at first.
+func StartSnapshotJob() {
+	go func() {
+		backfilled := false
+
+		for {
+			if !backfilled {
+				backfilled = Backfill() == nil
+			}
+
+			if backfilled {
+				TakeSnapshots(time.Now())
+			}
+
+			time.Sleep(time.Hour)
+		}
+	}()
+}
+
+// TakeSnapshots records current state of all running milestones for given day.
+func TakeSnapshots(now time.Time) {
+	projs, err := project.GetAll()
+	if err != nil {
+		return
+	}
+
+	day := dayOf(now)
+	for _, one := range projs {
+		proj := project.Find(one.ID)
+		if proj == nil {
+			continue
+		}
+
+		for _, milestone := range proj.Milestones {
+			if day.Before(dayOf(milestone.StartTime)) || day.After(dayOf(milestone.EndTime)) {
+				continue
+			}
+
+			snapshot, err := current(milestone.ID, day)
+			if err == nil {
+				err = snapshot.save()
+			}
+
+			if err != nil {
+				log.Printf("Failed to take snapshot for milestone %d. Reason: %v\n", milestone.ID, err)
+			}
+		}
+	}
+}
+
+// Backfill rebuilds missing snapshots of past days using `EventCreate` and
+// `EventModState` records in event table.
+func Backfill() error {
+	projs, err := project.GetAll()
+	if err != nil {
+		return err
+	}
+
+	today := dayOf(time.Now())
+	for _, one := range projs {
+		proj := project.Find(one.ID)
+		if proj == nil {
+			continue
+		}
+
+		for _, milestone := range proj.Milestones {
+			if err = backfillMilestone(milestone, today); err != nil {
+				log.Printf("Failed to backfill snapshots for milestone %d. Reason: %v\n", milestone.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Burndown returns daily series of given milestone with ideal line.
+func Burndown(milestone *project.Milestone) (map[string]interface{}, error) {
+	start := dayOf(milestone.StartTime)
+	end := dayOf(milestone.EndTime)
+	today := dayOf(time.Now())
+
+	rows, err := orm.Query("SELECT * FROM `snapshot` WHERE `mid`=? ORDER BY `date`", milestone.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	saved := map[string]*Snapshot{}
+	for rows.Next() {
+		one := &Snapshot{}
+		if err = orm.Scan(rows, one); err != nil {
+			return nil, err
+		}
+
+		saved[one.Date.Format("2006-01-02")] = one
+	}
+
+	days := int(end.Sub(start).Hours()/24) + 1
+	series := []map[string]interface{}{}
+	var first *Snapshot
+
+	for i := 0; i < days; i++ {
+		day := start.AddDate(0, 0, i)
+		if day.After(today) {
+			break
+		}
+
+		var snapshot *Snapshot
+		if day.Equal(today) {
+			snapshot, err = current(milestone.ID, day)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			snapshot = saved[day.Format("2006-01-02")]
+		}
+
+		if snapshot == nil {
+			continue
+		}
+
+		if first == nil {
+			first = snapshot
+		}
+
+		series = append(series, map[string]interface{}{
+			"date":           day.Format("2006-01-02"),
+			"total":          snapshot.Total,
+			"open":           snapshot.Open,
+			"closed":         snapshot.Closed,
+			"totalEstimate":  snapshot.TotalEstimate,
+			"openEstimate":   snapshot.TotalEstimate - snapshot.ClosedEstimate,
+			"closedEstimate": snapshot.ClosedEstimate,
+		})
+	}
+
+	ideal := []map[string]interface{}{}
+	if first != nil {
+		for i := 0; i < days; i++ {
+			remain := 1.0
+			if days > 1 {
+				remain = 1.0 - float64(i)/float64(days-1)
+			}
+
+			ideal = append(ideal, map[string]interface{}{
+				"date":     start.AddDate(0, 0, i).Format("2006-01-02"),
+				"open":     float64(first.Total) * remain,
+				"estimate": float64(first.TotalEstimate) * remain,
+			})
+		}
+	}
+
+	return map[string]interface{}{
+		"milestone": map[string]interface{}{
+			"id":        milestone.ID,
+			"name":      milestone.Name,
+			"startTime": start.Format("2006-01-02"),
+			"endTime":   end.Format("2006-01-02"),
+		},
+		"series": series,
+		"ideal":  ideal,
+	}, nil
+}
+
+func current(mid int64, day time.Time) (*Snapshot, error) {
+	rows, err := orm.Query("SELECT `state`,`estimate` FROM `task` WHERE `mid`=?", mid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	snapshot := &Snapshot{MID: mid, Date: day}
+	for rows.Next() {
+		one := &task.Task{}
+		if err = orm.Scan(rows, one); err != nil {
+			return nil, err
+		}
+
+		snapshot.add(one.State, one.Estimate)
+	}
+
+	return snapshot, nil
+}
+
+func backfillMilestone(milestone *project.Milestone, today time.Time) error {
+	start := dayOf(milestone.StartTime)
+	end := dayOf(milestone.EndTime)
+	if !end.Before(today) {
+		end = today.AddDate(0, 0, -1)
+	}
+
+	if end.Before(start) {
+		return nil
+	}
+
+	rows, err := orm.Query("SELECT `date` FROM `snapshot` WHERE `mid`=?", milestone.ID)
+	if err != nil {
+		return err
+	}
+
+	exists := map[string]bool{}
+	for rows.Next() {
+		one := &Snapshot{}
+		if err = orm.Scan(rows, one); err == nil {
+			exists[one.Date.Format("2006-01-02")] = true
+		}
+	}
+
+	rows.Close()
+
+	missing := []time.Time{}
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		if !exists[day.Format("2006-01-02")] {
+			missing = append(missing, day)
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	histories, err := loadStateHistories("`task`.`mid`=?", milestone.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, day := range missing {
+		snapshot := &Snapshot{MID: milestone.ID, Date: day}
+		dayEnd := day.AddDate(0, 0, 1)
+
+		for _, history := range histories {
+			if !history.created.Before(dayEnd) {
+				continue
+			}
+
+			state := int8(0)
+			for _, change := range history.changes {
+				if !change.time.Before(dayEnd) {
+					break
+				}
+
+				state = change.state
+			}
+
+			snapshot.add(state, history.estimate)
+		}
+
+		if err = snapshot.save(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Snapshot) add(state int8, estimate int32) {
+	s.Total++
+	s.TotalEstimate += estimate
+
+	if state >= 3 {
+		s.Closed++
+		s.ClosedEstimate += estimate
+	} else {
+		s.Open++
+	}
+}
+
+func (s *Snapshot) save() error {
+	_, err := orm.Exec("DELETE FROM `snapshot` WHERE `mid`=? AND `date`=?", s.MID, s.Date.Format("2006-01-02"))
+	if err != nil {
+		return err
+	}
+
+	_, err = orm.Insert(s)
+	return err
+}
+
+func dayOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,143 @@
+package stats
+
+import (
+	"strconv"
+	"time"
+
+	"team/common/orm"
+	"team/model/task"
+)
+
+type stateChange struct {
+	time  time.Time
+	state int8
+}
+
+// stateHistory holds states of a task over time. The first change is the
+// initial state when it was created.
+type stateHistory struct {
+	created  time.Time
+	estimate int32
+	changes  []stateChange
+}
+
+// loadStateHistories reads state histories of tasks matching given condition
+// on `task` table, ordered by creation.
+//
+// Older versions logged the previous state instead of the new one when a
+// task was moved to next or back step, so events are replayed from the
+// previous known state: a state event can not repeat the state it starts
+// from, thus repeating one means it is such a move. Its direction is taken
+// from the state known after it, moving forward if unknown.
+func loadStateHistories(cond string, args ...interface{}) ([]*stateHistory, error) {
+	rows, err := orm.Query("SELECT `id`,`state`,`estimate` FROM `task` WHERE "+cond, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	type current struct {
+		state    int8
+		estimate int32
+	}
+
+	tasks := map[int64]current{}
+	for rows.Next() {
+		var tid int64
+		one := current{}
+		if err = rows.Scan(&tid, &one.state, &one.estimate); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		tasks[tid] = one
+	}
+
+	rows.Close()
+
+	rows, err = orm.Query(
+		"SELECT `event`.* FROM `event` LEFT JOIN `task` ON `event`.`tid`=`task`.`id` WHERE "+cond+
+			" AND (`event`.`event`=? OR `event`.`event`=?) ORDER BY `event`.`time`,`event`.`id`",
+		append(append([]interface{}{}, args...), task.EventCreate, task.EventModState)...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	events := map[int64][]*task.Event{}
+	order := []int64{}
+	for rows.Next() {
+		ev := &task.Event{}
+		if err = orm.Scan(rows, ev); err != nil {
+			return nil, err
+		}
+
+		if _, ok := tasks[ev.TID]; !ok {
+			continue
+		}
+
+		if _, ok := events[ev.TID]; !ok {
+			order = append(order, ev.TID)
+		}
+
+		events[ev.TID] = append(events[ev.TID], ev)
+	}
+
+	list := []*stateHistory{}
+	for _, tid := range order {
+		t := tasks[tid]
+		list = append(list, replayStates(events[tid], t.state, t.estimate))
+	}
+
+	return list, nil
+}
+
+// replayStates builds state history from events of a task. Final is its
+// current state.
+func replayStates(events []*task.Event, final int8, estimate int32) *stateHistory {
+	created := events[0].Time
+	history := &stateHistory{
+		created:  created,
+		estimate: estimate,
+		changes:  []stateChange{{time: created, state: 0}},
+	}
+
+	logged := []*task.Event{}
+	for _, ev := range events {
+		if ev.Event != task.EventModState {
+			continue
+		}
+
+		if state, err := strconv.Atoi(ev.Extra); err == nil && state >= 0 && state <= 4 {
+			logged = append(logged, ev)
+		}
+	}
+
+	prev := int8(0)
+	for i, ev := range logged {
+		extra, _ := strconv.Atoi(ev.Extra)
+		state := int8(extra)
+
+		if state == prev {
+			// Legacy move to next or back step. Prefer the state known after
+			// it: the state logged by next event, or current state if none.
+			next := final
+			if i+1 < len(logged) {
+				after, _ := strconv.Atoi(logged[i+1].Extra)
+				next = int8(after)
+			}
+
+			switch {
+			case prev == 4 || (prev > 0 && next == prev-1):
+				state = prev - 1
+			default:
+				state = prev + 1
+			}
+		}
+
+		history.changes = append(history.changes, stateChange{time: ev.Time, state: state})
+		prev = state
+	}
+
+	return history
+}
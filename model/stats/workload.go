@@ -0,0 +1,207 @@
+package stats
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"team/common/orm"
+	"team/model/project"
+	"team/model/task"
+	"team/model/user"
+)
+
+type (
+	// WorkloadFilter selects tasks to be counted in workload view.
+	WorkloadFilter struct {
+		Projects   []*project.Project
+		Start      time.Time
+		End        time.Time
+		ByWeek     bool
+		ByEstimate bool
+	}
+
+	workload struct {
+		user      *user.User
+		developer []map[string]interface{}
+		tester    []map[string]interface{}
+		loads     map[string][2]float64
+	}
+)
+
+// Workload returns unfinished tasks assigned to members of given projects
+// during the date range. Load of each task (weight or estimate) is spread evenly over its
+// working days and summed by day or week, then compared with user's weekly
+// capacity. Daily capacity is a fifth of weekly capacity.
+func Workload(filter *WorkloadFilter) ([]map[string]interface{}, error) {
+	start, end := dayOf(filter.Start), dayOf(filter.End)
+	if filter.ByWeek {
+		start, end = weekOf(start), weekOf(end).AddDate(0, 0, 6)
+	}
+
+	members := map[int64]*workload{}
+	order := []int64{}
+	pids := []interface{}{}
+	holders := []string{}
+
+	for _, proj := range filter.Projects {
+		pids = append(pids, proj.ID)
+		holders = append(holders, "?")
+
+		for _, member := range proj.Members {
+			if _, ok := members[member.UID]; ok || member.User == nil {
+				continue
+			}
+
+			members[member.UID] = &workload{
+				user:      member.User,
+				developer: []map[string]interface{}{},
+				tester:    []map[string]interface{}{},
+				loads:     map[string][2]float64{},
+			}
+
+			order = append(order, member.UID)
+		}
+	}
+
+	list := []map[string]interface{}{}
+	if len(pids) == 0 {
+		return list, nil
+	}
+
+	rows, err := orm.Query(
+		"SELECT * FROM `task` WHERE `pid` IN ("+strings.Join(holders, ",")+") AND `state`<3 AND `starttime`<=? AND `endtime`>=?",
+		append(pids, end, start)...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	tasks := []*task.Task{}
+	for rows.Next() {
+		t := &task.Task{}
+		if err = orm.Scan(rows, t); err != nil {
+			return nil, err
+		}
+
+		tasks = append(tasks, t)
+	}
+
+	briefs := task.Briefs(tasks)
+	for i, t := range tasks {
+		load := float64(t.Weight)
+		if filter.ByEstimate {
+			load = float64(t.Estimate)
+		}
+
+		days := workingDays(dayOf(t.StartTime), dayOf(t.EndTime))
+		for role, uid := range []int64{t.Developer, t.Tester} {
+			one, ok := members[uid]
+			if !ok {
+				continue
+			}
+
+			if role == 0 {
+				one.developer = append(one.developer, briefs[i])
+			} else {
+				one.tester = append(one.tester, briefs[i])
+			}
+
+			for _, day := range days {
+				if day.Before(start) || day.After(end) {
+					continue
+				}
+
+				key := periodOf(day, filter.ByWeek)
+				sum := one.loads[key]
+				sum[role] += load / float64(len(days))
+				one.loads[key] = sum
+			}
+		}
+	}
+
+	for _, uid := range order {
+		one := members[uid]
+
+		capacity := float64(one.user.Capacity)
+		if !filter.ByWeek {
+			capacity = capacity / 5
+		}
+
+		over := false
+		periods := []map[string]interface{}{}
+		for day := start; !day.After(end); day = nextPeriod(day, filter.ByWeek) {
+			sum := one.loads[periodOf(day, filter.ByWeek)]
+			total := sum[0] + sum[1]
+			exceed := total > capacity
+			over = over || exceed
+
+			periods = append(periods, map[string]interface{}{
+				"period":    day.Format("2006-01-02"),
+				"developer": roundLoad(sum[0]),
+				"tester":    roundLoad(sum[1]),
+				"total":     roundLoad(total),
+				"capacity":  roundLoad(capacity),
+				"over":      exceed,
+			})
+		}
+
+		list = append(list, map[string]interface{}{
+			"id":        one.user.ID,
+			"name":      one.user.Name,
+			"avatar":    one.user.Avatar,
+			"capacity":  one.user.Capacity,
+			"developer": one.developer,
+			"tester":    one.tester,
+			"periods":   periods,
+			"over":      over,
+		})
+	}
+
+	return list, nil
+}
+
+// workingDays returns weekdays between start and end. All days are returned
+// if the range only covers weekend.
+func workingDays(start, end time.Time) []time.Time {
+	all := []time.Time{}
+	weekdays := []time.Time{}
+
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		all = append(all, day)
+		if day.Weekday() != time.Saturday && day.Weekday() != time.Sunday {
+			weekdays = append(weekdays, day)
+		}
+	}
+
+	if len(weekdays) == 0 {
+		if len(all) == 0 {
+			return []time.Time{start}
+		}
+
+		return all
+	}
+
+	return weekdays
+}
+
+func periodOf(day time.Time, byWeek bool) string {
+	if byWeek {
+		return weekOf(day).Format("2006-01-02")
+	}
+
+	return day.Format("2006-01-02")
+}
+
+func nextPeriod(day time.Time, byWeek bool) time.Time {
+	if byWeek {
+		return day.AddDate(0, 0, 7)
+	}
+
+	return day.AddDate(0, 0, 1)
+}
+
+func roundLoad(load float64) float64 {
+	return math.Round(load*100) / 100
+}
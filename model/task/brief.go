@@ -0,0 +1,155 @@
+package task
+
+import (
+	"strings"
+
+	"team/common/orm"
+	"team/model/project"
+	"team/model/user"
+)
+
+// Max IDs in one `IN` condition when loading extras of tasks.
+const batchSize = 500
+
+// briefExtras holds labels, custom field values and current sprints of
+// tasks, loaded in batch for brief messages.
+type briefExtras struct {
+	labels  map[int64][]int64
+	values  map[int64]map[int64]string
+	sprints map[int64]int64
+}
+
+// Briefs returns brief messages of given tasks. Labels, custom fields and
+// sprints of all tasks are loaded with a few queries instead of per task.
+func Briefs(tasks []*Task) []map[string]interface{} {
+	extras := loadBriefExtras(tasks)
+
+	list := make([]map[string]interface{}, 0, len(tasks))
+	for _, t := range tasks {
+		list = append(list, t.brief(extras))
+	}
+
+	return list
+}
+
+// Brief return brief message for this task.
+func (t *Task) Brief() map[string]interface{} {
+	return Briefs([]*Task{t})[0]
+}
+
+func (t *Task) brief(extras *briefExtras) map[string]interface{} {
+	creator := user.Find(t.Creator)
+	developer := user.Find(t.Developer)
+	tester := user.Find(t.Tester)
+	proj := project.Find(t.PID)
+
+	brief := map[string]interface{}{
+		"id":   t.ID,
+		"name": t.Name,
+		"proj": map[string]interface{}{
+			"id":   proj.ID,
+			"name": proj.Name,
+		},
+		"bringTop": t.BringTop,
+		"weight":   t.Weight,
+		"estimate": t.Estimate,
+		"state":    t.State,
+		"creator": map[string]interface{}{
+			"id":   creator.ID,
+			"name": creator.Name,
+		},
+		"developer": map[string]interface{}{
+			"id":   developer.ID,
+			"name": developer.Name,
+		},
+		"tester": map[string]interface{}{
+			"id":   tester.ID,
+			"name": tester.Name,
+		},
+		"startTime": t.StartTime.Format("2006-01-02"),
+		"endTime":   t.EndTime.Format("2006-01-02"),
+		"labels":    labelsOf(proj, extras.labels[t.ID]),
+		"fields":    fieldsOf(proj, extras.values[t.ID]),
+	}
+
+	if milestone := proj.FindMilestone(t.MID); milestone != nil {
+		brief["milestone"] = map[string]interface{}{
+			"id":   t.MID,
+			"name": milestone.Name,
+		}
+	}
+
+	if sid, ok := extras.sprints[t.ID]; ok {
+		if sprint := proj.FindSprint(sid); sprint != nil {
+			brief["sprint"] = map[string]interface{}{
+				"id":   sprint.ID,
+				"name": sprint.Name,
+			}
+		}
+	}
+
+	return brief
+}
+
+func loadBriefExtras(tasks []*Task) *briefExtras {
+	extras := &briefExtras{
+		labels:  map[int64][]int64{},
+		values:  map[int64]map[int64]string{},
+		sprints: map[int64]int64{},
+	}
+
+	for start := 0; start < len(tasks); start += batchSize {
+		end := start + batchSize
+		if end > len(tasks) {
+			end = len(tasks)
+		}
+
+		ids := []interface{}{}
+		for _, t := range tasks[start:end] {
+			ids = append(ids, t.ID)
+		}
+
+		in := "(?" + strings.Repeat(",?", len(ids)-1) + ")"
+
+		if rows, err := orm.Query("SELECT `tid`,`lid` FROM `tasklabel` WHERE `tid` IN "+in+" ORDER BY `id`", ids...); err == nil {
+			for rows.Next() {
+				var tid, lid int64
+				if rows.Scan(&tid, &lid) == nil {
+					extras.labels[tid] = append(extras.labels[tid], lid)
+				}
+			}
+
+			rows.Close()
+		}
+
+		if rows, err := orm.Query("SELECT `tid`,`fid`,`value` FROM `fieldvalue` WHERE `tid` IN "+in, ids...); err == nil {
+			for rows.Next() {
+				var tid, fid int64
+				var value string
+				if rows.Scan(&tid, &fid, &value) == nil {
+					if extras.values[tid] == nil {
+						extras.values[tid] = map[int64]string{}
+					}
+
+					extras.values[tid][fid] = value
+				}
+			}
+
+			rows.Close()
+		}
+
+		args := append([]interface{}{SprintTaskOpen}, ids...)
+		if rows, err := orm.Query("SELECT `tid`,`sid` FROM `sprinttask` WHERE `result`=? AND `tid` IN "+in, args...); err == nil {
+			for rows.Next() {
+				var tid, sid int64
+				if rows.Scan(&tid, &sid) == nil {
+					extras.sprints[tid] = sid
+				}
+			}
+
+			rows.Close()
+		}
+	}
+
+	return extras
+}
@@ -0,0 +1,325 @@
+package task
+
+import (
+	"errors"
+	"time"
+	"unicode/utf8"
+
+	"team/common/orm"
+	"team/model/user"
+)
+
+type (
+	// Comment schema
+	Comment struct {
+		ID        int64     `json:"id"`
+		TID       int64     `json:"tid"`
+		UID       int64     `json:"uid"`
+		Parent    int64     `json:"parent" orm:"notnull,default=0"`
+		Time      time.Time `json:"time" orm:"default=CURRENT_TIMESTAMP"`
+		Comment   string    `json:"comment"`
+		IsEdited  bool      `json:"isEdited" orm:"notnull,default=0"`
+		IsDeleted bool      `json:"isDeleted" orm:"notnull,default=0"`
+	}
+
+	// CommentHistory schema. Holds content of a comment before it was edited or deleted.
+	CommentHistory struct {
+		ID      int64     `json:"id"`
+		CID     int64     `json:"cid"`
+		UID     int64     `json:"uid"`
+		Time    time.Time `json:"time" orm:"default=CURRENT_TIMESTAMP"`
+		Comment string    `json:"comment"`
+	}
+
+	// CommentReaction schema
+	CommentReaction struct {
+		ID    int64  `json:"id"`
+		CID   int64  `json:"cid"`
+		UID   int64  `json:"uid"`
+		Emoji string `json:"emoji" orm:"type=VARCHAR(16),notnull"`
+	}
+)
+
+// FindComment returns comment by ID.
+func FindComment(ID int64) *Comment {
+	c := &Comment{ID: ID}
+	if err := orm.Read(c); err != nil {
+		return nil
+	}
+
+	return c
+}
+
+// AddComment for this task. Replies to a reply will be threaded under the root comment.
+func (t *Task) AddComment(uid, parent int64, content string) (*Comment, error) {
+	if parent > 0 {
+		reply := FindComment(parent)
+		if reply == nil || reply.TID != t.ID || reply.IsDeleted {
+			return nil, errors.New("回复的评论不存在或已删除")
+		}
+
+		if reply.Parent > 0 {
+			parent = reply.Parent
+		}
+	} else {
+		parent = 0
+	}
+
+	add := &Comment{
+		TID:     t.ID,
+		UID:     uid,
+		Parent:  parent,
+		Time:    time.Now(),
+		Comment: content,
+	}
+
+	rs, err := orm.Insert(add)
+	if err != nil {
+		return nil, err
+	}
+
+	add.ID, _ = rs.LastInsertId()
+	add.Reindex()
+	return add, nil
+}
+
+// GetComments returns all comments of this task. Replies are nested in their parent.
+func (t *Task) GetComments() []map[string]interface{} {
+	list := []map[string]interface{}{}
+
+	rows, err := orm.Query("SELECT * FROM `comment` WHERE `tid`=? ORDER BY `id`", t.ID)
+	if err != nil {
+		return list
+	}
+
+	defer rows.Close()
+
+	reactions := t.getCommentReactions()
+	threads := map[int64][]map[string]interface{}{}
+	comments := []*Comment{}
+
+	for rows.Next() {
+		one := &Comment{}
+		if err = orm.Scan(rows, one); err != nil {
+			return list
+		}
+
+		if one.Parent > 0 {
+			if !one.IsDeleted {
+				threads[one.Parent] = append(threads[one.Parent], one.info(reactions[one.ID]))
+			}
+		} else {
+			comments = append(comments, one)
+		}
+	}
+
+	for _, one := range comments {
+		replies, ok := threads[one.ID]
+		if one.IsDeleted && !ok {
+			continue
+		}
+
+		if !ok {
+			replies = []map[string]interface{}{}
+		}
+
+		info := one.info(reactions[one.ID])
+		info["replies"] = replies
+		list = append(list, info)
+	}
+
+	return list
+}
+
+// Edit changes content of this comment and keeps the old one in history.
+func (c *Comment) Edit(operator int64, content string) error {
+	if c.IsDeleted {
+		return errors.New("评论不存在或已删除")
+	}
+
+	if content == c.Comment {
+		return nil
+	}
+
+	if err := c.backup(operator); err != nil {
+		return err
+	}
+
+	_, err := orm.Exec("UPDATE `comment` SET `comment`=?,`isedited`=1 WHERE `id`=?", content, c.ID)
+	if err != nil {
+		return err
+	}
+
+	c.Comment = content
+	c.IsEdited = true
+	c.Reindex()
+	return nil
+}
+
+// Delete marks this comment as deleted. Content is kept in history.
+func (c *Comment) Delete(operator int64) error {
+	if c.IsDeleted {
+		return nil
+	}
+
+	if err := c.backup(operator); err != nil {
+		return err
+	}
+
+	_, err := orm.Exec("UPDATE `comment` SET `comment`='',`isdeleted`=1 WHERE `id`=?", c.ID)
+	if err != nil {
+		return err
+	}
+
+	orm.Exec("DELETE FROM `commentreaction` WHERE `cid`=?", c.ID)
+
+	c.Comment = ""
+	c.IsDeleted = true
+	c.Reindex()
+	return nil
+}
+
+// GetHistory returns all old contents of this comment.
+func (c *Comment) GetHistory() []map[string]interface{} {
+	list := []map[string]interface{}{}
+
+	rows, err := orm.Query("SELECT * FROM `commenthistory` WHERE `cid`=? ORDER BY `id` DESC", c.ID)
+	if err != nil {
+		return list
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		one := &CommentHistory{}
+		if err = orm.Scan(rows, one); err != nil {
+			return list
+		}
+
+		name, _ := user.FindInfo(one.UID)
+
+		list = append(list, map[string]interface{}{
+			"time":     one.Time.Format("2006-01-02 15:04:05"),
+			"operator": name,
+			"content":  one.Comment,
+		})
+	}
+
+	return list
+}
+
+// ToggleReaction adds emoji reaction of given user to this comment, or removes it if exists.
+func (c *Comment) ToggleReaction(uid int64, emoji string) error {
+	if c.IsDeleted {
+		return errors.New("评论不存在或已删除")
+	}
+
+	if len(emoji) == 0 || len(emoji) > 16 || !utf8.ValidString(emoji) {
+		return errors.New("无效的表情")
+	}
+
+	rs, err := orm.Exec("DELETE FROM `commentreaction` WHERE `cid`=? AND `uid`=? AND `emoji`=?", c.ID, uid, emoji)
+	if err != nil {
+		return err
+	}
+
+	if affected, _ := rs.RowsAffected(); affected > 0 {
+		return nil
+	}
+
+	_, err = orm.Insert(&CommentReaction{
+		CID:   c.ID,
+		UID:   uid,
+		Emoji: emoji,
+	})
+
+	return err
+}
+
+func (c *Comment) backup(operator int64) error {
+	_, err := orm.Insert(&CommentHistory{
+		CID:     c.ID,
+		UID:     operator,
+		Time:    time.Now(),
+		Comment: c.Comment,
+	})
+
+	return err
+}
+
+func (c *Comment) info(reactions []map[string]interface{}) map[string]interface{} {
+	name, avatar := user.FindInfo(c.UID)
+
+	if reactions == nil {
+		reactions = []map[string]interface{}{}
+	}
+
+	return map[string]interface{}{
+		"id":        c.ID,
+		"uid":       c.UID,
+		"parent":    c.Parent,
+		"time":      c.Time.Format("2006-01-02 15:04:05"),
+		"user":      name,
+		"avatar":    avatar,
+		"content":   c.Comment,
+		"isEdited":  c.IsEdited,
+		"isDeleted": c.IsDeleted,
+		"reactions": reactions,
+	}
+}
+
+func (t *Task) getCommentReactions() map[int64][]map[string]interface{} {
+	ret := map[int64][]map[string]interface{}{}
+
+	rows, err := orm.Query(
+		"SELECT `commentreaction`.* FROM `commentreaction` LEFT JOIN `comment` ON `commentreaction`.`cid`=`comment`.`id` "+
+			"WHERE `comment`.`tid`=? ORDER BY `commentreaction`.`id`",
+		t.ID)
+	if err != nil {
+		return ret
+	}
+
+	defer rows.Close()
+
+	type group struct {
+		emoji string
+		users []string
+	}
+
+	groups := map[int64][]*group{}
+	for rows.Next() {
+		one := &CommentReaction{}
+		if err = orm.Scan(rows, one); err != nil {
+			return ret
+		}
+
+		name, _ := user.FindInfo(one.UID)
+
+		var found *group
+		for _, g := range groups[one.CID] {
+			if g.emoji == one.Emoji {
+				found = g
+				break
+			}
+		}
+
+		if found == nil {
+			found = &group{emoji: one.Emoji, users: []string{}}
+			groups[one.CID] = append(groups[one.CID], found)
+		}
+
+		found.users = append(found.users, name)
+	}
+
+	for cid, list := range groups {
+		for _, g := range list {
+			ret[cid] = append(ret[cid], map[string]interface{}{
+				"emoji": g.emoji,
+				"count": len(g.users),
+				"users": g.users,
+			})
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,554 @@
+package task
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"team/common/orm"
+	"team/model/notice"
+	"team/model/project"
+	"team/model/user"
+)
+
+type (
+	// Query selects tasks to be exported. Zero value means no limit.
+	Query struct {
+		UID          int64
+		PID          int64
+		MID          int64
+		SID          int64
+		WithArchived bool
+		Filter       *Filter
+	}
+
+	// ImportRow is one task parsed from CSV file.
+	ImportRow struct {
+		Line      int
+		Name      string
+		MID       int64
+		Creator   int64
+		Developer int64
+		Tester    int64
+		Weight    int8
+		Estimate  int32
+		StartTime time.Time
+		EndTime   time.Time
+		Content   string
+		Fields    map[int64]string
+		Errors    []string
+	}
+)
+
+// ImportColumns maps importable task fields to default CSV headers.
+var ImportColumns = map[string][]string{
+	"name":      {"name", "任务", "任务名"},
+	"milestone": {"milestone", "里程碑"},
+	"creator":   {"creatorName", "creator", "创建者"},
+	"developer": {"developerName", "developer", "开发者"},
+	"tester":    {"testerName", "tester", "测试者"},
+	"weight":    {"weight", "优先级"},
+	"estimate":  {"estimate", "预估", "工作量"},
+	"startTime": {"startTime", "开始时间", "开始"},
+	"endTime":   {"endTime", "结束时间", "结束"},
+	"content":   {"content", "内容"},
+}
+
+var exportHeader = []string{
+	"id", "pid", "project", "mid", "milestone",
+	"creator", "creatorName", "developer", "developerName", "tester", "testerName",
+	"name", "bringTop", "weight", "estimate", "state", "stateName",
+	"startTime", "endTime", "archiveTime", "content",
+}
+
+// Search returns tasks matching given query.
+func Search(q *Query) ([]*Task, error) {
+	conditions := []string{}
+	args := []interface{}{}
+
+	if !q.WithArchived {
+		conditions = append(conditions, "`state`<4")
+	}
+
+	if q.UID > 0 {
+		conditions = append(conditions, "(`creator`=? OR `developer`=? OR `tester`=?)")
+		args = append(args, q.UID, q.UID, q.UID)
+	}
+
+	if q.PID > 0 {
+		conditions = append(conditions, "`pid`=?")
+		args = append(args, q.PID)
+	}
+
+	if q.MID > 0 {
+		conditions = append(conditions, "`mid`=?")
+		args = append(args, q.MID)
+	}
+
+	if q.SID > 0 {
+		conditions = append(conditions, "`id` IN (SELECT `tid` FROM `sprinttask` WHERE `sid`=?)")
+		args = append(args, q.SID)
+	}
+
+	if len(conditions) == 0 {
+		return nil, errors.New("未指定导出范围")
+	}
+
+	cond, extra := q.Filter.where()
+	rows, err := orm.Query(
+		"SELECT * FROM `task` WHERE "+strings.Join(conditions, " AND ")+cond+" ORDER BY `id`",
+		append(args, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	list := []*Task{}
+	for rows.Next() {
+		one := &Task{}
+		if err = orm.Scan(rows, one); err != nil {
+			return nil, err
+		}
+
+		list = append(list, one)
+	}
+
+	return list, nil
+}
+
+// ExportCSV renders tasks as CSV with all fields and readable names.
+func ExportCSV(tasks []*Task) ([]byte, error) {
+	var buf bytes.Buffer
+
+	// UTF-8 BOM makes Excel decode Chinese correctly.
+	buf.WriteString("\xEF\xBB\xBF")
+
+	writer := csv.NewWriter(&buf)
+	writer.Write(exportHeader)
+
+	for _, t := range tasks {
+		projName, milestoneName := "", ""
+		if proj := project.Find(t.PID); proj != nil {
+			projName = proj.Name
+			if milestone := proj.FindMilestone(t.MID); milestone != nil {
+				milestoneName = milestone.Name
+			}
+		}
+
+		creator, _ := user.FindInfo(t.Creator)
+		developer, _ := user.FindInfo(t.Developer)
+		tester, _ := user.FindInfo(t.Tester)
+
+		state := ""
+		if int(t.State) < len(StateNames) {
+			state = StateNames[t.State]
+		}
+
+		archiveTime := ""
+		if t.State == 4 {
+			archiveTime = t.ArchiveTime.Format("2006-01-02 15:04:05")
+		}
+
+		writer.Write([]string{
+			strconv.FormatInt(t.ID, 10),
+			strconv.FormatInt(t.PID, 10),
+			projName,
+			strconv.FormatInt(t.MID, 10),
+			milestoneName,
+			strconv.FormatInt(t.Creator, 10),
+			creator,
+			strconv.FormatInt(t.Developer, 10),
+			developer,
+			strconv.FormatInt(t.Tester, 10),
+			tester,
+			t.Name,
+			strconv.FormatBool(t.BringTop),
+			strconv.Itoa(int(t.Weight)),
+			strconv.Itoa(int(t.Estimate)),
+			strconv.Itoa(int(t.State)),
+			state,
+			t.StartTime.Format("2006-01-02"),
+			t.EndTime.Format("2006-01-02"),
+			archiveTime,
+			t.Content,
+		})
+	}
+
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// ParseImport reads tasks from CSV data and validates each row. Mapping is
+// task field -> CSV header; unmapped fields use default headers in
+// ImportColumns. Custom fields are mapped by `field_<ID>` and read from
+// columns named after them by default.
+func ParseImport(proj *project.Project, operator int64, data io.Reader, mapping map[string]string) ([]*ImportRow, error) {
+	reader := csv.NewReader(data)
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("CSV文件格式错误：%v", err)
+	}
+
+	if len(records) < 2 {
+		return nil, errors.New("CSV文件中没有任务数据")
+	}
+
+	header := records[0]
+	header[0] = strings.TrimPrefix(header[0], "\xEF\xBB\xBF")
+
+	index := map[string]int{}
+	for field, defaults := range ImportColumns {
+		candidates := defaults
+		if wanted, ok := mapping[field]; ok && wanted != "" {
+			candidates = []string{wanted}
+		}
+
+		for _, name := range candidates {
+			for i, col := range header {
+				if strings.EqualFold(strings.TrimSpace(col), name) {
+					index[field] = i
+					break
+				}
+			}
+
+			if _, ok := index[field]; ok {
+				break
+			}
+		}
+
+		if _, ok := index[field]; !ok && mapping[field] != "" {
+			return nil, fmt.Errorf("CSV文件中不存在列【%s】", mapping[field])
+		}
+	}
+
+	if _, ok := index["name"]; !ok {
+		return nil, errors.New("未找到任务名所在的列")
+	}
+
+	fieldIndex := map[int64]int{}
+	for _, f := range proj.Fields {
+		key := fmt.Sprintf("field_%d", f.ID)
+		name := f.Name
+		if wanted := mapping[key]; wanted != "" {
+			name = wanted
+		}
+
+		for i, col := range header {
+			if strings.EqualFold(strings.TrimSpace(col), name) {
+				fieldIndex[f.ID] = i
+				break
+			}
+		}
+
+		if _, ok := fieldIndex[f.ID]; !ok && mapping[key] != "" {
+			return nil, fmt.Errorf("CSV文件中不存在列【%s】", mapping[key])
+		}
+	}
+
+	users, err := user.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []*ImportRow{}
+	for n, record := range records[1:] {
+		value := func(field string) string {
+			if i, ok := index[field]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+
+			return ""
+		}
+
+		row := &ImportRow{
+			Line:    n + 2,
+			Name:    value("name"),
+			Content: value("content"),
+			Errors:  []string{},
+		}
+
+		if row.Name == "" {
+			row.Errors = append(row.Errors, "任务名不可为空")
+		} else if utf8.RuneCountInString(row.Name) > 128 {
+			row.Errors = append(row.Errors, "任务名过长")
+		}
+
+		if name := value("milestone"); name != "" {
+			milestone := findMilestoneByName(proj, name)
+			if milestone == nil {
+				row.Errors = append(row.Errors, "里程碑【"+name+"】不存在")
+			} else {
+				row.MID = milestone.ID
+			}
+		}
+
+		row.Creator = resolveUser(users, value("creator"), operator, "创建者", row)
+		row.Developer = resolveUser(users, value("developer"), operator, "开发者", row)
+		row.Tester = resolveUser(users, value("tester"), operator, "测试者", row)
+
+		if weight := value("weight"); weight != "" {
+			row.Weight = -1
+			for i, name := range WeightNames {
+				if weight == name || weight == strconv.Itoa(i) {
+					row.Weight = int8(i)
+				}
+			}
+
+			if row.Weight < 0 {
+				row.Errors = append(row.Errors, "无效的优先级："+weight)
+				row.Weight = 0
+			}
+		}
+
+		if estimate := value("estimate"); estimate != "" {
+			n, err := strconv.Atoi(estimate)
+			if err != nil || n < 0 {
+				row.Errors = append(row.Errors, "无效的工作量估算："+estimate)
+			} else {
+				row.Estimate = int32(n)
+			}
+		}
+
+		row.StartTime = today()
+		if milestone := proj.FindMilestone(row.MID); milestone != nil && row.StartTime.Before(milestone.StartTime) {
+			row.StartTime = milestone.StartTime
+		}
+
+		if start := value("startTime"); start != "" {
+			if parsed, ok := parseDate(start); ok {
+				row.StartTime = parsed
+			} else {
+				row.Errors = append(row.Errors, "无效的开始时间："+start)
+			}
+		}
+
+		row.EndTime = row.StartTime
+		if end := value("endTime"); end != "" {
+			if parsed, ok := parseDate(end); ok {
+				row.EndTime = parsed
+			} else {
+				row.Errors = append(row.Errors, "无效的结束时间："+end)
+			}
+		}
+
+		check := &Task{PID: proj.ID, MID: row.MID}
+		if err := check.CheckTime(row.StartTime, row.EndTime); err != nil {
+			row.Errors = append(row.Errors, err.Error())
+		}
+
+		row.Fields = map[int64]string{}
+		for _, f := range proj.Fields {
+			cell := ""
+			if i, ok := fieldIndex[f.ID]; ok && i < len(record) {
+				cell = strings.TrimSpace(record[i])
+			}
+
+			if normalized, err := f.Normalize(fieldCell(users, f, cell)); err != nil {
+				row.Errors = append(row.Errors, err.Error())
+			} else {
+				row.Fields[f.ID] = normalized
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// Import creates tasks from validated rows. Either all rows are imported or
+// none of them.
+func Import(proj *project.Project, operator int64, rows []*ImportRow) ([]*Task, error) {
+	for _, row := range rows {
+		if len(row.Errors) > 0 {
+			return nil, fmt.Errorf("第%d行数据有误，请修正后再导入", row.Line)
+		}
+	}
+
+	tx, err := orm.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	added := []*Task{}
+	for _, row := range rows {
+		t := &Task{
+			PID:         proj.ID,
+			MID:         row.MID,
+			Creator:     row.Creator,
+			Developer:   row.Developer,
+			Tester:      row.Tester,
+			Name:        row.Name,
+			Weight:      row.Weight,
+			Estimate:    row.Estimate,
+			StartTime:   row.StartTime,
+			EndTime:     row.EndTime,
+			ArchiveTime: TimeInfinite,
+			Content:     row.Content,
+		}
+
+		result, err := tx.Insert(t)
+		if err == nil {
+			t.ID, _ = result.LastInsertId()
+			_, err = tx.Insert(&Revision{TID: t.ID, UID: operator, Field: RevisionName, Time: now, Content: t.Name})
+		}
+
+		if err == nil {
+			_, err = tx.Insert(&Revision{TID: t.ID, UID: operator, Field: RevisionContent, Time: now, Content: t.Content})
+		}
+
+		if err == nil {
+			_, err = tx.Insert(&Event{TID: t.ID, UID: operator, Event: EventCreate, Time: now})
+		}
+
+		for fid, value := range row.Fields {
+			if err == nil && len(value) > 0 {
+				_, err = tx.Insert(&FieldValue{TID: t.ID, FID: fid, Value: value})
+			}
+		}
+
+		if err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("导入第%d行失败：%v", row.Line, err)
+		}
+
+		added = append(added, t)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	for _, t := range added {
+		t.Reindex()
+
+		notified := map[int64]bool{operator: true}
+		for _, uid := range []int64{t.Creator, t.Developer, t.Tester} {
+			if !notified[uid] {
+				notice.Add(t.ID, operator, uid, EventCreate)
+				notified[uid] = true
+			}
+		}
+	}
+
+	return added, nil
+}
+
+// Info returns preview of this row.
+func (r *ImportRow) Info() map[string]interface{} {
+	creator, _ := user.FindInfo(r.Creator)
+	developer, _ := user.FindInfo(r.Developer)
+	tester, _ := user.FindInfo(r.Tester)
+
+	return map[string]interface{}{
+		"line":      r.Line,
+		"name":      r.Name,
+		"mid":       r.MID,
+		"creator":   creator,
+		"developer": developer,
+		"tester":    tester,
+		"weight":    r.Weight,
+		"estimate":  r.Estimate,
+		"startTime": r.StartTime.Format("2006-01-02"),
+		"endTime":   r.EndTime.Format("2006-01-02"),
+		"fields":    r.Fields,
+		"errors":    r.Errors,
+	}
+}
+
+func findMilestoneByName(proj *project.Project, name string) *project.Milestone {
+	for _, one := range proj.Milestones {
+		if one.Name == name {
+			return one
+		}
+	}
+
+	if mid, err := strconv.ParseInt(name, 10, 64); err == nil {
+		return proj.FindMilestone(mid)
+	}
+
+	return nil
+}
+
+// resolveUser finds user by account, name or ID. Empty value means operator.
+func resolveUser(users []*user.User, value string, operator int64, role string, row *ImportRow) int64 {
+	if value == "" {
+		return operator
+	}
+
+	var found *user.User
+	for _, one := range users {
+		if one.Account == value || one.Name == value {
+			found = one
+			break
+		}
+	}
+
+	if found == nil {
+		if uid, err := strconv.ParseInt(value, 10, 64); err == nil {
+			for _, one := range users {
+				if one.ID == uid {
+					found = one
+					break
+				}
+			}
+		}
+	}
+
+	if found == nil {
+		row.Errors = append(row.Errors, role+"【"+value+"】不存在")
+		return operator
+	}
+
+	if found.IsLocked {
+		row.Errors = append(row.Errors, role+"【"+value+"】已被禁用")
+	}
+
+	return found.ID
+}
+
+// fieldCell splits CSV cell into values of custom field. Multiple options are
+// separated by commas, and users are given by account, name or ID.
+func fieldCell(users []*user.User, f *project.CustomField, cell string) []string {
+	if cell == "" {
+		return nil
+	}
+
+	switch f.Kind {
+	case project.FieldMultiSelect:
+		return strings.FieldsFunc(cell, func(r rune) bool { return r == ',' || r == '，' })
+	case project.FieldUser:
+		for _, one := range users {
+			if one.Account == cell || one.Name == cell {
+				return []string{strconv.FormatInt(one.ID, 10)}
+			}
+		}
+	}
+
+	return []string{cell}
+}
+
+func parseDate(value string) (time.Time, bool) {
+	for _, layout := range []string{"2006-01-02", "2006/01/02", "2006-1-2", "2006/1/2", "2006-01-02 15:04:05"} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return time.Date(parsed.Year(), parsed.Month(), parsed.Day(), 0, 0, 0, 0, time.UTC), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func today() time.Time {
+	day, _ := time.Parse("2006-01-02", time.Now().Format("2006-01-02"))
+	return day
+}
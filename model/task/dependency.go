@@ -0,0 +1,136 @@
+package task
+
+import (
+	"errors"
+
+	"team/common/orm"
+)
+
+type (
+	// Dependency schema. Task `TID` can NOT be started before task `Depend` is done.
+	Dependency struct {
+		ID     int64 `json:"id"`
+		TID    int64 `json:"tid"`
+		Depend int64 `json:"depend"`
+	}
+)
+
+// GetDepends returns brief information of tasks this task depends on.
+func (t *Task) GetDepends() []map[string]interface{} {
+	list := []map[string]interface{}{}
+
+	for _, tid := range t.dependIDs() {
+		if one := Find(tid); one != nil {
+			list = append(list, map[string]interface{}{
+				"id":    one.ID,
+				"name":  one.Name,
+				"state": one.State,
+			})
+		}
+	}
+
+	return list
+}
+
+// AddDepend makes this task depend on another task in the same project.
+func (t *Task) AddDepend(depend *Task) error {
+	if depend.ID == t.ID {
+		return errors.New("任务不能依赖自身")
+	}
+
+	if depend.PID != t.PID {
+		return errors.New("只能依赖同一项目中的任务")
+	}
+
+	for _, one := range t.dependIDs() {
+		if one == depend.ID {
+			return nil
+		}
+	}
+
+	graph, err := loadDependencies(t.PID)
+	if err != nil {
+		return err
+	}
+
+	if reachable(graph, depend.ID, t.ID) {
+		return errors.New("添加该依赖会造成循环依赖")
+	}
+
+	_, err = orm.Insert(&Dependency{TID: t.ID, Depend: depend.ID})
+	return err
+}
+
+// DelDepend removes dependency.
+func (t *Task) DelDepend(depend int64) error {
+	_, err := orm.Exec("DELETE FROM `dependency` WHERE `tid`=? AND `depend`=?", t.ID, depend)
+	return err
+}
+
+func (t *Task) dependIDs() []int64 {
+	list := []int64{}
+
+	rows, err := orm.Query("SELECT `depend` FROM `dependency` WHERE `tid`=? ORDER BY `id`", t.ID)
+	if err != nil {
+		return list
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		tid := int64(0)
+		if err = rows.Scan(&tid); err == nil {
+			list = append(list, tid)
+		}
+	}
+
+	return list
+}
+
+// loadDependencies returns map from task ID to IDs of tasks it depends on.
+func loadDependencies(pid int64) (map[int64][]int64, error) {
+	rows, err := orm.Query(
+		"SELECT `dependency`.* FROM `dependency` LEFT JOIN `task` ON `dependency`.`tid`=`task`.`id` WHERE `task`.`pid`=?",
+		pid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	graph := map[int64][]int64{}
+	for rows.Next() {
+		one := &Dependency{}
+		if err = orm.Scan(rows, one); err != nil {
+			return nil, err
+		}
+
+		graph[one.TID] = append(graph[one.TID], one.Depend)
+	}
+
+	return graph, nil
+}
+
+// reachable returns true if `to` can be reached from `from` following dependencies.
+func reachable(graph map[int64][]int64, from, to int64) bool {
+	visited := map[int64]bool{}
+	stack := []int64{from}
+
+	for len(stack) > 0 {
+		cur := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if cur == to {
+			return true
+		}
+
+		if visited[cur] {
+			continue
+		}
+
+		visited[cur] = true
+		stack = append(stack, graph[cur]...)
+	}
+
+	return false
+}
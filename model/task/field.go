@@ -0,0 +1,96 @@
+package task
+
+import (
+	"team/common/orm"
+	"team/model/project"
+)
+
+type (
+	// FieldValue schema. Value of project custom field for a task.
+	FieldValue struct {
+		ID    int64  `json:"id"`
+		TID   int64  `json:"tid"`
+		FID   int64  `json:"fid"`
+		Value string `json:"value"`
+	}
+)
+
+// GetFieldValues returns stored values of custom fields for this task.
+func (t *Task) GetFieldValues() map[int64]string {
+	values := map[int64]string{}
+
+	rows, err := orm.Query("SELECT * FROM `fieldvalue` WHERE `tid`=?", t.ID)
+	if err != nil {
+		return values
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		one := &FieldValue{}
+		if err = orm.Scan(rows, one); err != nil {
+			return values
+		}
+
+		values[one.FID] = one.Value
+	}
+
+	return values
+}
+
+// SetField changes value of custom field. Value must be normalized by
+// `project.CustomField.Normalize` first. Returns the old value.
+func (t *Task) SetField(fid int64, value string) (string, error) {
+	old := t.GetFieldValues()[fid]
+	if old == value {
+		return old, nil
+	}
+
+	if _, err := orm.Exec("DELETE FROM `fieldvalue` WHERE `tid`=? AND `fid`=?", t.ID, fid); err != nil {
+		return old, err
+	}
+
+	if len(value) > 0 {
+		if _, err := orm.Insert(&FieldValue{TID: t.ID, FID: fid, Value: value}); err != nil {
+			return old, err
+		}
+	}
+
+	return old, nil
+}
+
+// GetFields returns readable custom fields of this task.
+func (t *Task) GetFields() []map[string]interface{} {
+	proj := project.Find(t.PID)
+	if proj == nil || len(proj.Fields) == 0 {
+		return []map[string]interface{}{}
+	}
+
+	return fieldsOf(proj, t.GetFieldValues())
+}
+
+// fieldsOf returns readable values of all custom fields in given project.
+func fieldsOf(proj *project.Project, values map[int64]string) []map[string]interface{} {
+	list := []map[string]interface{}{}
+	if proj == nil {
+		return list
+	}
+
+	for _, f := range proj.Fields {
+		value, ok := values[f.ID]
+
+		var readable interface{}
+		if ok {
+			readable = f.Readable(value)
+		}
+
+		list = append(list, map[string]interface{}{
+			"id":    f.ID,
+			"name":  f.Name,
+			"kind":  f.Kind,
+			"value": readable,
+		})
+	}
+
+	return list
+}
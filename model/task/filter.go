@@ -0,0 +1,59 @@
+package task
+
+import (
+	"encoding/json"
+	"strings"
+
+	"team/common/orm"
+	"team/model/project"
+)
+
+type (
+	// Filter holds extra conditions for task listings.
+	Filter struct {
+		// Task must carry ALL of these labels.
+		Labels []int64
+		// Task must match ALL of these custom field values.
+		Fields []FieldCond
+	}
+
+	// FieldCond matches value of custom field. For multi-select fields, it
+	// matches if the value is one of the selected options.
+	FieldCond struct {
+		FID   int64
+		Value string
+	}
+)
+
+// where returns extra SQL conditions (starts with ` AND`) and arguments.
+func (f *Filter) where() (string, []interface{}) {
+	if f == nil {
+		return "", nil
+	}
+
+	var builder strings.Builder
+	args := []interface{}{}
+
+	for _, lid := range f.Labels {
+		builder.WriteString(" AND `id` IN (SELECT `tid` FROM `tasklabel` WHERE `lid`=?)")
+		args = append(args, lid)
+	}
+
+	for _, cond := range f.Fields {
+		field := &project.CustomField{ID: cond.FID}
+		if err := orm.Read(field); err != nil || field.Kind != project.FieldMultiSelect {
+			builder.WriteString(" AND `id` IN (SELECT `tid` FROM `fieldvalue` WHERE `fid`=? AND `value`=?)")
+			args = append(args, cond.FID, cond.Value)
+			continue
+		}
+
+		// Values of multi-select fields are stored as JSON arrays.
+		quoted, _ := json.Marshal(cond.Value)
+		like := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(string(quoted))
+
+		builder.WriteString(" AND `id` IN (SELECT `tid` FROM `fieldvalue` WHERE `fid`=? AND `value` LIKE ?)")
+		args = append(args, cond.FID, "%"+like+"%")
+	}
+
+	return builder.String(), args
+}
@@ -0,0 +1,209 @@
+package task
+
+import (
+	"team/common/orm"
+	"team/model/project"
+	"team/model/user"
+)
+
+// Gantt returns milestones and tasks of given project for Gantt rendering.
+// Critical path is computed with dependencies using task duration in days.
+func Gantt(proj *project.Project, withArchived bool) (map[string]interface{}, error) {
+	query := "SELECT * FROM `task` WHERE `pid`=? AND `state`<4 ORDER BY `starttime`"
+	if withArchived {
+		query = "SELECT * FROM `task` WHERE `pid`=? ORDER BY `starttime`"
+	}
+
+	rows, err := orm.Query(query, proj.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	tasks := []*Task{}
+	included := map[int64]*Task{}
+	for rows.Next() {
+		one := &Task{}
+		if err = orm.Scan(rows, one); err != nil {
+			return nil, err
+		}
+
+		tasks = append(tasks, one)
+		included[one.ID] = one
+	}
+
+	graph, err := loadDependencies(proj.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	depends := map[int64][]int64{}
+	for tid, list := range graph {
+		if _, ok := included[tid]; !ok {
+			continue
+		}
+
+		for _, depend := range list {
+			if _, ok := included[depend]; ok {
+				depends[tid] = append(depends[tid], depend)
+			}
+		}
+	}
+
+	schedule := criticalPath(tasks, depends)
+
+	list := []map[string]interface{}{}
+	for _, t := range tasks {
+		developer, _ := user.FindInfo(t.Developer)
+		tester, _ := user.FindInfo(t.Tester)
+
+		exceed := false
+		if milestone := proj.FindMilestone(t.MID); milestone != nil {
+			exceed = t.EndTime.After(milestone.EndTime)
+		}
+
+		ids := depends[t.ID]
+		if ids == nil {
+			ids = []int64{}
+		}
+
+		list = append(list, map[string]interface{}{
+			"id":        t.ID,
+			"name":      t.Name,
+			"mid":       t.MID,
+			"state":     t.State,
+			"weight":    t.Weight,
+			"startTime": t.StartTime.Format("2006-01-02"),
+			"endTime":   t.EndTime.Format("2006-01-02"),
+			"developer": map[string]interface{}{
+				"id":   t.Developer,
+				"name": developer,
+			},
+			"tester": map[string]interface{}{
+				"id":   t.Tester,
+				"name": tester,
+			},
+			"depends":         ids,
+			"slack":           schedule.slack[t.ID],
+			"critical":        schedule.critical[t.ID],
+			"exceedMilestone": exceed,
+		})
+	}
+
+	return map[string]interface{}{
+		"milestones":   proj.GetMilestones(),
+		"tasks":        list,
+		"criticalPath": schedule.path,
+	}, nil
+}
+
+type schedule struct {
+	slack    map[int64]int
+	critical map[int64]bool
+	path     []int64
+}
+
+// criticalPath runs CPM (critical path method) on tasks. Tasks in dependency
+// cycle are ignored.
+func criticalPath(tasks []*Task, depends map[int64][]int64) *schedule {
+	ret := &schedule{slack: map[int64]int{}, critical: map[int64]bool{}, path: []int64{}}
+
+	duration := map[int64]int{}
+	successors := map[int64][]int64{}
+	degree := map[int64]int{}
+
+	for _, t := range tasks {
+		days := int(t.EndTime.Sub(t.StartTime).Hours()/24) + 1
+		if days < 1 {
+			days = 1
+		}
+
+		duration[t.ID] = days
+		degree[t.ID] = len(depends[t.ID])
+
+		for _, depend := range depends[t.ID] {
+			successors[depend] = append(successors[depend], t.ID)
+		}
+	}
+
+	order := []int64{}
+	queue := []int64{}
+	for _, t := range tasks {
+		if degree[t.ID] == 0 {
+			queue = append(queue, t.ID)
+		}
+	}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		order = append(order, cur)
+
+		for _, next := range successors[cur] {
+			degree[next]--
+			if degree[next] == 0 {
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	earliestStart := map[int64]int{}
+	earliestFinish := map[int64]int{}
+	length := 0
+
+	for _, tid := range order {
+		start := 0
+		for _, depend := range depends[tid] {
+			if earliestFinish[depend] > start {
+				start = earliestFinish[depend]
+			}
+		}
+
+		earliestStart[tid] = start
+		earliestFinish[tid] = start + duration[tid]
+		if earliestFinish[tid] > length {
+			length = earliestFinish[tid]
+		}
+	}
+
+	latestStart := map[int64]int{}
+	for i := len(order) - 1; i >= 0; i-- {
+		tid := order[i]
+
+		finish := length
+		for _, next := range successors[tid] {
+			if latestStart[next] < finish {
+				finish = latestStart[next]
+			}
+		}
+
+		latestStart[tid] = finish - duration[tid]
+		ret.slack[tid] = latestStart[tid] - earliestStart[tid]
+		ret.critical[tid] = ret.slack[tid] == 0
+	}
+
+	cur := int64(-1)
+	for _, tid := range order {
+		if ret.critical[tid] && earliestFinish[tid] == length {
+			cur = tid
+			break
+		}
+	}
+
+	for cur != -1 {
+		ret.path = append([]int64{cur}, ret.path...)
+
+		prev := int64(-1)
+		for _, depend := range depends[cur] {
+			if ret.critical[depend] && earliestFinish[depend] == earliestStart[cur] {
+				prev = depend
+				break
+			}
+		}
+
+		cur = prev
+	}
+
+	return ret
+}
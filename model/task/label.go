@@ -0,0 +1,94 @@
+package task
+
+import (
+	"errors"
+
+	"team/common/orm"
+	"team/model/project"
+)
+
+type (
+	// TaskLabel schema. Relationship between task and project label.
+	TaskLabel struct {
+		ID  int64 `json:"id"`
+		TID int64 `json:"tid"`
+		LID int64 `json:"lid"`
+	}
+)
+
+// GetLabels returns all labels of this task.
+func (t *Task) GetLabels() []*project.Label {
+	list := []*project.Label{}
+
+	rows, err := orm.Query("SELECT * FROM `tasklabel` WHERE `tid`=? ORDER BY `id`", t.ID)
+	if err != nil {
+		return list
+	}
+
+	defer rows.Close()
+
+	lids := []int64{}
+	for rows.Next() {
+		one := &TaskLabel{}
+		if err = orm.Scan(rows, one); err != nil {
+			return list
+		}
+
+		lids = append(lids, one.LID)
+	}
+
+	return labelsOf(project.Find(t.PID), lids)
+}
+
+// labelsOf converts label IDs into labels of given project.
+func labelsOf(proj *project.Project, lids []int64) []*project.Label {
+	list := []*project.Label{}
+	if proj == nil {
+		return list
+	}
+
+	for _, lid := range lids {
+		if label := proj.FindLabel(lid); label != nil {
+			list = append(list, label)
+		}
+	}
+
+	return list
+}
+
+// HasLabel returns true if this task carries given label.
+func (t *Task) HasLabel(lid int64) bool {
+	for _, one := range t.GetLabels() {
+		if one.ID == lid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AddLabel attaches label to this task.
+func (t *Task) AddLabel(lid int64) (*project.Label, error) {
+	proj := project.Find(t.PID)
+	if proj == nil {
+		return nil, errors.New("任务所属项目不存在或已删除")
+	}
+
+	label := proj.FindLabel(lid)
+	if label == nil {
+		return nil, errors.New("标签不存在或已删除")
+	}
+
+	if t.HasLabel(lid) {
+		return label, nil
+	}
+
+	_, err := orm.Insert(&TaskLabel{TID: t.ID, LID: lid})
+	return label, err
+}
+
+// DelLabel removes label from this task.
+func (t *Task) DelLabel(lid int64) error {
+	_, err := orm.Exec("DELETE FROM `tasklabel` WHERE `tid`=? AND `lid`=?", t.ID, lid)
+	return err
+}
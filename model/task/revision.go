@@ -0,0 +1,134 @@
+package task
+
+import (
+	"errors"
+	"time"
+
+	"team/common/diff"
+	"team/common/orm"
+	"team/model/user"
+)
+
+// Fields of task that have revision history.
+const (
+	RevisionContent = 0
+	RevisionName    = 1
+)
+
+type (
+	// Revision schema
+	Revision struct {
+		ID      int64     `json:"id"`
+		TID     int64     `json:"tid"`
+		UID     int64     `json:"uid"`
+		Field   int8      `json:"field"`
+		Time    time.Time `json:"time" orm:"default=CURRENT_TIMESTAMP"`
+		Content string    `json:"content"`
+	}
+)
+
+// FindRevision returns revision of this task by ID.
+func (t *Task) FindRevision(rid int64) *Revision {
+	rev := &Revision{ID: rid}
+	if err := orm.Read(rev); err != nil || rev.TID != t.ID {
+		return nil
+	}
+
+	return rev
+}
+
+// GetRevisions returns history of given field. Latest first.
+func (t *Task) GetRevisions(field int8) []map[string]interface{} {
+	list := []map[string]interface{}{}
+
+	rows, err := orm.Query("SELECT * FROM `revision` WHERE `tid`=? AND `field`=? ORDER BY `id` DESC", t.ID, field)
+	if err != nil {
+		return list
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		one := &Revision{}
+		if err = orm.Scan(rows, one); err != nil {
+			return list
+		}
+
+		list = append(list, one.Brief())
+	}
+
+	return list
+}
+
+// DiffRevisions returns line-based diff between two revisions of this task.
+func (t *Task) DiffRevisions(from, to int64) ([]diff.Line, error) {
+	a := t.FindRevision(from)
+	b := t.FindRevision(to)
+	if a == nil || b == nil {
+		return nil, errors.New("指定版本不存在")
+	}
+
+	if a.Field != b.Field {
+		return nil, errors.New("无法比较不同类型的版本")
+	}
+
+	return diff.Lines(a.Content, b.Content), nil
+}
+
+// Brief returns brief information of this revision.
+func (r *Revision) Brief() map[string]interface{} {
+	name, _ := user.FindInfo(r.UID)
+
+	return map[string]interface{}{
+		"id":     r.ID,
+		"field":  r.Field,
+		"time":   r.Time.Format("2006-01-02 15:04:05"),
+		"author": name,
+		"size":   len(r.Content),
+	}
+}
+
+// addRevision records new value of given field. For tasks created before
+// history is supported, current value is saved as the first revision.
+func (t *Task) addRevision(operator int64, field int8, old, value string) (*Revision, error) {
+	rows, err := orm.Query("SELECT COUNT(*) FROM `revision` WHERE `tid`=? AND `field`=?", t.ID, field)
+	if err != nil {
+		return nil, err
+	}
+
+	count := 0
+	rows.Next()
+	rows.Scan(&count)
+	rows.Close()
+
+	now := time.Now()
+	if count == 0 && old != value {
+		_, err = orm.Insert(&Revision{
+			TID:     t.ID,
+			UID:     t.Creator,
+			Field:   field,
+			Time:    now,
+			Content: old,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	add := &Revision{
+		TID:     t.ID,
+		UID:     operator,
+		Field:   field,
+		Time:    now,
+		Content: value,
+	}
+
+	rs, err := orm.Insert(add)
+	if err != nil {
+		return nil, err
+	}
+
+	add.ID, _ = rs.LastInsertId()
+	return add, nil
+}
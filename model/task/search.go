@@ -0,0 +1,156 @@
+package task
+
+import (
+	"team/common/orm"
+	"team/model/link"
+	"team/model/search"
+	"team/model/user"
+)
+
+func init() {
+	search.Register(search.KindTask, &search.Source{
+		Each: func(fn func(target int64, title, content string)) error {
+			rows, err := orm.Query("SELECT `id`,`name`,`content` FROM `task`")
+			if err != nil {
+				return err
+			}
+
+			defer rows.Close()
+
+			for rows.Next() {
+				var id int64
+				var name, content string
+				if err = rows.Scan(&id, &name, &content); err != nil {
+					return err
+				}
+
+				fn(id, name, content)
+			}
+
+			return nil
+		},
+		Resolve: func(target, uid int64) *search.Entry {
+			t := Find(target)
+			if t == nil || !t.IsVisibleTo(uid) {
+				return nil
+			}
+
+			return &search.Entry{
+				Title:   t.Name,
+				Content: t.Content,
+				Extra: map[string]interface{}{
+					"pid":   t.PID,
+					"state": t.State,
+				},
+			}
+		},
+	})
+
+	search.Register(search.KindComment, &search.Source{
+		Each: func(fn func(target int64, title, content string)) error {
+			rows, err := orm.Query("SELECT `id`,`comment` FROM `comment` WHERE `isdeleted`=0")
+			if err != nil {
+				return err
+			}
+
+			defer rows.Close()
+
+			for rows.Next() {
+				var id int64
+				var content string
+				if err = rows.Scan(&id, &content); err != nil {
+					return err
+				}
+
+				fn(id, "", content)
+			}
+
+			return nil
+		},
+		Resolve: func(target, uid int64) *search.Entry {
+			c := FindComment(target)
+			if c == nil || c.IsDeleted {
+				return nil
+			}
+
+			t := Find(c.TID)
+			if t == nil || !t.IsVisibleTo(uid) {
+				return nil
+			}
+
+			author, _ := user.FindInfo(c.UID)
+			return &search.Entry{
+				Title:   t.Name,
+				Content: c.Comment,
+				Extra: map[string]interface{}{
+					"tid":    t.ID,
+					"pid":    t.PID,
+					"author": author,
+					"time":   c.Time.Format("2006-01-02 15:04"),
+				},
+			}
+		},
+	})
+
+	link.Register(search.KindTask, func(pattern string, fn func(source, pid int64, content string)) error {
+		return eachMention("SELECT `id`,`pid`,`content` FROM `task` WHERE `content` LIKE ?", pattern, fn)
+	})
+
+	link.Register(search.KindComment, func(pattern string, fn func(source, pid int64, content string)) error {
+		return eachMention(
+			"SELECT `comment`.`id`,`task`.`pid`,`comment`.`comment` FROM `comment` JOIN `task` ON `comment`.`tid`=`task`.`id` "+
+				"WHERE `comment`.`isdeleted`=0 AND `comment`.`comment` LIKE ?",
+			pattern, fn)
+	})
+}
+
+// Reindex updates search index and references of this task.
+func (t *Task) Reindex() {
+	search.Index(search.KindTask, t.ID, t.Name, t.Content)
+	link.Update(search.KindTask, t.ID, t.PID, t.Content)
+}
+
+// GetBacklinks returns tasks, comments and documents referencing this task
+// and visible to given user.
+func (t *Task) GetBacklinks(uid int64) []map[string]interface{} {
+	return link.Backlinks(search.KindTask, t.ID, uid)
+}
+
+// Reindex updates search index and references of this comment.
+func (c *Comment) Reindex() {
+	if c.IsDeleted {
+		search.Remove(search.KindComment, c.ID)
+		link.Remove(search.KindComment, c.ID)
+		return
+	}
+
+	search.Index(search.KindComment, c.ID, "", c.Comment)
+
+	var pid int64
+	if t := Find(c.TID); t != nil {
+		pid = t.PID
+	}
+
+	link.Update(search.KindComment, c.ID, pid, c.Comment)
+}
+
+func eachMention(query, pattern string, fn func(source, pid int64, content string)) error {
+	rows, err := orm.Query(query, pattern)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, pid int64
+		var content string
+		if err = rows.Scan(&id, &pid, &content); err != nil {
+			return err
+		}
+
+		fn(id, pid, content)
+	}
+
+	return nil
+}
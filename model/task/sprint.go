@@ -0,0 +1,257 @@
+package task
+
+import (
+	"errors"
+
+	"team/common/orm"
+	"team/model/project"
+)
+
+// Results of task in sprint.
+const (
+	SprintTaskOpen      = 0
+	SprintTaskCompleted = 1
+	SprintTaskCarried   = 2
+)
+
+type (
+	// SprintTask schema. A task can be carried over several sprints, and each
+	// of them has its own record.
+	SprintTask struct {
+		ID      int64 `json:"id"`
+		SID     int64 `json:"sid"`
+		TID     int64 `json:"tid"`
+		Planned bool  `json:"planned"`
+		Result  int8  `json:"result"`
+	}
+)
+
+// GetSprint returns the sprint this task currently belongs to.
+func (t *Task) GetSprint() *project.Sprint {
+	proj := project.Find(t.PID)
+	if proj == nil {
+		return nil
+	}
+
+	rows, err := orm.Query("SELECT `sid` FROM `sprinttask` WHERE `tid`=? AND `result`=?", t.ID, SprintTaskOpen)
+	if err != nil {
+		return nil
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil
+	}
+
+	sid := int64(0)
+	rows.Scan(&sid)
+	return proj.FindSprint(sid)
+}
+
+// SetSprint moves this task into given sprint. Zero sid removes this task
+// from current sprint.
+func (t *Task) SetSprint(sid int64) error {
+	var sprint *project.Sprint
+
+	if sid > 0 {
+		proj := project.Find(t.PID)
+		if proj == nil {
+			return errors.New("任务所属项目不存在或已删除")
+		}
+
+		sprint = proj.FindSprint(sid)
+		if sprint == nil {
+			return errors.New("迭代不存在或已删除")
+		}
+
+		if sprint.State == project.SprintClosed {
+			return errors.New("迭代已结束")
+		}
+	}
+
+	_, err := orm.Exec("DELETE FROM `sprinttask` WHERE `tid`=? AND `result`=?", t.ID, SprintTaskOpen)
+	if err != nil || sprint == nil {
+		return err
+	}
+
+	_, err = orm.Insert(&SprintTask{
+		SID:     sprint.ID,
+		TID:     t.ID,
+		Planned: sprint.State == project.SprintPlanning,
+		Result:  SprintTaskOpen,
+	})
+
+	return err
+}
+
+// StartSprint starts sprint. Tasks already in it are treated as planned scope.
+func StartSprint(proj *project.Project, sprint *project.Sprint) error {
+	if sprint.State != project.SprintPlanning {
+		return errors.New("只能开始尚未开始的迭代")
+	}
+
+	if proj.ActiveSprint() != nil {
+		return errors.New("项目中已有进行中的迭代")
+	}
+
+	_, err := orm.Exec("UPDATE `sprinttask` SET `planned`=1 WHERE `sid`=?", sprint.ID)
+	if err != nil {
+		return err
+	}
+
+	return sprint.SetState(project.SprintActive)
+}
+
+// CloseSprint closes the running sprint. Finished tasks are marked completed,
+// others are carried over into next sprint (if nextSID > 0) or backlog.
+func CloseSprint(operator int64, proj *project.Project, sprint *project.Sprint, nextSID int64) error {
+	if sprint.State != project.SprintActive {
+		return errors.New("只能结束进行中的迭代")
+	}
+
+	var next *project.Sprint
+	if nextSID > 0 {
+		next = proj.FindSprint(nextSID)
+		if next == nil || next.ID == sprint.ID || next.State == project.SprintClosed {
+			return errors.New("无效的后续迭代")
+		}
+	}
+
+	records, err := getSprintTasks(sprint.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, one := range records {
+		if one.Result != SprintTaskOpen {
+			continue
+		}
+
+		t := Find(one.TID)
+		if t == nil {
+			continue
+		}
+
+		if t.State >= 3 {
+			orm.Exec("UPDATE `sprinttask` SET `result`=? WHERE `id`=?", SprintTaskCompleted, one.ID)
+			continue
+		}
+
+		orm.Exec("UPDATE `sprinttask` SET `result`=? WHERE `id`=?", SprintTaskCarried, one.ID)
+
+		if next != nil {
+			orm.Insert(&SprintTask{
+				SID:     next.ID,
+				TID:     t.ID,
+				Planned: next.State == project.SprintPlanning,
+				Result:  SprintTaskOpen,
+			})
+		}
+
+		t.LogEvent(operator, EventModSprint, sprint.Name)
+	}
+
+	return sprint.SetState(project.SprintClosed)
+}
+
+// SprintReport returns completed and carried-over work of given sprint. For
+// running sprint, finished tasks are treated as completed.
+func SprintReport(sprint *project.Sprint) (map[string]interface{}, error) {
+	records, err := getSprintTasks(sprint.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	completed := []map[string]interface{}{}
+	carried := []map[string]interface{}{}
+	open := []map[string]interface{}{}
+	planned, added := 0, 0
+	completedEstimate, carriedEstimate, totalEstimate := int32(0), int32(0), int32(0)
+
+	found := []*SprintTask{}
+	tasks := []*Task{}
+	for _, one := range records {
+		if t := Find(one.TID); t != nil {
+			found = append(found, one)
+			tasks = append(tasks, t)
+		}
+	}
+
+	for i, brief := range Briefs(tasks) {
+		one, t := found[i], tasks[i]
+		if one.Planned {
+			planned++
+		} else {
+			added++
+		}
+
+		totalEstimate += t.Estimate
+		brief["planned"] = one.Planned
+
+		switch {
+		case one.Result == SprintTaskCompleted || (one.Result == SprintTaskOpen && t.State >= 3):
+			completed = append(completed, brief)
+			completedEstimate += t.Estimate
+		case one.Result == SprintTaskCarried:
+			carried = append(carried, brief)
+			carriedEstimate += t.Estimate
+		default:
+			open = append(open, brief)
+		}
+	}
+
+	return map[string]interface{}{
+		"sprint":            sprint.Info(),
+		"planned":           planned,
+		"added":             added,
+		"totalEstimate":     totalEstimate,
+		"completedEstimate": completedEstimate,
+		"carriedEstimate":   carriedEstimate,
+		"completed":         completed,
+		"carried":           carried,
+		"open":              open,
+	}, nil
+}
+
+// GetAllBySID returns tasks currently in given sprint.
+func GetAllBySID(sid int64) ([]map[string]interface{}, error) {
+	records, err := getSprintTasks(sid)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := []*Task{}
+	for _, one := range records {
+		if one.Result != SprintTaskOpen {
+			continue
+		}
+
+		if t := Find(one.TID); t != nil {
+			tasks = append(tasks, t)
+		}
+	}
+
+	return Briefs(tasks), nil
+}
+
+func getSprintTasks(sid int64) ([]*SprintTask, error) {
+	rows, err := orm.Query("SELECT * FROM `sprinttask` WHERE `sid`=? ORDER BY `id`", sid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	list := []*SprintTask{}
+	for rows.Next() {
+		one := &SprintTask{}
+		if err = orm.Scan(rows, one); err != nil {
+			return nil, err
+		}
+
+		list = append(list, one)
+	}
+
+	return list, nil
+}
@@ -5,8 +5,10 @@ import (
 	"time"
 
 	"team/common/orm"
+	"team/model/link"
 	"team/model/notice"
 	"team/model/project"
+	"team/model/search"
 	"team/model/user"
 )
 
@@ -22,11 +24,29 @@ const (
 	EventModWeight    = 7
 	EventModContent   = 8
 	EventComment      = 9
+	EventEditComment  = 10
+	EventDelComment   = 11
+	EventAddLabel     = 12
+	EventDelLabel     = 13
+	EventModField     = 14
+	EventModEstimate  = 15
+	EventModSprint    = 16
+	EventAddDepend    = 17
+	EventDelDepend    = 18
 )
 
 var (
 	// TimeInfinite is the time never reached.
 	TimeInfinite, _ = time.Parse("2006-01-02", "2000-01-01")
+
+	// StateNames holds readable names of task states.
+	StateNames = []string{"待办中", "进行中", "测试中", "已完成", "已验收"}
+
+	// WeightNames holds readable names of task weights.
+	WeightNames = []string{"一般", "次要", "主要", "严重"}
+
+	// ErrConflict means task content has been modified by others.
+	ErrConflict = errors.New("任务内容已被他人修改，请合并最新内容后重试")
 )
 
 type (
@@ -41,10 +61,12 @@ type (
 		Name        string    `json:"name" orm:"type=VARCHAR(128),notnull"`
 		BringTop    bool      `json:"bringTop"`
 		Weight      int8      `json:"weight"`
+		Estimate    int32     `json:"estimate" orm:"notnull,default=0"`
 		State       int8      `json:"state"`
 		StartTime   time.Time `json:"startTime" orm:"default=CURRENT_TIMESTAMP"`
 		EndTime     time.Time `json:"endTime" orm:"notnull,default='2000-01-01'"`
 		ArchiveTime time.Time `json:"archiveTime" orm:"notnull,default='2000-01-01'"`
+		Version     int64     `json:"version" orm:"notnull,default=0,version"`
 		Content     string    `json:"content"`
 	}
 
@@ -56,15 +78,6 @@ type (
 		Path string `json:"url" orm:"type=VARCHAR(128),notnull"`
 	}
 
-	// Comment schema
-	Comment struct {
-		ID      int64     `json:"id"`
-		TID     int64     `json:"tid"`
-		UID     int64     `json:"uid"`
-		Time    time.Time `json:"time" orm:"default=CURRENT_TIMESTAMP"`
-		Comment string    `json:"comment"`
-	}
-
 	// Event schema
 	Event struct {
 		ID    int64     `json:"id"`
@@ -77,11 +90,12 @@ type (
 )
 
 // GetAllByUID returns tasks by user ID.
-func GetAllByUID(uid int64) ([]map[string]interface{}, error) {
+func GetAllByUID(uid int64, filter *Filter) ([]map[string]interface{}, error) {
+	cond, args := filter.where()
 	rows, err := orm.Query(
-		"SELECT `id`,`pid`,`mid`,`creator`,`developer`,`tester`,`name`,`bringtop`,`weight`,`state`,`starttime`,`endtime` "+
-			"FROM `task` WHERE `state`<4 AND (`creator`=? OR `developer`=? OR `tester`=?)",
-		uid, uid, uid)
+		"SELECT `id`,`pid`,`mid`,`creator`,`developer`,`tester`,`name`,`bringtop`,`weight`,`estimate`,`state`,`starttime`,`endtime` "+
+			"FROM `task` WHERE `state`<4 AND (`creator`=? OR `developer`=? OR `tester`=?)"+cond,
+		append([]interface{}{uid, uid, uid}, args...)...)
 
 	if err != nil {
 		return nil, err
@@ -89,25 +103,26 @@ func GetAllByUID(uid int64) ([]map[string]interface{}, error) {
 
 	defer rows.Close()
 
-	list := []map[string]interface{}{}
+	tasks := []*Task{}
 	for rows.Next() {
 		one := &Task{}
 		if err = orm.Scan(rows, one); err != nil {
 			return nil, err
 		}
 
-		list = append(list, one.Brief())
+		tasks = append(tasks, one)
 	}
 
-	return list, nil
+	return Briefs(tasks), nil
 }
 
 // GetAllByPID returns tasks by project ID.
-func GetAllByPID(pid int64) ([]map[string]interface{}, error) {
+func GetAllByPID(pid int64, filter *Filter) ([]map[string]interface{}, error) {
+	cond, args := filter.where()
 	rows, err := orm.Query(
-		"SELECT `id`,`pid`,`mid`,`creator`,`developer`,`tester`,`name`,`bringtop`,`weight`,`state`,`starttime`,`endtime` "+
-			"FROM `task` WHERE `state`<4 AND `pid`=?",
-		pid)
+		"SELECT `id`,`pid`,`mid`,`creator`,`developer`,`tester`,`name`,`bringtop`,`weight`,`estimate`,`state`,`starttime`,`endtime` "+
+			"FROM `task` WHERE `state`<4 AND `pid`=?"+cond,
+		append([]interface{}{pid}, args...)...)
 
 	if err != nil {
 		return nil, err
@@ -115,68 +130,77 @@ func GetAllByPID(pid int64) ([]map[string]interface{}, error) {
 
 	defer rows.Close()
 
-	list := []map[string]interface{}{}
+	tasks := []*Task{}
 	for rows.Next() {
 		one := &Task{}
 		if err = orm.Scan(rows, one); err != nil {
 			return nil, err
 		}
 
-		list = append(list, one.Brief())
+		tasks = append(tasks, one)
 	}
 
-	return list, nil
+	return Briefs(tasks), nil
 }
 
 // GetWeekReport returns tasks belongs this week.
-func GetWeekReport(pid, weekStart int64) map[string]interface{} {
+func GetWeekReport(pid, weekStart int64, filter *Filter) map[string]interface{} {
+	undoneTasks, doneTasks := GetWeekTasks(pid, weekStart, filter)
+
+	return map[string]interface{}{
+		"unarchived": Briefs(undoneTasks),
+		"archived":   Briefs(doneTasks),
+	}
+}
+
+// GetWeekTasks returns unarchived and archived tasks of given week.
+func GetWeekTasks(pid, weekStart int64, filter *Filter) ([]*Task, []*Task) {
 	end := weekStart + 3600*24*7
+	cond, args := filter.where()
 
-	undone := []map[string]interface{}{}
-	done := []map[string]interface{}{}
+	undone := []*Task{}
+	done := []*Task{}
 
 	rowsUndone, err := orm.Query(
-		"SELECT `id`,`pid`,`mid`,`creator`,`developer`,`tester`,`name`,`bringtop`,`weight`,`state`,`starttime`,`endtime` "+
-			"FROM `task` WHERE `pid`=? AND UNIX_TIMESTAMP(`endtime`)<=? AND (`state`<4 OR UNIX_TIMESTAMP(`archivetime`)>?)",
-		pid, end, end)
+		"SELECT `id`,`pid`,`mid`,`creator`,`developer`,`tester`,`name`,`bringtop`,`weight`,`estimate`,`state`,`starttime`,`endtime` "+
+			"FROM `task` WHERE `pid`=? AND UNIX_TIMESTAMP(`endtime`)<=? AND (`state`<4 OR UNIX_TIMESTAMP(`archivetime`)>?)"+cond,
+		append([]interface{}{pid, end, end}, args...)...)
 	if err == nil {
 		defer rowsUndone.Close()
 
 		for rowsUndone.Next() {
 			one := &Task{}
 			if err = orm.Scan(rowsUndone, one); err == nil {
-				undone = append(undone, one.Brief())
+				undone = append(undone, one)
 			}
 		}
 	}
 
 	rowsDone, err := orm.Query(
-		"SELECT `id`,`pid`,`mid`,`creator`,`developer`,`tester`,`name`,`bringtop`,`weight`,`state`,`starttime`,`endtime` "+
-			"FROM `task` WHERE `pid`=? AND `state`=4 AND UNIX_TIMESTAMP(`archivetime`)>=? AND UNIX_TIMESTAMP(`archivetime`)<=?",
-		pid, weekStart, end)
+		"SELECT `id`,`pid`,`mid`,`creator`,`developer`,`tester`,`name`,`bringtop`,`weight`,`estimate`,`state`,`starttime`,`endtime` "+
+			"FROM `task` WHERE `pid`=? AND `state`=4 AND UNIX_TIMESTAMP(`archivetime`)>=? AND UNIX_TIMESTAMP(`archivetime`)<=?"+cond,
+		append([]interface{}{pid, weekStart, end}, args...)...)
 	if err == nil {
 		defer rowsDone.Close()
 
 		for rowsDone.Next() {
 			one := &Task{}
 			if err = orm.Scan(rowsDone, one); err == nil {
-				done = append(done, one.Brief())
+				done = append(done, one)
 			}
 		}
 	}
 
-	return map[string]interface{}{
-		"unarchived": undone,
-		"archived":   done,
-	}
+	return undone, done
 }
 
 // GetAllByMID returns tasks by project ID.
-func GetAllByMID(mid int64) ([]map[string]interface{}, error) {
+func GetAllByMID(mid int64, filter *Filter) ([]map[string]interface{}, error) {
+	cond, args := filter.where()
 	rows, err := orm.Query(
-		"SELECT `id`,`pid`,`mid`,`creator`,`developer`,`tester`,`name`,`bringtop`,`weight`,`state`,`starttime`,`endtime` "+
-			"FROM `task` WHERE `mid`=?",
-		mid)
+		"SELECT `id`,`pid`,`mid`,`creator`,`developer`,`tester`,`name`,`bringtop`,`weight`,`estimate`,`state`,`starttime`,`endtime` "+
+			"FROM `task` WHERE `mid`=?"+cond,
+		append([]interface{}{mid}, args...)...)
 
 	if err != nil {
 		return nil, err
@@ -184,17 +208,17 @@ func GetAllByMID(mid int64) ([]map[string]interface{}, error) {
 
 	defer rows.Close()
 
-	list := []map[string]interface{}{}
+	tasks := []*Task{}
 	for rows.Next() {
 		one := &Task{}
 		if err = orm.Scan(rows, one); err != nil {
 			return nil, err
 		}
 
-		list = append(list, one.Brief())
+		tasks = append(tasks, one)
 	}
 
-	return list, nil
+	return Briefs(tasks), nil
 }
 
 // Find task by ID
@@ -207,8 +231,19 @@ func Find(ID int64) *Task {
 	return t
 }
 
+// IsVisibleTo tests if given user can see this task, which is allowed to
+// super users and project members.
+func (t *Task) IsVisibleTo(uid int64) bool {
+	if me := user.Find(uid); me != nil && me.IsSu {
+		return true
+	}
+
+	proj := project.Find(t.PID)
+	return proj != nil && proj.HasMember(uid)
+}
+
 // Add new task
-func Add(name string, pid int64, mid int64, weight int8, bringTop bool, creator, developer, tester int64, startTime, endTime time.Time, content string) *Task {
+func Add(name string, pid int64, mid int64, weight int8, estimate int32, bringTop bool, creator, developer, tester int64, startTime, endTime time.Time, content string) *Task {
 	add := &Task{
 		PID:         pid,
 		MID:         mid,
@@ -218,6 +253,7 @@ func Add(name string, pid int64, mid int64, weight int8, bringTop bool, creator,
 		Name:        name,
 		BringTop:    bringTop,
 		Weight:      int8(weight),
+		Estimate:    estimate,
 		State:       0,
 		StartTime:   startTime,
 		EndTime:     endTime,
@@ -231,6 +267,9 @@ func Add(name string, pid int64, mid int64, weight int8, bringTop bool, creator,
 	}
 
 	add.ID, _ = rs.LastInsertId()
+	add.addRevision(creator, RevisionName, name, name)
+	add.addRevision(creator, RevisionContent, content, content)
+	add.Reindex()
 	return add
 }
 
@@ -267,12 +306,18 @@ func (t *Task) GetAttachments() []*Attachment {
 }
 
 // SetName changes task's name
-func (t *Task) SetName(name string) error {
+func (t *Task) SetName(operator int64, name string) error {
 	if name == t.Name {
 		return nil
 	}
 
-	_, err := orm.Exec("UPDATE `task` SET `name`=? WHERE `id`=?", name, t.ID)
+	if _, err := orm.Exec("UPDATE `task` SET `name`=? WHERE `id`=?", name, t.ID); err != nil {
+		return err
+	}
+
+	_, err := t.addRevision(operator, RevisionName, t.Name, name)
+	t.Name = name
+	t.Reindex()
 	return err
 }
 
@@ -288,6 +333,16 @@ func (t *Task) SetWeight(weight int8) error {
 	return err
 }
 
+// SetEstimate changes task's estimate points.
+func (t *Task) SetEstimate(estimate int32) error {
+	if estimate < 0 {
+		return errors.New("无效的工作量估算")
+	}
+
+	_, err := orm.Exec("UPDATE `task` SET `estimate`=? WHERE `id`=?", estimate, t.ID)
+	return err
+}
+
 // SetState changes task's state.
 func (t *Task) SetState(operator int64, state int8, isAdmin bool) error {
 	if state < 0 || state > 4 {
@@ -321,16 +376,25 @@ func (t *Task) SetState(operator int64, state int8, isAdmin bool) error {
 	}
 
 	_, err := orm.Exec("UPDATE `task` SET `state`=?,`archivetime`=? WHERE `id`=?", state, t.ArchiveTime.Format("2006-01-02"), t.ID)
-	return err
+	if err != nil {
+		return err
+	}
+
+	t.State = state
+	return nil
 }
 
-// SetTime changes task's timeline.
-func (t *Task) SetTime(start, end time.Time) error {
+// CheckTime validates new timeline of this task.
+func (t *Task) CheckTime(start, end time.Time) error {
 	proj := project.Find(t.PID)
 	if proj == nil {
 		return errors.New("任务所属项目不存在或已删除")
 	}
 
+	if end.Before(start) {
+		return errors.New("任务结束时间不可早于开始时间")
+	}
+
 	milestone := proj.FindMilestone(t.MID)
 	if milestone != nil {
 		if start.Before(milestone.StartTime) || end.After(milestone.EndTime) {
@@ -338,58 +402,66 @@ func (t *Task) SetTime(start, end time.Time) error {
 		}
 	}
 
+	return nil
+}
+
+// SetTime changes task's timeline.
+func (t *Task) SetTime(start, end time.Time) error {
+	if err := t.CheckTime(start, end); err != nil {
+		return err
+	}
+
 	_, err := orm.Exec(
 		"UPDATE `task` SET `starttime`=?,`endtime`=? WHERE `id`=?",
 		start.Format("2006-01-02"), end.Format("2006-01-02"), t.ID)
-	return err
-}
+	if err != nil {
+		return err
+	}
 
-// SetContent changes task's content.
-func (t *Task) SetContent(content string) error {
-	_, err := orm.Exec("UPDATE `task` SET `content`=? WHERE `id`=?", content, t.ID)
-	return err
+	t.StartTime = start
+	t.EndTime = end
+	return nil
 }
 
-// AddComment for this task.
-func (t *Task) AddComment(uid int64, content string) error {
-	_, err := orm.Insert(&Comment{
-		TID:     t.ID,
-		UID:     uid,
-		Time:    time.Now(),
-		Comment: content,
-	})
+// SetContent changes task's content and returns the new revision. The version
+// should be the one which content is based on, ErrConflict is returned when
+// content has been modified by others.
+func (t *Task) SetContent(operator, version int64, content string) (*Revision, error) {
+	rs, err := orm.Exec("UPDATE `task` SET `content`=?,`version`=`version`+1 WHERE `id`=? AND `version`=?", content, t.ID, version)
+	if err != nil {
+		return nil, err
+	}
 
-	return err
-}
+	if affected, err := rs.RowsAffected(); err != nil {
+		return nil, err
+	} else if affected == 0 {
+		return nil, ErrConflict
+	}
 
-// GetComments returns all comments of this task
-func (t *Task) GetComments() []map[string]interface{} {
-	list := []map[string]interface{}{}
+	rev, err := t.addRevision(operator, RevisionContent, t.Content, content)
+	t.Content = content
+	t.Version = version + 1
+	t.Reindex()
+	return rev, err
+}
 
-	rows, err := orm.Query("SELECT * FROM `comment` WHERE `tid`=?", t.ID)
-	if err != nil {
-		return list
+// RestoreRevision sets task's name or content back to given revision. A new
+// revision will be created.
+func (t *Task) RestoreRevision(operator, rid int64) (*Revision, error) {
+	rev := t.FindRevision(rid)
+	if rev == nil {
+		return nil, errors.New("指定版本不存在")
 	}
 
-	defer rows.Close()
-
-	for rows.Next() {
-		one := &Comment{}
-		if err = orm.Scan(rows, one); err != nil {
-			return list
+	if rev.Field == RevisionName {
+		if err := t.SetName(operator, rev.Content); err != nil {
+			return nil, err
 		}
 
-		name, avatar := user.FindInfo(one.UID)
-
-		list = append(list, map[string]interface{}{
-			"time":    one.Time.Format("2006-01-02 15:04:05"),
-			"user":    name,
-			"avatar":  avatar,
-			"content": one.Comment,
-		})
+		return rev, nil
 	}
 
-	return list
+	return t.SetContent(operator, t.Version, rev.Content)
 }
 
 // LogEvent records operation log and notify all users related to this task.
@@ -453,51 +525,9 @@ func (t *Task) GetEvents() []map[string]interface{} {
 	return list
 }
 
-// Brief return brief message for this task.
-func (t *Task) Brief() map[string]interface{} {
-	creator := user.Find(t.Creator)
-	developer := user.Find(t.Developer)
-	tester := user.Find(t.Tester)
-	proj := project.Find(t.PID)
-
-	brief := map[string]interface{}{
-		"id":   t.ID,
-		"name": t.Name,
-		"proj": map[string]interface{}{
-			"id":   proj.ID,
-			"name": proj.Name,
-		},
-		"bringTop": t.BringTop,
-		"weight":   t.Weight,
-		"state":    t.State,
-		"creator": map[string]interface{}{
-			"id":   creator.ID,
-			"name": creator.Name,
-		},
-		"developer": map[string]interface{}{
-			"id":   developer.ID,
-			"name": developer.Name,
-		},
-		"tester": map[string]interface{}{
-			"id":   tester.ID,
-			"name": tester.Name,
-		},
-		"startTime": t.StartTime.Format("2006-01-02"),
-		"endTime":   t.EndTime.Format("2006-01-02"),
-	}
-
-	if milestone := proj.FindMilestone(t.MID); milestone != nil {
-		brief["milestone"] = map[string]interface{}{
-			"id":   t.MID,
-			"name": milestone.Name,
-		}
-	}
-
-	return brief
-}
-
-// Detail returns detail information for this task.
-func (t *Task) Detail() map[string]interface{} {
+// Detail returns detail information for this task. Records referencing this
+// task are filtered by what given user can see.
+func (t *Task) Detail(uid int64) map[string]interface{} {
 	proj := project.Find(t.PID)
 
 	return map[string]interface{}{
@@ -505,17 +535,24 @@ func (t *Task) Detail() map[string]interface{} {
 		"name":        t.Name,
 		"proj":        proj,
 		"milestone":   proj.FindMilestone(t.MID),
+		"sprint":      t.GetSprint(),
+		"depends":     t.GetDepends(),
 		"weight":      t.Weight,
+		"estimate":    t.Estimate,
 		"state":       t.State,
 		"creator":     user.Find(t.Creator),
 		"developer":   user.Find(t.Developer),
 		"tester":      user.Find(t.Tester),
 		"startTime":   t.StartTime.Format("2006-01-02"),
 		"endTime":     t.EndTime.Format("2006-01-02"),
+		"labels":      t.GetLabels(),
+		"fields":      t.GetFields(),
 		"content":     t.Content,
+		"version":     t.Version,
 		"comments":    t.GetComments(),
 		"events":      t.GetEvents(),
 		"attachments": t.GetAttachments(),
+		"backlinks":   t.GetBacklinks(uid),
 	}
 }
 
@@ -523,5 +560,24 @@ func (t *Task) Detail() map[string]interface{} {
 func (t *Task) Delete() {
 	orm.Delete("task", t.ID)
 	orm.Exec("DELETE FROM `event` WHERE `tid`=?", t.ID)
+	orm.Exec("DELETE FROM `revision` WHERE `tid`=?", t.ID)
+	orm.Exec("DELETE FROM `tasklabel` WHERE `tid`=?", t.ID)
+	orm.Exec("DELETE FROM `fieldvalue` WHERE `tid`=?", t.ID)
+	orm.Exec("DELETE FROM `sprinttask` WHERE `tid`=?", t.ID)
+	orm.Exec("DELETE FROM `dependency` WHERE `tid`=? OR `depend`=?", t.ID, t.ID)
 	orm.Exec("DELETE FROM `notice` WHERE `tid`=?", t.ID)
+
+	search.Remove(search.KindTask, t.ID)
+	link.Remove(search.KindTask, t.ID)
+	if rows, err := orm.Query("SELECT `id` FROM `comment` WHERE `tid`=?", t.ID); err == nil {
+		defer rows.Close()
+
+		for rows.Next() {
+			var cid int64
+			if rows.Scan(&cid) == nil {
+				search.Remove(search.KindComment, cid)
+				link.Remove(search.KindComment, cid)
+			}
+		}
+	}
 }
@@ -17,6 +17,8 @@ const (
 	AutoLoginCookieKey = "login_token"
 	// AutoLoginSecret to sign login token
 	AutoLoginSecret = "@team.auto_login_secret_01"
+	// DefaultCapacity is default weekly capacity of new user.
+	DefaultCapacity = 40
 )
 
 type (
@@ -30,6 +32,7 @@ type (
 		IsBuildin       bool   `json:"isBuildin"`
 		IsSu            bool   `json:"isSu"`
 		IsLocked        bool   `json:"isLocked"`
+		Capacity        int32  `json:"capacity" orm:"notnull,default=40"`
 		AutoLoginExpire int64  `json:"-"`
 	}
 
@@ -126,6 +129,7 @@ func AddBuildIn(account, name, pswd string, isSu bool) error {
 		IsSu:      isSu,
 		IsBuildin: true,
 		IsLocked:  false,
+		Capacity:  DefaultCapacity,
 	}
 
 	if err := Add(one); err != nil {
@@ -144,6 +148,7 @@ func AddExternal(account string) (*User, error) {
 		IsSu:      false,
 		IsBuildin: false,
 		IsLocked:  false,
+		Capacity:  DefaultCapacity,
 	}
 
 	if err := Add(one); err != nil {
@@ -183,6 +188,7 @@ func Add(added *User) error {
 func Delete(uid int64) {
 	orm.Delete("user", uid)
 	orm.Exec("DELETE FROM `member` WHERE `uid`=?", uid)
+	orm.Exec("DELETE FROM `token` WHERE `uid`=?", uid)
 	userCache.Delete(uid)
 }
 
@@ -267,6 +273,26 @@ func SetPassword(uid int64, old, pswd string) error {
 	return err
 }
 
+// SetCapacity changes weekly capacity of an existing user.
+func SetCapacity(uid int64, capacity int32) error {
+	u := Find(uid)
+	if u == nil {
+		return fmt.Errorf("指定用户【%d】不存在或已被删除", uid)
+	}
+
+	if capacity < 0 {
+		return errors.New("无效的每周容量")
+	}
+
+	_, err := orm.Exec("UPDATE `user` SET `capacity`=? WHERE `id`=?", capacity, uid)
+	if err != nil {
+		return err
+	}
+
+	u.Capacity = capacity
+	return nil
+}
+
 // GetAutoLoginCookie returns auto login cookie data.
 func (u *User) GetAutoLoginCookie(ip string) *AutoLoginCookie {
 	expire := time.Now().Add(30 * 24 * time.Hour)
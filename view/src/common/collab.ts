@@ -0,0 +1,341 @@
+import {Notification} from '../components';
+import {DocumentCollaborator, DocumentCursor} from './protocol';
+
+/**
+ * 纯文本编辑操作。正数表示保留，负数表示删除，字符串表示插入。长度以Unicode码点计。
+ */
+export type Operation = (number|string)[];
+
+const length = (s: string) => Array.from(s).length;
+
+const retain = (op: Operation, n: number) => {
+    if (n <= 0) return;
+
+    let last = op[op.length - 1];
+    if (typeof last == 'number' && last > 0) {
+        op[op.length - 1] = last + n;
+    } else {
+        op.push(n);
+    }
+};
+
+const insert = (op: Operation, s: string) => {
+    if (s.length == 0) return;
+
+    let last = op[op.length - 1];
+    if (typeof last == 'string') {
+        op[op.length - 1] = last + s;
+    } else if (typeof last == 'number' && last < 0) {
+        // 同一位置上插入总在删除之前
+        let prev = op[op.length - 2];
+        if (typeof prev == 'string') {
+            op[op.length - 2] = prev + s;
+        } else {
+            op.splice(op.length - 1, 0, s);
+        }
+    } else {
+        op.push(s);
+    }
+};
+
+const remove = (op: Operation, n: number) => {
+    if (n <= 0) return;
+
+    let last = op[op.length - 1];
+    if (typeof last == 'number' && last < 0) {
+        op[op.length - 1] = last - n;
+    } else {
+        op.push(-n);
+    }
+};
+
+const consume = (c: number|string, n: number) => {
+    if (typeof c == 'string') {
+        let chars = Array.from(c);
+        return chars.length > n ? chars.slice(n).join('') : undefined;
+    }
+
+    let size = Math.abs(c);
+    return size > n ? Math.sign(c) * (size - n) : undefined;
+};
+
+/**
+ * 判断操作是否未改变任何内容
+ */
+export const isNoop = (op: Operation) => op.every(c => typeof c == 'number' && c > 0);
+
+/**
+ * 在文档上执行编辑操作
+ */
+export const apply = (doc: string, op: Operation) => {
+    let chars = Array.from(doc);
+    let out: string[] = [];
+    let pos = 0;
+
+    op.forEach(c => {
+        if (typeof c == 'string') {
+            out.push(c);
+        } else if (c > 0) {
+            out.push(chars.slice(pos, pos + c).join(''));
+            pos += c;
+        } else {
+            pos -= c;
+        }
+    });
+
+    if (pos != chars.length) throw new Error('编辑操作与文档长度不匹配');
+    return out.join('');
+};
+
+/**
+ * 变换两个并发操作，返回[a', b']，使得 apply(apply(doc, a), b') == apply(apply(doc, b), a')。
+ * 同一位置的插入，a 优先。
+ */
+export const transform = (a: Operation, b: Operation): [Operation, Operation] => {
+    let ap: Operation = [], bp: Operation = [];
+    let i = 0, j = 0;
+    let ca = a[i++], cb = b[j++];
+
+    while (ca !== undefined || cb !== undefined) {
+        if (typeof ca == 'string') {
+            insert(ap, ca);
+            retain(bp, length(ca));
+            ca = a[i++];
+            continue;
+        }
+
+        if (typeof cb == 'string') {
+            retain(ap, length(cb));
+            insert(bp, cb);
+            cb = b[j++];
+            continue;
+        }
+
+        if (ca === undefined || cb === undefined) throw new Error('无效的编辑操作');
+
+        let n = Math.min(Math.abs(ca), Math.abs(cb));
+        if (ca > 0 && cb > 0) {
+            retain(ap, n);
+            retain(bp, n);
+        } else if (ca < 0 && cb > 0) {
+            remove(ap, n);
+        } else if (ca > 0 && cb < 0) {
+            remove(bp, n);
+        }
+
+        ca = consume(ca, n);
+        if (ca === undefined) ca = a[i++];
+        cb = consume(cb, n);
+        if (cb === undefined) cb = b[j++];
+    }
+
+    return [ap, bp];
+};
+
+/**
+ * 合并连续的两个操作，结果等价于先执行 a 再执行 b
+ */
+export const compose = (a: Operation, b: Operation) => {
+    let out: Operation = [];
+    let i = 0, j = 0;
+    let ca = a[i++], cb = b[j++];
+
+    while (ca !== undefined || cb !== undefined) {
+        if (typeof ca == 'number' && ca < 0) {
+            remove(out, -ca);
+            ca = a[i++];
+            continue;
+        }
+
+        if (typeof cb == 'string') {
+            insert(out, cb);
+            cb = b[j++];
+            continue;
+        }
+
+        if (ca === undefined || cb === undefined) throw new Error('无效的编辑操作');
+
+        let n = Math.min(typeof ca == 'string' ? length(ca) : ca, Math.abs(cb));
+        if (typeof ca == 'string') {
+            if (cb > 0) insert(out, Array.from(ca).slice(0, n).join(''));
+        } else if (cb > 0) {
+            retain(out, n);
+        } else {
+            remove(out, n);
+        }
+
+        ca = consume(ca, n);
+        if (ca === undefined) ca = a[i++];
+        cb = consume(cb, n);
+        if (cb === undefined) cb = b[j++];
+    }
+
+    return out;
+};
+
+/**
+ * 根据新旧内容计算编辑操作
+ */
+export const diff = (before: string, after: string) => {
+    let a = Array.from(before), b = Array.from(after);
+    let prefix = 0, suffix = 0;
+
+    while (prefix < a.length && prefix < b.length && a[prefix] == b[prefix]) prefix++;
+    while (suffix < a.length - prefix && suffix < b.length - prefix && a[a.length - 1 - suffix] == b[b.length - 1 - suffix]) suffix++;
+
+    let op: Operation = [];
+    retain(op, prefix);
+    insert(op, b.slice(prefix, b.length - suffix).join(''));
+    remove(op, a.length - prefix - suffix);
+    retain(op, suffix);
+    return op;
+};
+
+/**
+ * 计算光标位置在执行编辑操作后的新位置
+ */
+export const transformIndex = (op: Operation, index: number) => {
+    let pos = 0, moved = index;
+
+    for (let i = 0; i < op.length && pos <= index; ++i) {
+        let c = op[i];
+        if (typeof c == 'string') {
+            moved += length(c);
+        } else if (c > 0) {
+            pos += c;
+        } else {
+            moved -= Math.min(index - pos, -c);
+            pos -= c;
+        }
+    }
+
+    return moved;
+};
+
+interface CollabHandlers {
+    onContent: (content: string) => void;
+    onPeers: (peers: DocumentCollaborator[]) => void;
+    onClose?: () => void;
+}
+
+/**
+ * 文档协同编辑客户端
+ */
+export class CollabClient {
+    private ws: WebSocket;
+    private timer: number;
+    private ready = false;
+    private rev = 0;
+    private content = '';
+    private pending: Operation = null;
+    private buffer: Operation = null;
+    private peers: {[id: number]: DocumentCollaborator} = {};
+
+    constructor(doc: number, private handlers: CollabHandlers) {
+        let protocol = location.protocol == 'https:' ? 'wss' : 'ws';
+        this.ws = new WebSocket(`${protocol}://${location.host}/api/document/${doc}/collab`);
+        this.ws.onmessage = ev => this.receive(JSON.parse(ev.data));
+        this.ws.onclose = () => {
+            window.clearInterval(this.timer);
+            this.handlers.onClose && this.handlers.onClose();
+        };
+        this.timer = window.setInterval(() => this.send({type: 'ping'}), 30000);
+    }
+
+    /**
+     * 本地内容修改
+     */
+    change(content: string) {
+        if (!this.ready) return;
+
+        let op = diff(this.content, content);
+        if (isNoop(op)) return;
+
+        this.content = content;
+        if (this.pending == null) {
+            this.pending = op;
+            this.send({type: 'op', rev: this.rev, op});
+        } else {
+            this.buffer = this.buffer ? compose(this.buffer, op) : op;
+        }
+    }
+
+    /**
+     * 本地光标或选区变化，参数为UTF-16下标
+     */
+    select(start: number, end: number) {
+        if (!this.ready || this.pending != null) return;
+
+        const toIndex = (n: number) => length(this.content.substr(0, n));
+        this.send({type: 'cursor', rev: this.rev, cursor: {anchor: toIndex(start), head: toIndex(end)}});
+    }
+
+    close() {
+        window.clearInterval(this.timer);
+        this.ws.close();
+    }
+
+    private send(msg: any) {
+        if (this.ws.readyState == WebSocket.OPEN) this.ws.send(JSON.stringify(msg));
+    }
+
+    private receive(msg: any) {
+        switch (msg.type) {
+        case 'init':
+            this.ready = true;
+            this.rev = msg.rev;
+            this.content = msg.content;
+            this.peers = {};
+            (msg.clients as DocumentCollaborator[]).forEach(c => this.peers[c.id] = c);
+            this.handlers.onContent(this.content);
+            this.notifyPeers();
+            break;
+        case 'ack':
+            this.rev = msg.rev;
+            this.pending = this.buffer;
+            this.buffer = null;
+            if (this.pending) this.send({type: 'op', rev: this.rev, op: this.pending});
+            break;
+        case 'op':
+            let op: Operation = msg.op;
+            this.rev = msg.rev;
+            if (this.pending) [op, this.pending] = transform(op, this.pending);
+            if (this.buffer) [op, this.buffer] = transform(op, this.buffer);
+            this.content = apply(this.content, op);
+            this.moveCursors(op);
+            this.handlers.onContent(this.content);
+            break;
+        case 'cursor':
+            if (this.peers[msg.client]) this.peers[msg.client].cursor = msg.cursor as DocumentCursor;
+            this.notifyPeers();
+            break;
+        case 'join':
+            this.peers[msg.client.id] = msg.client;
+            this.notifyPeers();
+            break;
+        case 'leave':
+            delete this.peers[msg.client];
+            this.notifyPeers();
+            break;
+        case 'error':
+            Notification.alert(msg.err, 'error');
+            break;
+        }
+    }
+
+    private moveCursors(op: Operation) {
+        for (let id in this.peers) {
+            let cursor = this.peers[id].cursor;
+            if (cursor) {
+                cursor.anchor = transformIndex(op, cursor.anchor);
+                cursor.head = transformIndex(op, cursor.head);
+            }
+        }
+
+        this.notifyPeers();
+    }
+
+    private notifyPeers() {
+        this.handlers.onPeers(Object.keys(this.peers).map(id => this.peers[Number(id)]));
+    }
+}
@@ -307,6 +307,11 @@ export interface Task {
      */
     content?: string;
 
+    /**
+     * 任务内容版本号
+     */
+    version?: number;
+
     /**
      * 任务附件列表
      */
@@ -317,6 +322,11 @@ export interface Task {
      */
     comments?: TaskComment[];
 
+    /**
+     * 引用了该任务的文档、任务和评论
+     */
+    backlinks?: Backlink[];
+
     /**
      * 事件
      */
@@ -339,6 +349,14 @@ export interface Notice {
      * 相关任务名
      */
     tname: string;
+    /**
+     * 相关文档ID，非0时表示文档事件
+     */
+    did?: number;
+    /**
+     * 相关文档标题
+     */
+    dname?: string;
     /**
      * 相关操作人员
      */
@@ -365,6 +383,10 @@ export interface Document {
      * 父节点ID
      */
     parent: number;
+    /**
+     * 所属项目ID，0表示不属于任何项目
+     */
+    pid?: number;
     /**
      * 标题
      */
@@ -385,6 +407,176 @@ export interface Document {
      * 内容
      */
     content?: string;
+    /**
+     * 内容版本号
+     */
+    version?: number;
+    /**
+     * 当前用户是否可编辑
+     */
+    writable?: boolean;
+    /**
+     * 当前用户是否可管理项目及权限
+     */
+    manage?: boolean;
+    /**
+     * 引用了该文档的文档、任务和评论
+     */
+    backlinks?: Backlink[];
+    /**
+     * 评论列表
+     */
+    comments?: DocumentComment[];
+}
+
+/**
+ * 文档评论
+ */
+export interface DocumentComment {
+    /**
+     * 唯一ID
+     */
+    id: number;
+    /**
+     * 评论者ID
+     */
+    uid: number;
+    /**
+     * 所属评论ID，0表示顶层评论
+     */
+    parent: number;
+    /**
+     * 时间
+     */
+    time: string;
+    /**
+     * 评论者
+     */
+    user: string;
+    /**
+     * 头像
+     */
+    avatar: string;
+    /**
+     * 关联的标题
+     */
+    heading: string;
+    /**
+     * 关联文字的起始位置
+     */
+    start: number;
+    /**
+     * 关联文字的结束位置
+     */
+    end: number;
+    /**
+     * 关联的文字
+     */
+    quote: string;
+    /**
+     * 是否已解决
+     */
+    isResolved: boolean;
+    /**
+     * 解决人
+     */
+    resolver: string;
+    /**
+     * 内容
+     */
+    content: string;
+    /**
+     * 回复列表
+     */
+    replies?: DocumentComment[];
+}
+
+/**
+ * 文档权限
+ */
+export interface DocumentPermission {
+    id: number;
+    /**
+     * 授权类型：0 - 用户，1 - 项目角色
+     */
+    kind: number;
+    /**
+     * 用户ID或角色下标
+     */
+    target: number;
+    /**
+     * 用户名（仅用户授权）
+     */
+    name?: string;
+    /**
+     * 是否可编辑
+     */
+    write: boolean;
+}
+
+/**
+ * 文档模板
+ */
+export interface DocumentTemplate {
+    id: number;
+    /**
+     * 所属项目ID，0表示全局模板
+     */
+    pid: number;
+    /**
+     * 模板名称
+     */
+    name: string;
+    /**
+     * 创建者
+     */
+    author: string;
+    /**
+     * 最后修改时间
+     */
+    time: string;
+    /**
+     * 模板内容，可包含占位符
+     */
+    content: string;
+    /**
+     * 当前用户是否可管理该模板
+     */
+    manage: boolean;
+}
+
+/**
+ * 协同编辑者光标/选区，以Unicode码点计
+ */
+export interface DocumentCursor {
+    anchor: number;
+    head: number;
+}
+
+/**
+ * 文档协同编辑者
+ */
+export interface DocumentCollaborator {
+    /**
+     * 连接ID
+     */
+    id: number;
+    /**
+     * 用户ID
+     */
+    uid: number;
+    /**
+     * 用户名
+     */
+    name: string;
+    /**
+     * 头像
+     */
+    avatar: string;
+    /**
+     * 光标位置
+     */
+    cursor?: DocumentCursor;
 }
 
 /**
@@ -411,4 +603,76 @@ export interface Share {
      * 大小
      */
     size: number;
-}
\ No newline at end of file
+}
+
+/**
+ * 搜索结果
+ */
+export interface SearchResult {
+    /**
+     * 类型：0-文档，1-任务，2-评论
+     */
+    kind: number;
+    /**
+     * 文档、任务或评论ID
+     */
+    id: number;
+    /**
+     * 标题
+     */
+    title: string;
+    /**
+     * 命中位置附近的内容
+     */
+    snippet: string;
+    /**
+     * 相关度
+     */
+    score: number;
+    /**
+     * 所属项目ID
+     */
+    pid?: number;
+    /**
+     * 评论所属任务ID
+     */
+    tid?: number;
+    /**
+     * 评论作者
+     */
+    author?: string;
+    /**
+     * 时间
+     */
+    time?: string;
+}
+
+/**
+ * 反向引用
+ */
+export interface Backlink {
+    /**
+     * 引用来源类型：0-文档，1-任务，2-评论
+     */
+    kind: number;
+    /**
+     * 文档、任务或评论ID
+     */
+    id: number;
+    /**
+     * 标题，评论为所属任务名
+     */
+    title: string;
+    /**
+     * 所属项目ID
+     */
+    pid?: number;
+    /**
+     * 评论所属任务ID
+     */
+    tid?: number;
+    /**
+     * 评论作者
+     */
+    author?: string;
+}
@@ -24,9 +24,21 @@ interface EditorProps {
     height?: number | string;
     value?: string;
     onChange?: (data: string) => void;
+    onSelect?: (start: number, end: number) => void;
     onUpload?: CustomUpload;
 }
 
+// 站内链接：task:任务ID、doc:文档ID
+const transformLinkUri = (uri: string) => {
+    let match = /^task:(\d+)$/.exec(uri);
+    if (match) return `/?task=${match[1]}`;
+
+    match = /^doc(?:ument)?:(\d+)$/.exec(uri);
+    if (match) return `/?document=${match[1]}`;
+
+    return (ReactMarkdown as any).uriTransformer(uri);
+};
+
 const Renderer = (props: RendererProps) => {
     const customRenderers = {
         listItem: (props: any) => {
@@ -58,6 +70,7 @@ const Renderer = (props: RendererProps) => {
         <ReactMarkdown 
             source={props.source || ''} 
             escapeHtml={false}
+            transformLinkUri={transformLinkUri}
             className='markdown'
             renderers={customRenderers}/>
     )
@@ -68,6 +81,31 @@ const Editor = (props: EditorProps) => {
     const [showPreview, setShowPreview] = React.useState<boolean>(false);
     const textArea = React.useRef<HTMLTextAreaElement>();
     const viewerArea = React.useRef<HTMLDivElement>();
+    const selection = React.useRef<number[]>(null);
+
+    // 外部修改内容（如协同编辑）时保持光标位置
+    React.useEffect(() => {
+        if (props.value == null || props.value == content) return;
+
+        let elem = textArea.current;
+        if (elem && document.activeElement == elem) {
+            let prefix = 0;
+            while (prefix < content.length && prefix < props.value.length && content[prefix] == props.value[prefix]) prefix++;
+
+            let delta = props.value.length - content.length;
+            const move = (pos: number) => pos > prefix ? Math.max(prefix, pos + delta) : pos;
+            selection.current = [move(elem.selectionStart), move(elem.selectionEnd)];
+        }
+
+        setContent(props.value);
+    }, [props.value]);
+
+    React.useLayoutEffect(() => {
+        if (selection.current && textArea.current) {
+            textArea.current.setSelectionRange(selection.current[0], selection.current[1]);
+            selection.current = null;
+        }
+    }, [content]);
 
     const toolbar = [
         [
@@ -201,6 +239,7 @@ const Editor = (props: EditorProps) => {
                         value={content}
                         onScroll={syncScroll}
                         onChange={onContentChange}
+                        onSelect={ev => props.onSelect && props.onSelect(ev.currentTarget.selectionStart, ev.currentTarget.selectionEnd)}
                         onPaste={pasteImage}/>
                 </Col>
 
@@ -0,0 +1,226 @@
+import * as React from 'react';
+import * as moment from 'moment';
+
+import {Avatar, Badge, Button, Icon, Input, Markdown, Modal, Notification, Row} from '../../components';
+import {Document, DocumentComment, User} from '../../common/protocol';
+import {request} from '../../common/request';
+
+interface CommentPanelProps {
+    doc: Document;
+    onChanged: () => void;
+};
+
+interface Anchor {
+    heading?: string;
+    start?: number;
+    end?: number;
+    quote?: string;
+};
+
+const headingsOf = (content: string) => {
+    const list: string[] = [];
+    let fence = '';
+
+    (content || '').split('\n').forEach(line => {
+        const trimmed = line.replace(/^ +/, '');
+        if (fence) {
+            if (trimmed.startsWith(fence)) fence = '';
+            return;
+        }
+
+        if (trimmed.startsWith('```') || trimmed.startsWith('~~~')) {
+            fence = trimmed.substr(0, 3);
+            return;
+        }
+
+        const m = line.match(/^ {0,3}#{1,6}[ \t]+(.*?)(?:[ \t]+#+)?[ \t]*$/);
+        if (m && m[1]) list.push(m[1]);
+    });
+
+    return list;
+};
+
+export const CommentPanel = (props: CommentPanelProps) => {
+    const {doc} = props;
+    const [content, setContent] = React.useState<string>('');
+    const [anchor, setAnchor] = React.useState<Anchor>({});
+    const [replyTo, setReplyTo] = React.useState<number>(0);
+    const [reply, setReply] = React.useState<string>('');
+    const [showResolved, setShowResolved] = React.useState<boolean>(false);
+    const [uid, setUid] = React.useState<number>(0);
+
+    const comments = doc.comments || [];
+    const headings = headingsOf(doc.content);
+    const resolvedCount = comments.filter(c => c.isResolved).length;
+
+    React.useEffect(() => {
+        request({url: '/api/user', dontShowLoading: true, success: (data: User) => setUid(data.id)});
+    }, []);
+
+    React.useEffect(() => {
+        setContent('');
+        setAnchor({});
+        setReplyTo(0);
+    }, [doc.id]);
+
+    const quoteSelection = () => {
+        const selected = window.getSelection().toString().trim();
+        if (!selected) {
+            Notification.alert('请先在文档中选中要评论的文字', 'warning');
+            return;
+        }
+
+        const idx = (doc.content || '').indexOf(selected);
+        if (idx < 0) {
+            Notification.alert('选中的文字包含格式，无法在原文中定位，请缩小选择范围', 'warning');
+            return;
+        }
+
+        const start = Array.from(doc.content.slice(0, idx)).length;
+        setAnchor({start, end: start + Array.from(selected).length, quote: selected});
+    };
+
+    const submit = () => {
+        if (!content.trim()) return;
+
+        let param = new FormData();
+        param.append('content', content);
+        if (anchor.heading) param.append('heading', anchor.heading);
+        if (anchor.quote) {
+            param.append('start', `${anchor.start}`);
+            param.append('end', `${anchor.end}`);
+        }
+
+        request({
+            url: `/api/document/${doc.id}/comment`,
+            method: 'POST',
+            data: param,
+            success: () => {
+                setContent('');
+                setAnchor({});
+                props.onChanged();
+            }
+        });
+    };
+
+    const submitReply = (parent: number) => {
+        if (!reply.trim()) return;
+
+        let param = new FormData();
+        param.append('content', reply);
+        param.append('parent', `${parent}`);
+        request({
+            url: `/api/document/${doc.id}/comment`,
+            method: 'POST',
+            data: param,
+            success: () => {
+                setReply('');
+                setReplyTo(0);
+                props.onChanged();
+            }
+        });
+    };
+
+    const setResolved = (c: DocumentComment, resolved: boolean) => {
+        let param = new FormData();
+        param.append('resolved', `${resolved}`);
+        request({url: `/api/document/${doc.id}/comment/${c.id}/resolve`, method: 'PUT', data: param, success: props.onChanged});
+    };
+
+    const editComment = (c: DocumentComment) => {
+        let edited = c.content;
+
+        Modal.open({
+            title: '编辑评论',
+            body: <div style={{width: 480}}><Markdown.Editor value={edited} onChange={v => edited = v} rows={6}/></div>,
+            onOk: () => {
+                let param = new FormData();
+                param.append('content', edited);
+                request({url: `/api/document/${doc.id}/comment/${c.id}`, method: 'PUT', data: param, success: props.onChanged});
+            }
+        });
+    };
+
+    const delComment = (c: DocumentComment) => {
+        Modal.open({
+            title: '删除确认',
+            body: <div className='my-2'>确定要删除该评论吗？{c.parent == 0&&'所有回复也将一并删除。'}</div>,
+            onOk: () => request({url: `/api/document/${doc.id}/comment/${c.id}`, method: 'DELETE', success: props.onChanged}),
+        });
+    };
+
+    const renderComment = (c: DocumentComment) => {
+        const actions = [
+            c.parent == 0&&<a key='reply' className='link' href='javascript:void(0)' onClick={() => {setReplyTo(c.id); setReply('')}}>回复</a>,
+            c.parent == 0&&<a key='resolve' className='link' href='javascript:void(0)' onClick={() => setResolved(c, !c.isResolved)}>{c.isResolved ? '重新打开' : '解决'}</a>,
+            c.uid == uid&&<a key='edit' className='link' href='javascript:void(0)' onClick={() => editComment(c)}>编辑</a>,
+            (c.uid == uid || doc.manage)&&<a key='delete' className='link' href='javascript:void(0)' onClick={() => delComment(c)}>删除</a>,
+        ].filter(a => a);
+
+        return (
+            <Row key={c.id} flex={{align: 'top', justify: 'start'}} className='my-2'>
+                <Avatar src={c.avatar} size={c.parent ? 24 : 32} className='mt-1'/>
+                <div className='ml-2' style={{flex: 1}}>
+                    <p style={{fontSize: 12, marginBottom: 4}}>
+                        <span>{c.user}</span>
+                        <span className='ml-3' style={{color: '#ccc'}} title={c.time}>{moment(c.time).fromNow()}</span>
+                        {c.isResolved&&<Badge className='ml-2'>{c.resolver}已解决</Badge>}
+                        <span style={{float: 'right'}}>
+                            {actions.map((a, i) => [i > 0&&<div key={`divider-${i}`} className='divider-v'/>, a])}
+                        </span>
+                    </p>
+                    {c.heading&&<p className='fg-muted' style={{fontSize: 12, marginBottom: 4}}><Icon type='number' className='mr-1'/>{c.heading}</p>}
+                    {c.quote&&<blockquote className='fg-muted' style={{fontSize: 12, margin: '0 0 4px', paddingLeft: 8, borderLeft: '3px solid #ddd'}}>{c.quote}</blockquote>}
+                    <Markdown.Renderer source={c.content}/>
+
+                    {(c.replies || []).map(renderComment)}
+
+                    {replyTo == c.id&&(
+                        <div className='mt-1'>
+                            <Markdown.Editor value={reply} onChange={setReply} rows={3}/>
+                            <div className='mt-1 center-child'>
+                                <Button theme='primary' size='sm' onClick={() => submitReply(c.id)}>回复</Button>
+                                <Button size='sm' onClick={() => setReplyTo(0)}>取消</Button>
+                            </div>
+                        </div>
+                    )}
+                </div>
+            </Row>
+        );
+    };
+
+    return (
+        <div className='mt-4'>
+            <Row flex={{align: 'middle', justify: 'space-between'}} className='mb-2'>
+                <label className='text-bold'><Icon type='message' className='mr-1'/>评论（{comments.length - resolvedCount}）</label>
+                {resolvedCount > 0&&(
+                    <a className='link' style={{fontSize: 12}} href='javascript:void(0)' onClick={() => setShowResolved(prev => !prev)}>
+                        {showResolved ? '隐藏' : '显示'}已解决的评论（{resolvedCount}）
+                    </a>
+                )}
+            </Row>
+
+            {comments.filter(c => showResolved || !c.isResolved).map(renderComment)}
+
+            <div className='mt-2'>
+                <Row flex={{align: 'middle', justify: 'start'}} className='mb-1'>
+                    <label className='fg-muted mr-2' style={{fontSize: 12}}>关联：</label>
+                    <Input.Select
+                        style={{width: 200}}
+                        value={anchor.quote ? '$quote' : (anchor.heading || '')}
+                        onChange={ev => setAnchor(ev.target.value == '$quote' ? anchor : {heading: ev.target.value})}>
+                        <option value=''>整篇文档</option>
+                        {anchor.quote&&<option value='$quote'>选中的文字</option>}
+                        {headings.map((h, i) => <option key={i} value={h}>标题：{h}</option>)}
+                    </Input.Select>
+                    <a className='link ml-2' style={{fontSize: 12}} href='javascript:void(0)' onMouseDown={ev => ev.preventDefault()} onClick={quoteSelection}>引用选中文字</a>
+                </Row>
+                {anchor.quote&&<blockquote className='fg-muted' style={{fontSize: 12, margin: '0 0 4px', paddingLeft: 8, borderLeft: '3px solid #ddd'}}>{anchor.quote}</blockquote>}
+                <Markdown.Editor value={content} onChange={setContent} rows={3}/>
+                <div className='mt-1 center-child'>
+                    <Button theme='primary' size='sm' onClick={submit}>发表评论</Button>
+                </div>
+            </div>
+        </div>
+    );
+};
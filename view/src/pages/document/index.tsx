@@ -1,24 +1,48 @@
 import * as React from 'react';
 
-import {Icon, Layout, Markdown, Tree, TreeNode, TreeNodeAction, Modal, Input, Badge, Notification, Button, Row} from '../../components';
-import {Document} from '../../common/protocol';
+import {Icon, Layout, Markdown, Tree, TreeNode, TreeNodeAction, Modal, Input, Badge, Notification, Button, Row, Avatar, Breadcrumb} from '../../components';
+import {Document, DocumentCollaborator, DocumentTemplate, Project} from '../../common/protocol';
 import {request} from '../../common/request';
+import {CollabClient} from '../../common/collab';
+import {PermissionEditor} from './permission';
+import {TemplateManager} from './template';
+import {CommentPanel} from './comment';
+import {BacklinkList} from '../search/backlinks';
+import {Viewer} from '../task/viewer';
 
-export const DocumentPage = () => {
+interface DocumentPageProps {
+    open?: number;
+};
+
+export const DocumentPage = (props: DocumentPageProps) => {
     const [nodes, setNodes] = React.useState<TreeNode[]>([]);
     const [current, setCurrent] = React.useState<Document>(null);
     const [isEditing, setEditing] = React.useState<boolean>(false);
     const [editContent, setEditContent] = React.useState<string>();
+    const [collab, setCollab] = React.useState<CollabClient>(null);
+    const [peers, setPeers] = React.useState<DocumentCollaborator[]>([]);
+    const [path, setPath] = React.useState<Document[]>([]);
 
     const nodeContextMenu: TreeNodeAction[] = [
         {label: '新建同级', onClick: n => addDoc(n.data?findNode(n.data.parent):n)},
         {label: '新建子级', onClick: n => addDoc(n), isEnabled: n => n.data != null},
         {label: '重命名', onClick: n => renameDoc(n.data.id, n.data.title), isEnabled: n => n.data != null},
         {label: '编辑', onClick: n => fetchDetail(n.data, true), isEnabled: n => n.data != null},
-        {label: '删除', onClick: n => delDoc(n.data.id), isEnabled: n => n.data != null},
+        {label: '协同编辑', onClick: n => startCollab(n.data), isEnabled: n => n.data != null},
+        {label: '所属项目', onClick: n => moveToProject(n.data), isEnabled: n => n.data != null},
+        {label: '权限设置', onClick: n => editPermissions(n.data), isEnabled: n => n.data != null},
+        {label: '移动到', onClick: n => moveDoc(n.data), isEnabled: n => n.data != null},
+        {label: '上移', onClick: n => reorderDoc(n, -1), isEnabled: n => n.data != null},
+        {label: '下移', onClick: n => reorderDoc(n, 1), isEnabled: n => n.data != null},
+        {label: '导出', onClick: n => exportDoc(n), isEnabled: n => n.data != null},
+        {label: '删除', onClick: n => delDoc(n), isEnabled: n => n.data != null},
     ];
 
-    React.useEffect(() => fetchAll(), []);
+    React.useEffect(() => {
+        fetchAll();
+        if (props.open) fetchDetail({id: props.open} as Document, false);
+    }, []);
+    React.useEffect(() => () => collab&&collab.close(), [collab]);
 
     const fetchAll = () => {
         request({
@@ -68,8 +92,32 @@ export const DocumentPage = () => {
                 setEditContent(data.content);
             }
         });
+
+        request({url: `/api/document/${doc.id}/path`, dontShowLoading: true, success: setPath});
+    };
+
+    const startCollab = (doc: Document) => {
+        if (collab) collab.close();
+
+        setCurrent(doc);
+        setEditing(false);
+        setEditContent('');
+        setPeers([]);
+        setCollab(new CollabClient(doc.id, {
+            onContent: setEditContent,
+            onPeers: setPeers,
+            onClose: () => setCollab(null),
+        }));
     };
 
+    const stopCollab = () => {
+        collab.close();
+        setCollab(null);
+        fetchDetail(current, false);
+    };
+
+    const lineOf = (index: number) => Array.from(editContent || '').slice(0, index).join('').split('\n').length;
+
     const isValidName = (name: string) => {
         if (!name || name.length == 0) return {ok: false, err: '文档名不可为空'};
         
@@ -106,39 +154,64 @@ export const DocumentPage = () => {
     const addDoc = (parent: TreeNode) => {
         let parentName = parent.data?parent.data.title:'无';
         let parentId = parent.data?parent.data.id:-1;
+        let pid = parent.data?parent.data.pid||0:0;
         let name = '';
+        let template = 0;
 
-        Modal.open({
-            title: '新建文档',
-            body: (
-                <table>
-                    <tbody style={{lineHeight: '32px', fontSize: 12}}>
-                        <tr>
-                            <td>父节点：</td>
-                            <td><Badge theme='info'>{parentName}</Badge></td>
-                        </tr>
-                        <tr>
-                            <td>文档名：</td>
-                            <td><Input value={name} onChange={ev => name = ev}/></td>
-                        </tr>
-                    </tbody>                    
-                </table>
-            ),
-            onOk: () => {
-                let status = isValidName(name);
-                if (!status.ok) {
-                    Notification.alert(status.err, 'error');
-                    return;
-                }
+        request({
+            url: `/api/document/template/list?pid=${pid}`,
+            success: (templates: DocumentTemplate[]) => {
+                Modal.open({
+                    title: '新建文档',
+                    body: (
+                        <table>
+                            <tbody style={{lineHeight: '32px', fontSize: 12}}>
+                                <tr>
+                                    <td>父节点：</td>
+                                    <td><Badge theme='info'>{parentName}</Badge></td>
+                                </tr>
+                                <tr>
+                                    <td>文档名：</td>
+                                    <td><Input value={name} onChange={ev => name = ev}/></td>
+                                </tr>
+                                <tr>
+                                    <td>模板：</td>
+                                    <td>
+                                        <Input.Select value={template} onChange={ev => template = Number(ev.target.value)}>
+                                            <option value={0}>空白文档</option>
+                                            {templates.map(t => <option key={t.id} value={t.id}>{t.pid>0?'[项目] ':''}{t.name}</option>)}
+                                        </Input.Select>
+                                    </td>
+                                </tr>
+                            </tbody>
+                        </table>
+                    ),
+                    onOk: () => {
+                        let status = isValidName(name);
+                        if (!status.ok) {
+                            Notification.alert(status.err, 'error');
+                            return;
+                        }
 
-                let param = new FormData();
-                param.append('title', name);
-                param.append('parent', parentId);
-                request({url: '/api/document', method: 'POST', data: param, success: fetchAll});
+                        let param = new FormData();
+                        param.append('title', name);
+                        param.append('parent', parentId);
+                        param.append('template', `${template}`);
+                        request({url: '/api/document', method: 'POST', data: param, success: fetchAll});
+                    },
+                });
             },
         });
     };
 
+    const manageTemplates = () => {
+        Modal.open({
+            title: '模板管理',
+            body: <TemplateManager/>,
+            onOk: () => {},
+        });
+    };
+
     const renameDoc = (id: number, oldName: string) => {
         let name = oldName;
 
@@ -179,6 +252,7 @@ export const DocumentPage = () => {
 
         let param = new FormData();
         param.append('content', editContent);
+        param.append('version', `${current.version||0}`);
         request({
             url: `/api/document/${current.id}/content`,
             method: 'PUT',
@@ -187,8 +261,117 @@ export const DocumentPage = () => {
         });
     };
 
-    const delDoc = (id: number) => {
-        request({url: `/api/document/${id}`, method: 'DELETE', success: fetchAll});
+    const moveToProject = (doc: Document) => {
+        request({
+            url: '/api/project/mine',
+            success: (projs: Project[]) => {
+                let pid = doc.pid || 0;
+
+                Modal.open({
+                    title: '所属项目',
+                    body: (
+                        <Input.Select value={pid} onChange={ev => pid = Number(ev.target.value)} style={{width: 240}}>
+                            <option value={0}>无（所有人可见）</option>
+                            {projs.map(p => <option key={p.id} value={p.id}>{p.name}</option>)}
+                        </Input.Select>
+                    ),
+                    onOk: () => {
+                        let param = new FormData();
+                        param.append('pid', `${pid}`);
+                        request({url: `/api/document/${doc.id}/project`, method: 'PUT', data: param, success: fetchAll});
+                    },
+                });
+            },
+        });
+    };
+
+    const editPermissions = (doc: Document) => {
+        Modal.open({
+            title: `权限设置 - ${doc.title}`,
+            body: <PermissionEditor doc={doc}/>,
+            onOk: fetchAll,
+        });
+    };
+
+    const siblingsOf = (node: TreeNode) => node.data.parent == -1 ? nodes : (findNode(node.data.parent) || {children: []}).children;
+
+    const moveDoc = (doc: Document) => {
+        let targets: {id: number, label: string}[] = [{id: -1, label: '根目录'}];
+        const walk = (list: TreeNode[], depth: number) => list.forEach(n => {
+            if (n.data.id == doc.id) return;
+            targets.push({id: n.data.id, label: `${'\u3000'.repeat(depth)}${n.data.title}`});
+            walk(n.children, depth + 1);
+        });
+        walk(nodes.filter(n => n.data), 1);
+
+        let parent = doc.parent;
+        Modal.open({
+            title: `移动文档 - ${doc.title}`,
+            body: (
+                <Input.Select value={parent} onChange={ev => parent = Number(ev.target.value)} style={{width: 280}}>
+                    {targets.map(t => <option key={t.id} value={t.id}>{t.label}</option>)}
+                </Input.Select>
+            ),
+            onOk: () => {
+                let param = new FormData();
+                param.append('parent', `${parent}`);
+                request({url: `/api/document/${doc.id}/move`, method: 'PUT', data: param, success: fetchAll});
+            },
+        });
+    };
+
+    const reorderDoc = (node: TreeNode, offset: number) => {
+        let siblings = siblingsOf(node);
+        let index = siblings.findIndex(n => n.data && n.data.id == node.data.id) + offset;
+        if (index < 0 || index >= siblings.length) return;
+
+        let param = new FormData();
+        param.append('parent', `${node.data.parent}`);
+        param.append('index', `${index}`);
+        request({url: `/api/document/${node.data.id}/move`, method: 'PUT', data: param, success: fetchAll});
+    };
+
+    const delDoc = (node: TreeNode) => {
+        if (node.children.length == 0) {
+            request({url: `/api/document/${node.data.id}`, method: 'DELETE', success: fetchAll});
+            return;
+        }
+
+        let subtree = false;
+        Modal.open({
+            title: '删除文档',
+            icon: 'warning',
+            body: (
+                <div>
+                    <p className='mb-2'>文档【{node.data.title}】包含子文档，默认将子文档移至上级目录。</p>
+                    <Input.Checkbox label='同时删除所有子文档' value='subtree' onChange={v => subtree = v}/>
+                </div>
+            ),
+            onOk: () => {
+                request({url: `/api/document/${node.data.id}?subtree=${subtree}`, method: 'DELETE', success: fetchAll});
+            },
+        });
+    };
+
+    const exportDoc = (node: TreeNode) => {
+        if (node.children.length == 0) {
+            location.href = `/api/document/${node.data.id}/export`;
+            return;
+        }
+
+        let subtree = false;
+        Modal.open({
+            title: '导出文档',
+            body: (
+                <div>
+                    <p className='mb-2'>将文档【{node.data.title}】导出为HTML，图片将内嵌到文件中。</p>
+                    <Input.Checkbox label='同时导出所有子文档（ZIP压缩包）' value='subtree' onChange={v => subtree = v}/>
+                </div>
+            ),
+            onOk: () => {
+                location.href = `/api/document/${node.data.id}/export?subtree=${subtree}`;
+            },
+        });
     };
 
     const uploadForMarkdown = (file: File, done: (url: string) => void) => {
@@ -202,6 +385,7 @@ export const DocumentPage = () => {
             <Layout.Sider width={200} theme='light'>
                 <div style={{padding: 8, borderBottom: '1px solid #E2E2E2'}}>
                     <label className='text-bold fg-muted' style={{fontSize: '1.2em'}}><Icon type='book' className='mr-2'/>文档列表</label>
+                    <Icon type='snippets' className='fg-muted' style={{float: 'right', cursor: 'pointer', lineHeight: '1.8em'}} title='模板管理' onClick={manageTemplates}/>
                 </div>
 
                 <div className='p-2'>
@@ -210,7 +394,29 @@ export const DocumentPage = () => {
             </Layout.Sider>
 
             <Layout.Content>
-                {isEditing?(
+                {collab?(
+                    <div className='mt-3 px-1'>
+                        <Row flex={{align: 'middle', justify: 'start'}} className='mb-1 px-1'>
+                            <label className='fg-muted mr-2'>协同编辑中：</label>
+                            {peers.length == 0&&<span className='fg-muted'>暂无其他成员</span>}
+                            {peers.map(p => (
+                                <span key={p.id} className='mr-2' title={p.name}>
+                                    <Avatar src={p.avatar} size={20} className='mr-1'/>
+                                    {p.name}{p.cursor&&<span className='fg-muted'>（第{lineOf(p.cursor.head)}行）</span>}
+                                </span>
+                            ))}
+                        </Row>
+                        <Markdown.Editor
+                            value={editContent}
+                            onChange={v => {setEditContent(v); collab.change(v)}}
+                            onSelect={(start, end) => collab.select(start, end)}
+                            height='calc(100vh - 130px)'
+                            onUpload={uploadForMarkdown}/>
+                        <Row flex={{align: 'middle', justify: 'center'}}>
+                            <Button theme='primary' size='sm' onClick={stopCollab}>完成</Button>
+                        </Row>
+                    </div>
+                ):isEditing?(
                     <div className='mt-3 px-1'>
                         <Markdown.Editor value={editContent} onChange={v => setEditContent(v)} height='calc(100vh - 100px)' onUpload={uploadForMarkdown}/>
                         <Row flex={{align: 'middle', justify: 'center'}}>
@@ -220,7 +426,20 @@ export const DocumentPage = () => {
                     </div>
                 ):(
                     <div className='mt-3 px-2'>
+                        {current&&path.length>1&&(
+                            <Breadcrumb className='mb-2'>
+                                {path.map(p => <Breadcrumb.Item key={p.id} onClick={() => fetchDetail(p, false)}>{p.title}</Breadcrumb.Item>)}
+                            </Breadcrumb>
+                        )}
                         {current&&<Markdown.Renderer source={current.content}/>}
+                        {current&&(
+                            <BacklinkList
+                                className='mt-3'
+                                items={current.backlinks}
+                                onOpenTask={id => Viewer.open(id)}
+                                onOpenDocument={id => fetchDetail({id} as Document, false)}/>
+                        )}
+                        {current&&<CommentPanel doc={current} onChanged={() => fetchDetail(current, false)}/>}
                     </div>
                 )}
             </Layout.Content>
@@ -0,0 +1,73 @@
+import * as React from 'react';
+
+import {Button, Icon, Input, Notification, Row} from '../../components';
+import {Document, DocumentPermission, User} from '../../common/protocol';
+import {ProjectRole} from '../../common/consts';
+import {request} from '../../common/request';
+
+export const PermissionEditor = (props: {doc: Document}) => {
+    const [list, setList] = React.useState<DocumentPermission[]>([]);
+    const [users, setUsers] = React.useState<User[]>([]);
+    const [kind, setKind] = React.useState<number>(0);
+    const [target, setTarget] = React.useState<number>(-1);
+    const [write, setWrite] = React.useState<boolean>(false);
+
+    React.useEffect(() => {
+        fetchList();
+        request({url: '/api/user/list', success: setUsers});
+    }, []);
+
+    const fetchList = () => {
+        request({url: `/api/document/${props.doc.id}/permission/list`, success: setList});
+    };
+
+    const addPermission = () => {
+        if (target < 0) {
+            Notification.alert('请选择授权对象', 'error');
+            return;
+        }
+
+        let param = new FormData();
+        param.append('kind', `${kind}`);
+        param.append('target', `${target}`);
+        param.append('write', `${write}`);
+        request({url: `/api/document/${props.doc.id}/permission`, method: 'POST', data: param, success: fetchList});
+    };
+
+    const delPermission = (id: number) => {
+        request({url: `/api/document/${props.doc.id}/permission/${id}`, method: 'DELETE', success: fetchList});
+    };
+
+    return (
+        <div style={{minWidth: 400, fontSize: 12}}>
+            <p className='fg-muted mb-2'>未设置权限时，项目文档对项目成员开放，其他文档对所有人开放。</p>
+
+            <table style={{width: '100%', lineHeight: '28px'}}>
+                <tbody>
+                    {list.map(p => (
+                        <tr key={p.id}>
+                            <td>{p.kind == 0 ? `用户：${p.name}` : `角色：${ProjectRole[p.target]}`}</td>
+                            <td>{p.write ? '可编辑' : '只读'}</td>
+                            <td><Icon type='delete' className='fg-danger' style={{cursor: 'pointer'}} onClick={() => delPermission(p.id)}/></td>
+                        </tr>
+                    ))}
+                </tbody>
+            </table>
+
+            <Row flex={{align: 'middle', justify: 'start'}} className='mt-2'>
+                <Input.Select value={kind} onChange={ev => {setKind(Number(ev.target.value)); setTarget(-1)}} style={{width: 80}}>
+                    <option value={0}>用户</option>
+                    {props.doc.pid > 0&&<option value={1}>角色</option>}
+                </Input.Select>
+                <Input.Select value={target} onChange={ev => setTarget(Number(ev.target.value))} style={{width: 140, marginLeft: 4}}>
+                    <option value={-1}>请选择</option>
+                    {kind == 0
+                        ? users.map(u => <option key={u.id} value={u.id}>{u.name}</option>)
+                        : ProjectRole.map((r, i) => <option key={i} value={i}>{r}</option>)}
+                </Input.Select>
+                <Input.Checkbox label='可编辑' value='write' checked={write} onChange={setWrite} className='ml-2'/>
+                <Button theme='primary' size='sm' className='ml-2' onClick={addPermission}>添加</Button>
+            </Row>
+        </div>
+    );
+};
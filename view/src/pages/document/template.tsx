@@ -0,0 +1,100 @@
+import * as React from 'react';
+
+import {Button, Icon, Input, Markdown, Modal, Row} from '../../components';
+import {DocumentTemplate, Project} from '../../common/protocol';
+import {request} from '../../common/request';
+
+export const TemplateManager = () => {
+    const [projs, setProjs] = React.useState<Project[]>([]);
+    const [pid, setPid] = React.useState<number>(0);
+    const [list, setList] = React.useState<DocumentTemplate[]>([]);
+    const [placeholders, setPlaceholders] = React.useState<{[k: string]: string}>({});
+    const [editing, setEditing] = React.useState<DocumentTemplate>(null);
+
+    React.useEffect(() => {
+        request({url: '/api/project/mine', success: setProjs});
+        request({url: '/api/document/template/placeholder', success: setPlaceholders});
+    }, []);
+
+    React.useEffect(() => fetchList(), [pid]);
+
+    const fetchList = () => {
+        request({url: `/api/document/template/list?pid=${pid}`, success: (data: DocumentTemplate[]) => setList(data.filter(t => t.pid == pid))});
+    };
+
+    const save = () => {
+        let param = new FormData();
+        param.append('name', editing.name);
+        param.append('content', editing.content);
+
+        if (editing.id) {
+            request({url: `/api/document/template/${editing.id}`, method: 'PUT', data: param, success: () => {setEditing(null); fetchList()}});
+        } else {
+            param.append('pid', `${pid}`);
+            request({url: '/api/document/template', method: 'POST', data: param, success: () => {setEditing(null); fetchList()}});
+        }
+    };
+
+    const delTemplate = (tpl: DocumentTemplate) => {
+        Modal.open({
+            title: '删除确认',
+            body: <div className='my-2'>确定要删除模板【{tpl.name}】吗？已创建的文档不受影响。</div>,
+            onOk: () => request({url: `/api/document/template/${tpl.id}`, method: 'DELETE', success: fetchList}),
+        });
+    };
+
+    if (editing) {
+        return (
+            <div style={{width: 720, fontSize: 12}}>
+                <Row flex={{align: 'middle', justify: 'start'}} className='mb-2'>
+                    <label className='mr-2'>模板名称：</label>
+                    <Input style={{width: 240}} value={editing.name} onChange={v => setEditing({...editing, name: v})}/>
+                </Row>
+                <p className='fg-muted mb-1'>
+                    可用占位符：{Object.keys(placeholders).map(k => <code key={k} className='mr-2' title={placeholders[k]}>{k}</code>)}
+                </p>
+                <Markdown.Editor value={editing.content} onChange={v => setEditing({...editing, content: v})} height={360}/>
+                <Row flex={{align: 'middle', justify: 'center'}} className='mt-2'>
+                    <Button theme='primary' size='sm' onClick={save}>保存</Button>
+                    <Button size='sm' onClick={() => setEditing(null)}>取消</Button>
+                </Row>
+            </div>
+        );
+    }
+
+    return (
+        <div style={{width: 480, fontSize: 12}}>
+            <Row flex={{align: 'middle', justify: 'space-between'}} className='mb-2'>
+                <Input.Select value={pid} onChange={ev => setPid(Number(ev.target.value))} style={{width: 200}}>
+                    <option value={0}>全局模板</option>
+                    {projs.map(p => <option key={p.id} value={p.id}>项目：{p.name}</option>)}
+                </Input.Select>
+                <Button theme='primary' size='sm' onClick={() => setEditing({id: 0, pid: pid, name: '', author: '', time: '', content: '', manage: true})}>
+                    <Icon type='plus' className='mr-1'/>新建模板
+                </Button>
+            </Row>
+
+            <table style={{width: '100%', lineHeight: '28px'}}>
+                <tbody>
+                    {list.length == 0&&<tr><td className='fg-muted'>暂无模板</td></tr>}
+                    {list.map(t => (
+                        <tr key={t.id}>
+                            <td>{t.name}</td>
+                            <td className='fg-muted'>{t.author}</td>
+                            <td className='fg-muted'>{t.time}</td>
+                            <td>
+                                {t.manage&&(
+                                    <span>
+                                        <a className='link' href='javascript:void(0)' onClick={() => setEditing(t)}>编辑</a>
+                                        <div className='divider-v'/>
+                                        <a className='link' href='javascript:void(0)' onClick={() => delTemplate(t)}>删除</a>
+                                    </span>
+                                )}
+                            </td>
+                        </tr>
+                    ))}
+                </tbody>
+            </table>
+        </div>
+    );
+};
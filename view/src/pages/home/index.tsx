@@ -10,6 +10,8 @@ import {ProjectPage} from '../project';
 import {DocumentPage} from '../document';
 import {SharePage} from '../share';
 import {AdminPage} from '../admin';
+import {SearchPage} from '../search';
+import {Viewer} from '../task/viewer';
 
 interface MainMenu {
     name: string;
@@ -28,6 +30,7 @@ export const Home = () => {
         {name: '工作台', id: 'task', icon: 'dashboard', click: () => setPage(<TaskPage uid={user.id}/>)},
         {name: '项目', id: 'project', icon: 'pie-chart', click: () => setPage(<ProjectPage uid={user.id}/>)},
         {name: '文档', id: 'document', icon: 'read', click: () => setPage(<DocumentPage/>)},
+        {name: '搜索', id: 'search', icon: 'search', click: () => setPage(<SearchPage onOpenDocument={id => setPage(<DocumentPage key={id} open={id}/>)}/>)},
         {name: '分享', id: 'share', icon: 'cloud-upload', click: () => setPage(<SharePage/>)},
         {name: '管理', id: 'admin', icon: 'setting', click: () => setPage(<AdminPage/>), needAdmin: true},
     ];
@@ -36,6 +39,13 @@ export const Home = () => {
         fetchUserInfo();
         fetchNotices();
         setInterval(fetchNotices, 60000);
+
+        const params = new URLSearchParams(location.search);
+        const task = params.get('task');
+        if (task) Viewer.open(parseInt(task));
+
+        const doc = params.get('document');
+        if (doc) setPage(<DocumentPage open={parseInt(doc)}/>);
     }, []);
 
     const fetchUserInfo = () => {
@@ -0,0 +1,44 @@
+import * as React from 'react';
+
+import {Badge} from '../../components';
+import {Backlink} from '../../common/protocol';
+
+interface BacklinkListProps {
+    items: Backlink[];
+    onOpenTask: (id: number) => void;
+    onOpenDocument: (id: number) => void;
+    className?: string;
+};
+
+const kinds = ['文档', '任务', '评论'];
+
+export const BacklinkList = (props: BacklinkListProps) => {
+    if (!props.items || props.items.length == 0) return null;
+
+    const open = (b: Backlink) => {
+        switch (b.kind) {
+        case 0:
+            props.onOpenDocument(b.id);
+            break;
+        case 1:
+            props.onOpenTask(b.id);
+            break;
+        case 2:
+            props.onOpenTask(b.tid);
+            break;
+        }
+    };
+
+    return (
+        <div className={props.className}>
+            被引用：
+            {props.items.map(b => (
+                <span key={`${b.kind}-${b.id}`} className='mr-3'>
+                    <Badge className='mr-1'>{kinds[b.kind]}</Badge>
+                    <a className='link' href='javascript:void(0)' onClick={() => open(b)}>{b.kind == 0 ? b.title : `#${b.kind == 1 ? b.id : b.tid} ${b.title}`}</a>
+                    {b.kind == 2&&<small className='ml-1 fg-muted'>{b.author}</small>}
+                </span>
+            ))}
+        </div>
+    );
+};
@@ -0,0 +1,95 @@
+import * as React from 'react';
+
+import {Badge, Button, Empty, Icon, Input, Pagination} from '../../components';
+import {SearchResult} from '../../common/protocol';
+import {request} from '../../common/request';
+import {Viewer} from '../task/viewer';
+
+interface SearchPageProps {
+    onOpenDocument: (id: number) => void;
+};
+
+const kinds = ['文档', '任务', '评论'];
+const pageSize = 20;
+
+export const SearchPage = (props: SearchPageProps) => {
+    const [keyword, setKeyword] = React.useState<string>('');
+    const [kind, setKind] = React.useState<string>('');
+    const [page, setPage] = React.useState<number>(0);
+    const [result, setResult] = React.useState<{list: SearchResult[], total: number, terms: string[]}>(null);
+
+    const search = (p: number) => {
+        if (keyword.trim().length == 0) return;
+
+        let param = new URLSearchParams();
+        param.set('q', keyword);
+        param.set('kind', kind);
+        param.set('page', `${p+1}`);
+        param.set('size', `${pageSize}`);
+
+        request({
+            url: `/api/search?${param.toString()}`,
+            success: (data: {list: SearchResult[], total: number, terms: string[]}) => {
+                setPage(p);
+                setResult(data);
+            }
+        });
+    };
+
+    const open = (r: SearchResult) => {
+        switch (r.kind) {
+        case 0:
+            props.onOpenDocument(r.id);
+            break;
+        case 1:
+            Viewer.open(r.id);
+            break;
+        case 2:
+            Viewer.open(r.tid);
+            break;
+        }
+    };
+
+    const highlight = (text: string) => {
+        if (!result || result.terms.length == 0) return text;
+
+        const escaped = result.terms.map(t => t.replace(/[.*+?^${}()|[\]\\]/g, '\\$&'));
+        const parts = text.split(new RegExp(`(${escaped.join('|')})`, 'gi'));
+        return parts.map((p, i) => i % 2 == 1 ? <mark key={i}>{p}</mark> : p);
+    };
+
+    return (
+        <div className='m-4'>
+            <form className='mb-3' style={{display: 'flex'}} onSubmit={ev => {ev.preventDefault(); search(0)}}>
+                <Input.Select className='mr-2' style={{width: 100}} value={kind} onChange={ev => setKind(ev.target.value)}>
+                    <option value=''>全部</option>
+                    {kinds.map((k, i) => <option key={i} value={`${i}`}>{k}</option>)}
+                </Input.Select>
+                <Input style={{flex: 1}} placeholder='输入关键词搜索文档、任务和评论' value={keyword} onChange={setKeyword}/>
+                <Button className='ml-2' theme='primary' size='sm' type='submit'><Icon type='search' className='mr-1'/>搜索</Button>
+            </form>
+
+            {result&&(
+                <div>
+                    <div className='mb-2 fg-muted'>共找到 {result.total} 条结果</div>
+                    {result.list.length == 0&&<Empty label='没有匹配的结果'/>}
+                    {result.list.map(r => (
+                        <div key={`${r.kind}-${r.id}`} className='py-2' style={{borderBottom: '1px solid #eee'}}>
+                            <div>
+                                <Badge className='mr-2'>{kinds[r.kind]}</Badge>
+                                <a className='link' href='javascript:void(0)' onClick={() => open(r)}>{highlight(r.title)}</a>
+                                {r.kind == 2&&<small className='ml-2 fg-muted'>{r.author} · {r.time}</small>}
+                            </div>
+                            <div className='mt-1 fg-muted' style={{wordBreak: 'break-all'}}>{highlight(r.snippet)}</div>
+                        </div>
+                    ))}
+                    {result.total > pageSize&&(
+                        <div className='mt-3'>
+                            <Pagination current={page} total={Math.ceil(result.total / pageSize)} onChange={search}/>
+                        </div>
+                    )}
+                </div>
+            )}
+        </div>
+    );
+};
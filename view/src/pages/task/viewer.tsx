@@ -5,6 +5,7 @@ import {Avatar, Button, Drawer, Row, Badge, Icon, Markdown, Tab, Timeline, Modal
 import {Task, TaskEvent} from '../../common/protocol';
 import {TaskStatus, TaskWeight, ProjectRole} from '../../common/consts';
 import {request} from '../../common/request';
+import {BacklinkList} from '../search/backlinks';
 
 const makeTaskEvent = (ev: TaskEvent) => {
     let desc = '';
@@ -20,6 +21,15 @@ const makeTaskEvent = (ev: TaskEvent) => {
     case 7: desc = '修改了任务的优先级，原优先级：' + ev.extra; break;
     case 8: desc = '修改了任务的具体内容'; break;
     case 9: desc = '评论了任务'; break;
+    case 10: desc = '编辑了评论'; break;
+    case 11: desc = '删除了评论'; break;
+    case 12: desc = '添加了标签：' + ev.extra; break;
+    case 13: desc = '移除了标签：' + ev.extra; break;
+    case 14: desc = '修改了自定义字段，原值：' + ev.extra; break;
+    case 15: desc = '修改了任务的工作量估算，原估算：' + ev.extra; break;
+    case 16: desc = '调整了任务所属迭代，原迭代：' + ev.extra; break;
+    case 17: desc = '添加了前置依赖：' + ev.extra; break;
+    case 18: desc = '移除了前置依赖：' + ev.extra; break;
     default: desc = '对任务的其他内容进行了修改'; break;
     }
 
@@ -66,6 +76,12 @@ const TaskDetailReadOnly = (props: {task: Task}) => {
                 </div>
             )}
 
+            <BacklinkList
+                className='mt-2 mx-3'
+                items={task.backlinks}
+                onOpenTask={id => Viewer.open(id)}
+                onOpenDocument={id => location.href = `/?document=${id}`}/>
+
             <div className='mt-2'>
                 <Tab>
                     <Tab.Pane label='评论'>
@@ -178,6 +194,12 @@ const TaskDetail = (props: {task: Task; closer: () => void; onModified: () => vo
                 </div>
             )}
 
+            <BacklinkList
+                className='mt-2 mx-3'
+                items={task.backlinks}
+                onOpenTask={id => Viewer.open(id)}
+                onOpenDocument={id => location.href = `/?document=${id}`}/>
+
             <div className='mt-2'>
                 <Tab>
                     <Tab.Pane label='评论'>
@@ -332,6 +354,7 @@ TaskDetail.ContentEditor = (props: {task: Task, onCancel: () => void, onModified
 
         let param = new FormData();
         param.append('content', content);
+        param.append('version', `${props.task.version||0}`);
         request({
             url: `/api/task/${props.task.id}/content`,
             method: 'PUT',
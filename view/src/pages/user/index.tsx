@@ -18,6 +18,17 @@ export const UserPage = (props: UserPageProps) => {
     const [notices, setNotices] = React.useState<Notice[]>(props.notices);
 
     const makeNotice = (notice: Notice) => {
+        if (notice.did > 0) {
+            let doc = <a className='link' href={`/?document=${notice.did}`}>{notice.dname}</a>;
+
+            switch (notice.ev) {
+            case 0: return <p style={{marginBottom: 2}}><b>{notice.operator}</b>评论了文档{doc}</p>;
+            case 1: return <p style={{marginBottom: 2}}><b>{notice.operator}</b>回复了文档{doc}中的评论</p>;
+            case 2: return <p style={{marginBottom: 2}}><b>{notice.operator}</b>解决了你在文档{doc}中的评论</p>;
+            default: return <p style={{marginBottom: 2}}><b>{notice.operator}</b>对文档{doc}进行了其他操作</p>;
+            }
+        }
+
         let link = <a className='link' onClick={() => Viewer.open(notice.tid, () => {})}>{notice.tname}</a>;
 
         switch (notice.ev) {
@@ -31,6 +42,15 @@ export const UserPage = (props: UserPageProps) => {
         case 7: return <p style={{marginBottom: 2}}><b>{notice.operator}</b>修改了{link}的优先级</p>;
         case 8: return <p style={{marginBottom: 2}}><b>{notice.operator}</b>修改了{link}的具体内容</p>;
         case 9: return <p style={{marginBottom: 2}}><b>{notice.operator}</b>评论了{link}</p>;
+        case 10: return <p style={{marginBottom: 2}}><b>{notice.operator}</b>编辑了{link}中的评论</p>;
+        case 11: return <p style={{marginBottom: 2}}><b>{notice.operator}</b>删除了{link}中的评论</p>;
+        case 12: return <p style={{marginBottom: 2}}><b>{notice.operator}</b>为{link}添加了标签</p>;
+        case 13: return <p style={{marginBottom: 2}}><b>{notice.operator}</b>移除了{link}的标签</p>;
+        case 14: return <p style={{marginBottom: 2}}><b>{notice.operator}</b>修改了{link}的自定义字段</p>;
+        case 15: return <p style={{marginBottom: 2}}><b>{notice.operator}</b>修改了{link}的工作量估算</p>;
+        case 16: return <p style={{marginBottom: 2}}><b>{notice.operator}</b>调整了{link}所属的迭代</p>;
+        case 17: return <p style={{marginBottom: 2}}><b>{notice.operator}</b>为{link}添加了前置依赖</p>;
+        case 18: return <p style={{marginBottom: 2}}><b>{notice.operator}</b>移除了{link}的前置依赖</p>;
         default: return <p style={{marginBottom: 2}}><b>{notice.operator}</b>对{link}进行了其他修改</p>;
         }
     }